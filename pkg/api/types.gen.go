@@ -5,9 +5,88 @@ package api
 
 const (
 	AuthBearerTokenScopes   = "authBearerToken.Scopes"
+	ClientCredentialsScopes = "clientCredentials.Scopes"
 	UnauthBearerTokenScopes = "unauthBearerToken.Scopes"
 )
 
+// Statistics of a database connection pool.
+type DatabaseStats struct {
+	// Number of idle connections
+	Idle int `json:"idle"`
+
+	// Number of connections in use
+	InUse int `json:"in_use"`
+
+	// Connections closed because of max_idle_conns
+	MaxIdleClosed int64 `json:"max_idle_closed"`
+
+	// Connections closed because of conn_max_idle_time
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+
+	// Connections closed because of conn_max_lifetime
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+
+	// Maximal number of open connections, 0 means no limit
+	MaxOpenConnections int `json:"max_open_connections"`
+
+	// Number of open connections, in use and idle
+	OpenConnections int `json:"open_connections"`
+
+	// Total number of waits for a connection
+	WaitCount int64 `json:"wait_count"`
+
+	// Total time waited for connections in milliseconds
+	WaitDurationMs int64 `json:"wait_duration_ms"`
+}
+
+// A result of a single readiness check.
+type HealthCheck struct {
+	// Why the check failed
+	Error *string `json:"error,omitempty"`
+
+	// Either ok or fail
+	Status string `json:"status"`
+}
+
+// A submitted field, which is invalid, and why.
+type InvalidParam struct {
+	// Name of the field
+	Name string `json:"name"`
+
+	// Why the field is invalid
+	Reason string `json:"reason"`
+}
+
+// A public JSON Web Key (RFC 7517) used for validating signatures of JWTs.
+type JWK struct {
+	// Signing algorithm used with the key
+	Alg string `json:"alg"`
+
+	// Curve of an EC or OKP key
+	Crv *string `json:"crv,omitempty"`
+
+	// Exponent of a RSA key
+	E *string `json:"e,omitempty"`
+
+	// Key ID, matching the kid header of JWTs
+	Kid string `json:"kid"`
+
+	// Key type
+	Kty string `json:"kty"`
+
+	// Modulus of a RSA key
+	N *string `json:"n,omitempty"`
+
+	// Intended use of the key
+	Use string `json:"use"`
+
+	// X coordinate of an EC key, or an OKP public key
+	X *string `json:"x,omitempty"`
+
+	// Y coordinate of an EC key
+	Y *string `json:"y,omitempty"`
+}
+
 // A problem details response, which occured during processing of a request. (Trying to adhere to RFC 7807)
 type ProblemDetails struct {
 	// Human-readable explanation specific to this occurrence of the problem
@@ -16,6 +95,9 @@ type ProblemDetails struct {
 	// A URI reference that identifies the specific occurrence of the problem
 	Instance string `json:"instance"`
 
+	// Submitted fields, which are invalid
+	InvalidParams *[]InvalidParam `json:"invalid_params,omitempty"`
+
 	// A http status code describing a problem
 	StatusCode int `json:"status_code"`
 
@@ -23,21 +105,142 @@ type ProblemDetails struct {
 	Title string `json:"title"`
 }
 
+// HealthResponse defines model for HealthResponse.
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// IntrospectionResponse defines model for IntrospectionResponse.
+type IntrospectionResponse struct {
+	// Whether the token is valid and not revoked
+	Active bool `json:"active"`
+
+	// Whether the owner of the token passed 2FA
+	Authenticated *bool `json:"authenticated,omitempty"`
+
+	// Expiration time of the token as a unix timestamp
+	Exp *int64 `json:"exp,omitempty"`
+
+	// Issue time of the token as a unix timestamp
+	Iat *int64 `json:"iat,omitempty"`
+
+	// Space separated scopes of the token
+	Scope *string `json:"scope,omitempty"`
+
+	// UUID of the owner of the token
+	Sub *string `json:"sub,omitempty"`
+
+	// Username of the owner of the token
+	Username *string `json:"username,omitempty"`
+}
+
+// JWKSResponse defines model for JWKSResponse.
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
 // LoginResponse defines model for LoginResponse.
 type LoginResponse struct {
 	// An unauthenticated JWT access token needed in 2FA.
 	UnauthToken string `json:"unauth_token"`
 }
 
+// ReadinessResponse defines model for ReadinessResponse.
+type ReadinessResponse struct {
+	// Results of checks by their names
+	Checks map[string]HealthCheck `json:"checks"`
+
+	// Either ok or unavailable
+	Status string `json:"status"`
+}
+
+// RecoverResponse defines model for RecoverResponse.
+type RecoverResponse struct {
+	// An full access JWT.
+	AccessToken string `json:"access_token"`
+
+	// Number of recovery codes, which remain unused
+	RecoveryCodesRemaining int `json:"recovery_codes_remaining"`
+
+	// A single use token for getting a new access JWT.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RecoveryCodesResponse defines model for RecoveryCodesResponse.
+type RecoveryCodesResponse struct {
+	// Single use recovery codes, they are never shown again.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RecoveryCodesStatusResponse defines model for RecoveryCodesStatusResponse.
+type RecoveryCodesStatusResponse struct {
+	// Number of recovery codes, which remain unused
+	Remaining int `json:"remaining"`
+}
+
 // Secret2FAResponse defines model for Secret2FAResponse.
 type Secret2FAResponse struct {
 	QrURI *string `json:"qrURI,omitempty"`
 }
 
+// StatsResponse defines model for StatsResponse.
+type StatsResponse struct {
+	// Statistics of a database connection pool.
+	Database *DatabaseStats `json:"database,omitempty"`
+}
+
+// TokenResponse defines model for TokenResponse.
+type TokenResponse struct {
+	// An full access JWT.
+	AccessToken string `json:"access_token"`
+
+	// A single use token replacing the submitted one.
+	RefreshToken string `json:"refresh_token"`
+}
+
 // VerifyResponse defines model for VerifyResponse.
 type VerifyResponse struct {
 	// An full access JWT.
 	AccessToken string `json:"access_token"`
+
+	// Single use recovery codes, present only when 2FA was enabled by this verification. They are never shown again.
+	RecoveryCodes *[]string `json:"recovery_codes,omitempty"`
+
+	// A single use token for getting a new access JWT.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ChangePasswordRequest defines model for ChangePasswordRequest.
+type ChangePasswordRequest struct {
+	// Current password of the user account
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+
+	// New password of the user account, it must satisfy the password policy configured on the server
+	NewPassword string `json:"newPassword" validate:"required"`
+
+	// OTP for 2FA, required if the user has 2FA enabled
+	Otp *int `json:"otp,omitempty"`
+}
+
+// EmailVerificationRequest defines model for EmailVerificationRequest.
+type EmailVerificationRequest struct {
+	// A verification token sent to the email address
+	Token string `json:"token" validate:"required"`
+}
+
+// ForgotPasswordRequest defines model for ForgotPasswordRequest.
+type ForgotPasswordRequest struct {
+	// Email address of an user account
+	Email string `json:"email" validate:"required"`
+}
+
+// IntrospectionRequest defines model for IntrospectionRequest.
+type IntrospectionRequest struct {
+	// The token to introspect
+	Token string `json:"token"`
+
+	// A hint about the type of the token
+	TokenTypeHint *string `json:"token_type_hint,omitempty"`
 }
 
 // LoginRequest defines model for LoginRequest.
@@ -49,12 +252,39 @@ type LoginRequest struct {
 	Username string `json:"username" validate:"required"`
 }
 
+// Recover2FARequest defines model for Recover2FARequest.
+type Recover2FARequest struct {
+	// An unused recovery code, case, dashes and white space are ignored
+	RecoveryCode string `json:"recoveryCode" validate:"required"`
+}
+
+// RefreshTokenRequest defines model for RefreshTokenRequest.
+type RefreshTokenRequest struct {
+	// A refresh token issued after 2FA or by a previous refresh
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// RegenerateRecoveryCodesRequest defines model for RegenerateRecoveryCodesRequest.
+type RegenerateRecoveryCodesRequest struct {
+	// OTP for 2FA
+	Otp int `json:"otp" validate:"required"`
+}
+
+// ResetPasswordRequest defines model for ResetPasswordRequest.
+type ResetPasswordRequest struct {
+	// New password of the user account, it must satisfy the password policy configured on the server
+	Password string `json:"password" validate:"required"`
+
+	// A password reset token sent to the email address
+	Token string `json:"token" validate:"required"`
+}
+
 // SignupRequest defines model for SignupRequest.
 type SignupRequest struct {
 	// Email address of a new user account
 	Email string `json:"email" validate:"required"`
 
-	// Password for getting access to the new user account
+	// Password for getting access to the new user account, it must satisfy the password policy configured on the server
 	Password string `json:"password" validate:"required"`
 
 	// Username with which new user account will be identified in the system
@@ -67,12 +297,39 @@ type Verify2FARequest struct {
 	Otp int `json:"otp" validate:"required"`
 }
 
+// Recover2FAJSONBody defines parameters for Recover2FA.
+type Recover2FAJSONBody struct {
+	// An unused recovery code, case, dashes and white space are ignored
+	RecoveryCode string `json:"recoveryCode" validate:"required"`
+}
+
+// RegenerateRecoveryCodesJSONBody defines parameters for RegenerateRecoveryCodes.
+type RegenerateRecoveryCodesJSONBody struct {
+	// OTP for 2FA
+	Otp int `json:"otp" validate:"required"`
+}
+
 // Verify2FAJSONBody defines parameters for Verify2FA.
 type Verify2FAJSONBody struct {
 	// OTP for 2FA
 	Otp int `json:"otp" validate:"required"`
 }
 
+// VerifyEmailJSONBody defines parameters for VerifyEmail.
+type VerifyEmailJSONBody struct {
+	// A verification token sent to the email address
+	Token string `json:"token" validate:"required"`
+}
+
+// IntrospectFormdataBody defines parameters for Introspect.
+type IntrospectFormdataBody struct {
+	// The token to introspect
+	Token string `json:"token"`
+
+	// A hint about the type of the token
+	TokenTypeHint *string `json:"token_type_hint,omitempty"`
+}
+
 // LoginJSONBody defines parameters for Login.
 type LoginJSONBody struct {
 	// Password of an user account
@@ -82,23 +339,80 @@ type LoginJSONBody struct {
 	Username string `json:"username" validate:"required"`
 }
 
+// ChangePasswordJSONBody defines parameters for ChangePassword.
+type ChangePasswordJSONBody struct {
+	// Current password of the user account
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+
+	// New password of the user account, it must satisfy the password policy configured on the server
+	NewPassword string `json:"newPassword" validate:"required"`
+
+	// OTP for 2FA, required if the user has 2FA enabled
+	Otp *int `json:"otp,omitempty"`
+}
+
+// ForgotPasswordJSONBody defines parameters for ForgotPassword.
+type ForgotPasswordJSONBody struct {
+	// Email address of an user account
+	Email string `json:"email" validate:"required"`
+}
+
+// ResetPasswordJSONBody defines parameters for ResetPassword.
+type ResetPasswordJSONBody struct {
+	// New password of the user account, it must satisfy the password policy configured on the server
+	Password string `json:"password" validate:"required"`
+
+	// A password reset token sent to the email address
+	Token string `json:"token" validate:"required"`
+}
+
 // SignupJSONBody defines parameters for Signup.
 type SignupJSONBody struct {
 	// Email address of a new user account
 	Email string `json:"email" validate:"required"`
 
-	// Password for getting access to the new user account
+	// Password for getting access to the new user account, it must satisfy the password policy configured on the server
 	Password string `json:"password" validate:"required"`
 
 	// Username with which new user account will be identified in the system
 	Username string `json:"username" validate:"required"`
 }
 
+// RefreshTokenJSONBody defines parameters for RefreshToken.
+type RefreshTokenJSONBody struct {
+	// A refresh token issued after 2FA or by a previous refresh
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// Recover2FAJSONRequestBody defines body for Recover2FA for application/json ContentType.
+type Recover2FAJSONRequestBody Recover2FAJSONBody
+
+// RegenerateRecoveryCodesJSONRequestBody defines body for RegenerateRecoveryCodes for application/json ContentType.
+type RegenerateRecoveryCodesJSONRequestBody RegenerateRecoveryCodesJSONBody
+
 // Verify2FAJSONRequestBody defines body for Verify2FA for application/json ContentType.
 type Verify2FAJSONRequestBody Verify2FAJSONBody
 
+// VerifyEmailJSONRequestBody defines body for VerifyEmail for application/json ContentType.
+type VerifyEmailJSONRequestBody VerifyEmailJSONBody
+
+// IntrospectFormdataRequestBody defines body for Introspect for application/x-www-form-urlencoded ContentType.
+type IntrospectFormdataRequestBody IntrospectFormdataBody
+
 // LoginJSONRequestBody defines body for Login for application/json ContentType.
 type LoginJSONRequestBody LoginJSONBody
 
+// ChangePasswordJSONRequestBody defines body for ChangePassword for application/json ContentType.
+type ChangePasswordJSONRequestBody ChangePasswordJSONBody
+
+// ForgotPasswordJSONRequestBody defines body for ForgotPassword for application/json ContentType.
+type ForgotPasswordJSONRequestBody ForgotPasswordJSONBody
+
+// ResetPasswordJSONRequestBody defines body for ResetPassword for application/json ContentType.
+type ResetPasswordJSONRequestBody ResetPasswordJSONBody
+
 // SignupJSONRequestBody defines body for Signup for application/json ContentType.
 type SignupJSONRequestBody SignupJSONBody
+
+// RefreshTokenJSONRequestBody defines body for RefreshToken for application/json ContentType.
+type RefreshTokenJSONRequestBody RefreshTokenJSONBody
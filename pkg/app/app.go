@@ -2,50 +2,346 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
 	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/mail"
 	"github.com/Nesquiko/go-auth/pkg/middleware"
+	"github.com/Nesquiko/go-auth/pkg/security"
 	"github.com/Nesquiko/go-auth/pkg/server"
 	chiMiddleware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 )
 
-// StartServer starts the whole Go-Auth application. Firstly if tries to connect
-// to a MySQL database, if it fails, the app won't start. Then creates new
-// router and configures it with middleware and handler. The application listens
-// on port 8080.
-func StartServer() {
+// App is the whole Go-Auth application, with a connection to the database,
+// loaded signing keys and an HTTP server. It can be embedded into other
+// binaries and integration tests.
+type App struct {
+	cfg    *config.Config
+	server *http.Server
+	// store is the connection to the database, closed with the app.
+	store db.DBConnection
+	// stops are functions stopping background goroutines of the app.
+	stops []func()
+}
+
+// New creates the Go-Auth application configured by the cfg. Firstly it tries
+// to connect to a MySQL, PostgreSQL or SQLite database, or creates a memory
+// one, and applies pending schema migrations, if enabled. Then loads JWT
+// signing keys, the password denylist, breached passwords and a TLS
+// certificate, if configured, creates new router and configures it with
+// middleware and handler, which are given the database, the token issuer and
+// the mailer. If anything fails, resources acquired so far are released and
+// the error is returned.
+func New(cfg *config.Config) (*App, error) {
 	fmt.Print("Connecting to Database...")
-	err := db.ConnectDB(
-		"mysql",
-		db.MySQLDSNConfig("root", "goAuthDB", "127.0.0.1:3306", "users").FormatDSN(),
-	)
+	store, err := db.Connect(cfg.Database.Driver, dsn(cfg.Database), dbOptions(cfg.Database))
 	if err != nil {
 		fmt.Print(" - \x1b[31;1mFAILED\x1b[0m\n")
-		panic(err)
+		return nil, fmt.Errorf("connecting to database: %w", err)
 	}
 	fmt.Print(" - \x1b[32;1mSUCCESS\x1b[0m\n")
 
-	fmt.Println("Starting server...")
-	port := "8080"
+	if err := autoMigrate(store, cfg.Database); err != nil {
+		db.Close(store)
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+
+	tokens := &security.JWTIssuer{
+		Revocations: security.NewMemoryRevocationStore(),
+		Lifetimes:   cfg.Tokens.Lifetimes(),
+		Issuer:      cfg.Tokens.Issuer,
+		Audience:    cfg.Tokens.Audience,
+		Clock:       security.SystemClock{},
+	}
+	if cfg.Tokens.RevocationStore == "database" {
+		tokens.Revocations = db.NewRevocationStore(store)
+	}
+
+	clients, err := security.ParseClients(cfg.Introspection.Clients)
+	if err != nil {
+		db.Close(store)
+		return nil, err
+	}
+
+	policy, err := server.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		db.Close(store)
+		return nil, fmt.Errorf("loading password policy: %w", err)
+	}
+
+	breaches, err := server.NewBreachChecker(cfg.Password)
+	if err != nil {
+		db.Close(store)
+		return nil, fmt.Errorf("loading breached passwords: %w", err)
+	}
+
+	fmt.Print("Loading signing keys...")
+	tokens.Keys, err = loadKeys(cfg.Keys, security.KeyRetention(tokens.Lifetimes))
+	if err != nil {
+		fmt.Print(" - \x1b[31;1mFAILED\x1b[0m\n")
+		db.Close(store)
+		return nil, fmt.Errorf("loading signing keys: %w", err)
+	}
+	fmt.Print(" - \x1b[32;1mSUCCESS\x1b[0m\n")
+
+	stopRotation := func() {}
+	if cfg.Keys.Dir != "" || cfg.Keys.Rotation != 0 {
+		stopRotation = tokens.Keys.StartRotation(cfg.Keys.Rotation)
+	}
+
+	var tlsConfig *tls.Config
+	var checks []server.ReadinessCheck
+	stopCertReload := func() {}
+	if cfg.TLS.Enabled() {
+		fmt.Print("Loading TLS certificate...")
+		var certs *security.CertReloader
+		tlsConfig, certs, err = loadTLS(cfg.TLS)
+		if err != nil {
+			fmt.Print(" - \x1b[31;1mFAILED\x1b[0m\n")
+			stopRotation()
+			db.Close(store)
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		fmt.Print(" - \x1b[32;1mSUCCESS\x1b[0m\n")
+
+		stopCertReload = certs.StartReloading(cfg.TLS.ReloadInterval)
+		checks = append(checks, server.ReadinessCheck{
+			Name:  "tls_certificate",
+			Check: func(context.Context) error { return certs.Check() },
+		})
+	}
+
+	mailer, closeMailer, err := newMailer(cfg.Email)
+	if err != nil {
+		stopCertReload()
+		stopRotation()
+		db.Close(store)
+		return nil, fmt.Errorf("creating mailer: %w", err)
+	}
 
 	r := chi.NewRouter()
 	middlewares := []api.MiddlewareFunc{
 		chiMiddleware.Logger,
 		middleware.ContentTypeFilter,
+		middleware.BearerAuth(tokens),
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		middlewares = append(middlewares, middleware.RequireClientCert(cfg.TLS.ClientCertPaths...))
 	}
 
-	var server server.GoAuthServer
 	servOpts := api.ChiServerOptions{
 		BaseRouter:  r,
 		Middlewares: middlewares,
 	}
 
-	h := api.HandlerWithOptions(server, servOpts)
+	deps := server.Dependencies{
+		Store:    store,
+		Tokens:   tokens,
+		Clock:    tokens.Clock,
+		Hasher:   server.NewPasswordHasher(cfg.Password),
+		Policy:   policy,
+		Breaches: breaches,
+		Clients:  clients,
+		Mailer:   mailer,
+	}
+	srv, err := server.NewGoAuthServer(cfg, deps, checks...)
+	if err != nil {
+		closeMailer()
+		stopCertReload()
+		stopRotation()
+		db.Close(store)
+		return nil, fmt.Errorf("creating server: %w", err)
+	}
+	h := api.HandlerWithOptions(srv, servOpts)
+
+	return &App{
+		cfg: cfg,
+		server: &http.Server{
+			Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+			Handler:           h,
+			TLSConfig:         tlsConfig,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		},
+		store: store,
+		// background emails are sent before the mailer is closed
+		stops: []func(){srv.Wait, stopRotation, stopCertReload, closeMailer},
+	}, nil
+}
+
+// Run listens on the configured port and serves requests until the ctx is
+// done. See Serve for details.
+func (a *App) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		a.close()
+		return err
+	}
+
+	return a.Serve(ctx, ln)
+}
+
+// Serve serves requests on the listener until the ctx is done. Then it stops
+// accepting new connections and waits for in-flight requests for at most the
+// configured shutdown timeout, after which remaining connections are closed.
+// Before returning, background goroutines are stopped and the connection to the
+// database is closed. An error is returned if the server failed, or didn't
+// shut down cleanly.
+func (a *App) Serve(ctx context.Context, ln net.Listener) error {
+	defer a.close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Printf("Listening on %s...\n", ln.Addr())
+		if a.server.TLSConfig != nil {
+			errCh <- a.server.ServeTLS(ln, "", "")
+		} else {
+			errCh <- a.server.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := a.server.Shutdown(shutdownCtx); err != nil {
+		a.server.Close()
+		return fmt.Errorf("shutting down server: %w", err)
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// close stops background goroutines and closes the connection to the
+// database.
+func (a *App) close() {
+	for _, stop := range a.stops {
+		stop()
+	}
+	if err := db.Close(a.store); err != nil {
+		fmt.Printf("Closing database connection failed: %s\n", err)
+	}
+}
+
+// dbOptions returns options of the connection to the configured database.
+func dbOptions(cfg config.Database) db.Options {
+	return db.Options{
+		Pool: db.Pool{
+			MaxOpenConns:    cfg.MaxOpenConns,
+			MaxIdleConns:    cfg.MaxIdleConns,
+			ConnMaxLifetime: cfg.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.ConnMaxIdleTime,
+		},
+		ConnectAttempts: cfg.ConnectAttempts,
+		ConnectBackoff:  cfg.ConnectBackoff,
+		QueryTimeout:    cfg.QueryTimeout,
+	}
+}
+
+// dsn returns a data source name of the configured database for its driver.
+func dsn(cfg config.Database) string {
+	switch cfg.Driver {
+	case "postgres":
+		return db.PostgresDSN(cfg.User, cfg.Password, cfg.Address, cfg.Name)
+	case "sqlite":
+		return db.SQLiteDSN(cfg.Name)
+	}
+	return db.MySQLDSNConfig(cfg.User, cfg.Password, cfg.Address, cfg.Name).FormatDSN()
+}
+
+// newMailer creates the configured mailer and a function releasing its
+// resources, which closes the file of the file mailer.
+func newMailer(cfg config.Email) (mail.Mailer, func(), error) {
+	switch cfg.Mailer {
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mail.NewFileMailer(cfg.From, f), func() { f.Close() }, nil
+	case "smtp":
+		return &mail.SMTPMailer{
+			Addr:     cfg.SMTPAddress,
+			From:     cfg.From,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}, func() {}, nil
+	}
+	return mail.NewFileMailer(cfg.From, os.Stdout), func() {}, nil
+}
+
+// loadKeys loads configured signing keys, which are accepted for the
+// retention after their rotation. If no keys are configured, a random key is
+// generated, which means tokens don't survive a restart.
+func loadKeys(cfg config.Keys, retention time.Duration) (*security.KeyStore, error) {
+	if cfg.Dir != "" || cfg.PEM != "" || cfg.Algorithm != security.DefaultAlgorithm {
+		return security.LoadKeyStore(cfg.Dir, cfg.PEM, cfg.Algorithm, retention)
+	}
+
+	keys := security.NewKeyStore("", cfg.Algorithm, retention)
+	if _, err := keys.Rotate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// loadTLS creates a TLS configuration with a certificate from the returned
+// CertReloader, which should be started to reload the certificate when its
+// files change. If a client CA is configured, client certificates
+// are verified against it, and they are required by the RequireClientCert
+// middleware for configured paths.
+func loadTLS(cfg config.TLS) (tlsConfig *tls.Config, certs *security.CertReloader, err error) {
+	minVersion, err := cfg.Version()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cipherSuites, err := cfg.CipherSuiteIDs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certs, err = security.NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig = &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if cfg.ClientCAFile != "" {
+		tlsConfig.ClientCAs, err = security.LoadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
 
-	fmt.Printf("Listening on port %s...\n", port)
-	http.ListenAndServe(":"+port, h)
+	return tlsConfig, certs, nil
 }
@@ -0,0 +1,344 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// startApp creates an App with a memory database and serves it on a random
+// port. Returns the address of the app, a function cancelling its context and
+// a channel with the result of Serve.
+func startApp(t *testing.T, cfg *config.Config) (addr string, cancel func(), done <-chan error) {
+	t.Helper()
+	cfg.Database.Driver = "memory"
+
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- a.Serve(ctx, ln) }()
+
+	return "http://" + ln.Addr().String(), cancel, errCh
+}
+
+// stopApp cancels the context of an app started by startApp and waits until
+// it shuts down.
+func stopApp(cancel func(), done <-chan error) {
+	cancel()
+	<-done
+}
+
+func TestServeShutdown(t *testing.T) {
+	addr, cancel, done := startApp(t, config.Default())
+
+	res, err := http.Get(addr + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusOK, res.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("err was not nil, %q", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server didn't shut down")
+	}
+
+	if _, err := http.Get(addr + "/.well-known/jwks.json"); err == nil {
+		t.Error("Server should not accept requests after shutdown")
+	}
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	addr, cancel, done := startApp(t, config.Default())
+
+	body, writer := io.Pipe()
+	req, _ := http.NewRequest("POST", addr+"/signup", body)
+	req.Header.Add(consts.ContentType, consts.ApplicationJSON)
+
+	resCh := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("In-flight request failed, %q", err.Error())
+		}
+		resCh <- res
+	}()
+
+	// the request is in-flight until the whole body is written
+	writer.Write([]byte(`{"username": `))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case <-done:
+		t.Fatal("Server shut down before the in-flight request was finished")
+	default:
+	}
+
+	writer.Write([]byte(`"Joe"}`))
+	writer.Close()
+
+	if res := <-resCh; res != nil {
+		res.Body.Close()
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("err was not nil, %q", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server didn't shut down")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.ShutdownTimeout = 100 * time.Millisecond
+	addr, cancel, done := startApp(t, cfg)
+
+	body, writer := io.Pipe()
+	defer writer.Close()
+	req, _ := http.NewRequest("POST", addr+"/signup", body)
+	req.Header.Add(consts.ContentType, consts.ApplicationJSON)
+	go http.DefaultClient.Do(req)
+
+	writer.Write([]byte(`{"username": `))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected error when in-flight requests didn't finish in time")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server didn't shut down")
+	}
+}
+
+func TestNewInvalidKeys(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Driver = "memory"
+	cfg.Keys.PEM = "invalid"
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error with invalid signing keys")
+	}
+}
+
+func TestNewSQLite(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Name = filepath.Join(t.TempDir(), "users.db")
+
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if err := a.store.Ping(context.Background()); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	}
+	if _, err := os.Stat(cfg.Database.Name); err != nil {
+		t.Errorf("Expected database file to be created, %q", err.Error())
+	}
+
+	a.close()
+	if err := a.store.Ping(context.Background()); err == nil {
+		t.Error("Database connection should be closed with the app")
+	}
+}
+
+func TestNewFileMailer(t *testing.T) {
+	cfg := config.Default()
+	cfg.Email.Mailer = "file"
+	cfg.Email.File = filepath.Join(t.TempDir(), "mails.txt")
+	addr, cancel, done := startApp(t, cfg)
+
+	body := `{"username":"Mailed","email":"mailed@barz.com","password":"S3cret-pass"}`
+	res, err := http.Post(addr+"/signup", consts.ApplicationJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	res.Body.Close()
+	stopApp(cancel, done)
+
+	mails, err := os.ReadFile(cfg.Email.File)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if !strings.Contains(string(mails), "To: mailed@barz.com\r\n") {
+		t.Errorf("Expected verification email in the file, but was %q", mails)
+	}
+}
+
+func TestNewInvalidMailerFile(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Driver = "memory"
+	cfg.Email.Mailer = "file"
+	cfg.Email.File = filepath.Join(t.TempDir(), "missing", "mails.txt")
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error when the mail file can't be opened")
+	}
+}
+
+func TestNewMissingDenylist(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Driver = "memory"
+	cfg.Password.DenylistFile = filepath.Join(t.TempDir(), "denylist.txt")
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error when the password denylist can't be read")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	flags := []string{"-db-driver", "sqlite", "-db-name", filepath.Join(t.TempDir(), "users.db")}
+
+	for _, action := range []string{"status", "down", "up", "status"} {
+		if err := Migrate(append([]string{action}, flags...)); err != nil {
+			t.Errorf("%s, err was not nil, %q", action, err.Error())
+		}
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "NoAction", args: nil},
+		{name: "UnknownAction", args: []string{"sideways"}},
+		{name: "Memory", args: []string{"up", "-db-driver", "memory"}},
+		{name: "BaselineMigrated", args: []string{"baseline", "-db-driver", "sqlite", "-db-name", filepath.Join(t.TempDir(), "users.db")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Migrate(tt.args); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestGenerateKeyUsesConfiguredLifetimes(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "goauth.yaml")
+	os.WriteFile(cfgPath, []byte("tokens:\n  email_verification_lifetime: 1000h\n"), 0600)
+	keyDir := filepath.Join(dir, "keys")
+
+	for i := 0; i < 2; i++ {
+		if err := GenerateKey([]string{"-config", cfgPath, "-dir", keyDir}); err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+	}
+
+	ks, err := security.LoadKeyStore(keyDir, "", security.DefaultAlgorithm, 0)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	primary, _ := ks.Primary()
+
+	files, _ := filepath.Glob(filepath.Join(keyDir, "*.pem"))
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		keys, err := security.ParseKeysPEM(data)
+		if err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+		if keys[0].ID == primary.ID {
+			continue
+		}
+
+		if keys[0].ExpiresAt.Before(time.Now().Add(999 * time.Hour)) {
+			t.Errorf("Expected retired key to be kept for the email verification lifetime, but expires at %s", keys[0].ExpiresAt)
+		}
+	}
+}
+
+func TestBuildBreachFilter(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "pwned.txt")
+	os.WriteFile(dump, []byte(
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n"+
+			"7C4A8D09CA3762AF61E59520943DC26494F8941B:37359195\n",
+	), 0600)
+
+	cfg := config.Default()
+	cfg.Database.Driver = "memory"
+	cfg.Password.BreachCheck = "bloom"
+	cfg.Password.BreachPath = filepath.Join(dir, "pwned.bloom")
+	if err := BuildBreachFilter([]string{"-in", dump, "-out", cfg.Password.BreachPath}); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	addr, cancel, done := startApp(t, cfg)
+	defer stopApp(cancel, done)
+
+	body := `{"username":"Pwned","email":"pwned@barz.com","password":"password"}`
+	res, err := http.Post(addr+"/signup", consts.ApplicationJSON, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusBadRequest || !strings.Contains(string(data), "has appeared in a data breach") {
+		t.Errorf("Expected breached password to be rejected, but was %d %s", res.StatusCode, data)
+	}
+}
+
+func TestBuildBreachFilterErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.txt")
+	os.WriteFile(invalid, []byte("not a hash\n"), 0600)
+	out := filepath.Join(dir, "pwned.bloom")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "NoFiles", args: nil},
+		{name: "MissingDump", args: []string{"-in", filepath.Join(dir, "missing.txt"), "-out", out}},
+		{name: "InvalidDump", args: []string{"-in", invalid, "-out", out}},
+		{name: "FalsePositiveRate", args: []string{"-in", invalid, "-out", out, "-fp", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := BuildBreachFilter(tt.args); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
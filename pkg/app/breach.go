@@ -0,0 +1,70 @@
+package app
+
+import (
+	"crypto/sha1"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// defaultFalsePositiveRate of Bloom filters built by BuildBreachFilter.
+const defaultFalsePositiveRate = 0.001
+
+// BuildBreachFilter is an admin command, which builds a Bloom filter of
+// breached passwords for the bloom breach check. It reads a raw Pwned
+// Passwords dump from -in, with one SHA-1 HASH:COUNT line for every hash, and
+// writes the filter to -out. The size of the filter is set by -fp, its false
+// positive rate. The dump is read twice, first to count its hashes.
+func BuildBreachFilter(args []string) error {
+	fs := flag.NewFlagSet("breach-filter", flag.ContinueOnError)
+	in := fs.String("in", "", "raw Pwned Passwords dump with SHA-1 HASH:COUNT lines")
+	out := fs.String("out", "", "file the Bloom filter is written to")
+	fpRate := fs.Float64("fp", defaultFalsePositiveRate, "false positive rate of the filter")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || *out == "" {
+		return errors.New("usage: breach-filter -in <dump> -out <filter> [-fp <rate>]")
+	}
+	if *fpRate <= 0 || *fpRate >= 1 {
+		return fmt.Errorf("false positive rate must be between 0 and 1, but was %g", *fpRate)
+	}
+
+	dump, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer dump.Close()
+
+	var n uint64
+	if err := security.ReadHashes(dump, func([sha1.Size]byte) { n++ }); err != nil {
+		return fmt.Errorf("reading %s: %w", *in, err)
+	}
+	if _, err := dump.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	filter := security.NewBloomFilter(n, *fpRate)
+	if err := security.ReadHashes(dump, filter.Add); err != nil {
+		return fmt.Errorf("reading %s: %w", *in, err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	size, err := filter.WriteTo(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Built Bloom filter of %d breached passwords, %d Bytes, in %s\n", n, size, *out)
+	return nil
+}
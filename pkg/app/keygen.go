@@ -0,0 +1,74 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// GenerateKey is an admin command, which generates new primary JWT signing key.
+// With -dir the key is written into a key directory, and the current primary
+// key in it is retired, so all instances sharing the directory switch to the
+// new key on their next reload. Without -dir the PEM encoded key is printed to
+// stdout, to be used in the GOAUTH_JWT_KEYS environment variable. The signing
+// algorithm of the key is set by -alg. Defaults of both, and the retention of
+// the retired key, are taken from the configuration, the same as by the server.
+func GenerateKey(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	path := fs.String("config", "", "path to a YAML or TOML configuration file")
+	dir := fs.String("dir", "", "directory with JWT signing keys, keys.dir of the configuration by default")
+	alg := fs.String("alg", "", "signing algorithm, one of HS256, RS256, ES256 and EdDSA, keys.algorithm of the configuration by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var configArgs []string
+	if *path != "" {
+		configArgs = []string{"-config", *path}
+	}
+	cfg, err := config.Load(configArgs, os.Getenv)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = cfg.Keys.Dir
+	}
+	if *alg == "" {
+		*alg = cfg.Keys.Algorithm
+	}
+
+	if *dir == "" {
+		key, err := security.GenerateSigningKey(*alg)
+		if err != nil {
+			return err
+		}
+
+		data, err := security.EncodeKeyPEM(key)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		return err
+	}
+
+	ks := security.NewKeyStore(*dir, *alg, security.KeyRetention(cfg.Tokens.Lifetimes()))
+	if err := ks.Reload(); err != nil {
+		return err
+	}
+
+	key, err := ks.Rotate()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated new signing key %s in %s\n", key.ID, *dir)
+	return nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/db"
+)
+
+// Migrate is an admin command, which manages the schema of the configured
+// database. The first arg is an action, "up" applies all pending migrations,
+// "down" reverts the last applied one, "status" lists all migrations and
+// "baseline" records migrations of the schema created by SQL/CreateTable.sql
+// before migrations as applied. The rest of args are configuration flags, the
+// same as of the server.
+func Migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status|baseline [flags]")
+	}
+	action := args[0]
+	if action != "up" && action != "down" && action != "status" && action != "baseline" {
+		return fmt.Errorf("unknown migrate action %q, expected up, down, status or baseline", action)
+	}
+
+	cfg, err := config.Load(args[1:], os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	store, err := db.Connect(cfg.Database.Driver, dsn(cfg.Database), dbOptions(cfg.Database))
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	defer db.Close(store)
+
+	m, err := db.NewMigrator(store)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return err
+	case "down":
+		reverted, err := m.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %04d_%s\n", reverted.Version, reverted.Name)
+	case "baseline":
+		baseline, err := m.Baseline(db.LegacySchemaVersion)
+		if err != nil {
+			return err
+		}
+		for _, migration := range baseline {
+			fmt.Printf("Recorded %04d_%s as applied\n", migration.Version, migration.Name)
+		}
+	default:
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.AppliedAt.IsZero() {
+				fmt.Printf("%04d_%s pending\n", s.Version, s.Name)
+			} else {
+				fmt.Printf("%04d_%s applied at %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			}
+		}
+	}
+
+	return nil
+}
+
+// autoMigrate applies pending migrations of the database behind the store, if
+// enabled by the cfg. The memory database has no schema and SQLite is always
+// migrated on connect, so they are skipped.
+func autoMigrate(store db.DBConnection, cfg config.Database) error {
+	if !cfg.AutoMigrate || cfg.Driver == "memory" || cfg.Driver == "sqlite" {
+		return nil
+	}
+
+	m, err := db.NewMigrator(store)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Up()
+	for _, migration := range applied {
+		fmt.Printf("Applied migration %04d_%s\n", migration.Version, migration.Name)
+	}
+	return err
+}
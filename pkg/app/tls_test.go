@@ -0,0 +1,238 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+)
+
+// testCA is a self-signed CA issuing certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	file string
+}
+
+// newTestCA generates a self-signed CA and writes its certificate into the
+// dir.
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Go-Auth Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	file := filepath.Join(dir, "ca.pem")
+	os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+
+	return &testCA{cert: cert, key: key, pool: pool, file: file}
+}
+
+// issue issues a certificate for the usage, valid for 127.0.0.1, and writes
+// it with its key into the dir with the name prefix.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+// tlsClient returns a client trusting the ca, which presents the certificate
+// from files, if they are set.
+func tlsClient(t *testing.T, ca *testCA, certFile, keyFile string) *http.Client {
+	t.Helper()
+
+	cfg := &tls.Config{RootCAs: ca.pool}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+}
+
+// introspect sends an introspection request with the client and returns the
+// status code and the title of problem details, if any.
+func introspect(t *testing.T, client *http.Client, addr string) (int, string) {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", addr+"/introspect", strings.NewReader("token=invalid"))
+	req.Header.Add(consts.ContentType, "application/x-www-form-urlencoded")
+	req.SetBasicAuth("gateway", "s3cret")
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	defer res.Body.Close()
+
+	var problem api.ProblemDetails
+	json.NewDecoder(res.Body).Decode(&problem)
+	return res.StatusCode, problem.Title
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	cfg := config.Default()
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = certFile, keyFile
+	addr, cancel, done := startApp(t, cfg)
+	defer stopApp(cancel, done)
+	addr = strings.Replace(addr, "http://", "https://", 1)
+
+	res, err := tlsClient(t, ca, "", "").Get(addr + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusOK, res.StatusCode)
+	}
+	if res.TLS == nil || res.TLS.Version < tls.VersionTLS12 {
+		t.Error("Expected response over TLS 1.2 or newer")
+	}
+
+	res, err = tlsClient(t, ca, "", "").Get(addr + "/readyz")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	defer res.Body.Close()
+
+	var readiness api.ReadinessResponse
+	json.NewDecoder(res.Body).Decode(&readiness)
+	if readiness.Checks["tls_certificate"].Status != "ok" {
+		t.Errorf("Expected TLS certificate check to pass, but was %+v", readiness.Checks)
+	}
+}
+
+func TestServeTLSMinVersion(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+
+	cfg := config.Default()
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = certFile, keyFile
+	cfg.TLS.MinVersion = "1.3"
+	addr, cancel, done := startApp(t, cfg)
+	defer stopApp(cancel, done)
+	addr = strings.Replace(addr, "http://", "https://", 1)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:    ca.pool,
+		MaxVersion: tls.VersionTLS12,
+	}}}
+	if _, err := client.Get(addr + "/.well-known/jwks.json"); err == nil {
+		t.Error("Expected TLS 1.2 handshake to fail with minimal version 1.3")
+	}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "gateway", x509.ExtKeyUsageClientAuth)
+
+	cfg := config.Default()
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = certFile, keyFile
+	cfg.TLS.ClientCAFile = ca.file
+	cfg.Introspection.Clients = "gateway:s3cret"
+	addr, cancel, done := startApp(t, cfg)
+	defer stopApp(cancel, done)
+	addr = strings.Replace(addr, "http://", "https://", 1)
+
+	code, title := introspect(t, tlsClient(t, ca, "", ""), addr)
+	if code != http.StatusUnauthorized || title != "Client certificate required" {
+		t.Errorf("Expected client certificate to be required, but was %d %q", code, title)
+	}
+
+	code, title = introspect(t, tlsClient(t, ca, clientCert, clientKey), addr)
+	if code != http.StatusOK {
+		t.Errorf("Expected status code to be %d, but was %d %q", http.StatusOK, code, title)
+	}
+
+	res, err := tlsClient(t, ca, "", "").Get(addr + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Unprotected route without client certificate, expected %d, but was %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestServeMutualTLSUntrustedClient(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	other := newTestCA(t, t.TempDir())
+	clientCert, clientKey := other.issue(t, dir, "gateway", x509.ExtKeyUsageClientAuth)
+
+	cfg := config.Default()
+	cfg.TLS.CertFile, cfg.TLS.KeyFile = certFile, keyFile
+	cfg.TLS.ClientCAFile = ca.file
+	addr, cancel, done := startApp(t, cfg)
+	defer stopApp(cancel, done)
+	addr = strings.Replace(addr, "http://", "https://", 1)
+
+	client := tlsClient(t, ca, clientCert, clientKey)
+	if _, err := client.Get(addr + "/.well-known/jwks.json"); err == nil {
+		t.Error("Expected handshake with untrusted client certificate to fail")
+	}
+}
@@ -0,0 +1,682 @@
+// Package config provides a configuration of the Go-Auth application. The
+// configuration is loaded from defaults, a YAML or TOML file, environment
+// variables and command line flags, each overriding the previous ones.
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Nesquiko/go-auth/pkg/security"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMaxBodySize is a default maximal size, in Bytes, of a JSON request
+// body.
+const DefaultMaxBodySize = 1024
+
+// configFileEnv is an environment variable with a path to a configuration
+// file, used when no -config flag is set.
+const configFileEnv = "GOAUTH_CONFIG"
+
+// Config is a configuration of the whole Go-Auth application.
+type Config struct {
+	Server        Server        `yaml:"server" toml:"server"`
+	TLS           TLS           `yaml:"tls" toml:"tls"`
+	Database      Database      `yaml:"database" toml:"database"`
+	Tokens        Tokens        `yaml:"tokens" toml:"tokens"`
+	Keys          Keys          `yaml:"keys" toml:"keys"`
+	Password      Password      `yaml:"password" toml:"password"`
+	TOTP          TOTP          `yaml:"totp" toml:"totp"`
+	Introspection Introspection `yaml:"introspection" toml:"introspection"`
+	Email         Email         `yaml:"email" toml:"email"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	// Port on which the application listens.
+	Port int `yaml:"port" toml:"port"`
+	// MaxBodySize is a maximal size, in Bytes, of a JSON request body.
+	MaxBodySize int64 `yaml:"max_body_size" toml:"max_body_size"`
+	// ReadTimeout is a maximal duration of reading a whole request.
+	ReadTimeout time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	// ReadHeaderTimeout is a maximal duration of reading request headers.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	// WriteTimeout is a maximal duration of writing a response.
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	// IdleTimeout is a maximal duration of waiting for the next request on
+	// a keep-alive connection.
+	IdleTimeout time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ShutdownTimeout is a maximal duration of waiting for in-flight requests
+	// on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// TLS configures serving over HTTPS. It is enabled when CertFile is set.
+type TLS struct {
+	// CertFile is a PEM encoded certificate, followed by intermediates.
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	// KeyFile is a PEM encoded private key of the certificate.
+	KeyFile string `yaml:"key_file" toml:"key_file"`
+	// ReloadInterval is how often the certificate files are checked for
+	// changes.
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+	// MinVersion is a minimal accepted TLS version, "1.2" or "1.3".
+	MinVersion string `yaml:"min_version" toml:"min_version"`
+	// CipherSuites are names of accepted TLS 1.2 cipher suites, empty means
+	// the secure defaults of Go.
+	CipherSuites []string `yaml:"cipher_suites" toml:"cipher_suites"`
+	// ClientCAFile are PEM encoded CA certificates, enables mutual TLS for
+	// ClientCertPaths, where clients must present a certificate signed by
+	// them.
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	// ClientCertPaths are paths of routes requiring a client certificate.
+	ClientCertPaths []string `yaml:"client_cert_paths" toml:"client_cert_paths"`
+}
+
+// Enabled reports whether TLS is configured.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Version returns the MinVersion as a tls package constant.
+func (t TLS) Version() (uint16, error) {
+	switch t.MinVersion {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported version %q, expected 1.2 or 1.3", t.MinVersion)
+}
+
+// CipherSuiteIDs returns IDs of the CipherSuites. Only suites considered
+// secure by the tls package are accepted.
+func (t TLS) CipherSuiteIDs() ([]uint16, error) {
+	if len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// cipherSuiteID returns an ID of a secure cipher suite with the name.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Database configures a connection to the database.
+type Database struct {
+	// Driver of the database, "mysql", "postgres", "sqlite" or "memory",
+	// which keeps data only in memory until exit.
+	Driver   string `yaml:"driver" toml:"driver"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	// Address of the database in host:port form, not used by SQLite.
+	Address string `yaml:"address" toml:"address"`
+	// Name of the database. For SQLite it is a path of the database file, or
+	// ":memory:" for a database lost on exit.
+	Name string `yaml:"name" toml:"name"`
+	// AutoMigrate applies pending schema migrations on startup. SQLite is
+	// always migrated.
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+	// QueryTimeout limits a duration of every query, 0 disables the limit.
+	QueryTimeout time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+	// MaxOpenConns limits open connections, 0 means no limit.
+	MaxOpenConns int `yaml:"max_open_conns" toml:"max_open_conns"`
+	// MaxIdleConns limits idle connections kept open, 0 keeps the default of
+	// database/sql, which is 2.
+	MaxIdleConns int `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	// ConnMaxLifetime closes connections open for longer, 0 never closes them.
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	// ConnMaxIdleTime closes connections idle for longer, 0 never closes them.
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	// ConnectAttempts is a number of attempts to reach the database on
+	// startup, so it can start later than the application.
+	ConnectAttempts int `yaml:"connect_attempts" toml:"connect_attempts"`
+	// ConnectBackoff is a delay after the first failed attempt to connect,
+	// doubled after every next one.
+	ConnectBackoff time.Duration `yaml:"connect_backoff" toml:"connect_backoff"`
+}
+
+// Tokens configures issued JWTs.
+type Tokens struct {
+	// Issuer is a value of the iss claim.
+	Issuer string `yaml:"issuer" toml:"issuer"`
+	// Audience is a value of the aud claim.
+	Audience string `yaml:"audience" toml:"audience"`
+	// MFAPendingLifetime is a lifetime of tokens issued after login.
+	MFAPendingLifetime time.Duration `yaml:"mfa_pending_lifetime" toml:"mfa_pending_lifetime"`
+	// AccessLifetime is a lifetime of tokens issued after 2FA.
+	AccessLifetime time.Duration `yaml:"access_lifetime" toml:"access_lifetime"`
+	// RefreshLifetime is a lifetime of refresh tokens.
+	RefreshLifetime time.Duration `yaml:"refresh_lifetime" toml:"refresh_lifetime"`
+	// EmailVerificationLifetime is a lifetime of tokens sent to verify an
+	// email address.
+	EmailVerificationLifetime time.Duration `yaml:"email_verification_lifetime" toml:"email_verification_lifetime"`
+	// PasswordResetLifetime is a lifetime of tokens sent to reset a password.
+	PasswordResetLifetime time.Duration `yaml:"password_reset_lifetime" toml:"password_reset_lifetime"`
+	// RevocationStore selects where revoked tokens are stored, either
+	// "database" or "memory".
+	RevocationStore string `yaml:"revocation_store" toml:"revocation_store"`
+}
+
+// Keys configures JWT signing keys.
+type Keys struct {
+	// Dir is a directory with PEM encoded keys, shared by all instances.
+	Dir string `yaml:"dir" toml:"dir"`
+	// PEM are PEM encoded keys, e.g. from a secret manager.
+	PEM string `yaml:"pem" toml:"pem"`
+	// Algorithm of newly generated keys.
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+	// Rotation is an interval of rotation of the primary key, zero disables
+	// it.
+	Rotation time.Duration `yaml:"rotation" toml:"rotation"`
+}
+
+// Password configures hashing of passwords and the policy new passwords must
+// satisfy. Hashes of other algorithms, or with weaker parameters, are
+// replaced on login.
+type Password struct {
+	// Algorithm hashing new passwords, "argon2id" or "bcrypt".
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+	// BcryptCost is a cost of Bcrypt.
+	BcryptCost int `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	// Argon2Memory is memory used by Argon2id, in KiB.
+	Argon2Memory int `yaml:"argon2_memory" toml:"argon2_memory"`
+	// Argon2Iterations is a number of iterations of Argon2id over the memory.
+	Argon2Iterations int `yaml:"argon2_iterations" toml:"argon2_iterations"`
+	// Argon2Parallelism is a number of threads used by Argon2id.
+	Argon2Parallelism int `yaml:"argon2_parallelism" toml:"argon2_parallelism"`
+	// MinLength and MaxLength limit a number of characters of passwords.
+	MinLength int `yaml:"min_length" toml:"min_length"`
+	MaxLength int `yaml:"max_length" toml:"max_length"`
+	// RequireUppercase, RequireLowercase, RequireDigit and RequireSymbol
+	// require at least one character of the class in passwords.
+	RequireUppercase bool `yaml:"require_uppercase" toml:"require_uppercase"`
+	RequireLowercase bool `yaml:"require_lowercase" toml:"require_lowercase"`
+	RequireDigit     bool `yaml:"require_digit" toml:"require_digit"`
+	RequireSymbol    bool `yaml:"require_symbol" toml:"require_symbol"`
+	// DenylistFile contains common passwords, which are rejected, one per
+	// line.
+	DenylistFile string `yaml:"denylist_file" toml:"denylist_file"`
+	// BreachCheck selects a check of passwords exposed in data breaches,
+	// "none", "range" with a directory of Pwned Passwords range files or
+	// "bloom" with a Bloom filter built by the breach-filter command.
+	BreachCheck string `yaml:"breach_check" toml:"breach_check"`
+	// BreachPath is the range directory or the Bloom filter file.
+	BreachPath string `yaml:"breach_path" toml:"breach_path"`
+}
+
+// TOTP configures verification of 2FA codes.
+type TOTP struct {
+	// Window is a number of codes around the current one which are accepted,
+	// to tolerate clock drift of user devices.
+	Window int `yaml:"window" toml:"window"`
+	// Issuer is a name of the application shown in authenticator apps.
+	Issuer string `yaml:"issuer" toml:"issuer"`
+}
+
+// Introspection configures the token introspection endpoint.
+type Introspection struct {
+	// Clients are comma separated "id:secret" credentials of clients allowed
+	// to introspect tokens.
+	Clients string `yaml:"clients" toml:"clients"`
+}
+
+// Email configures verification of email addresses and sending of emails.
+type Email struct {
+	// RequireVerified rejects login of users, who didn't verify their email
+	// address yet.
+	RequireVerified bool `yaml:"require_verified" toml:"require_verified"`
+	// VerificationURL is an absolute URL of a page, which verifies the email
+	// address with the token from its token query parameter. If empty, only
+	// the token is sent.
+	VerificationURL string `yaml:"verification_url" toml:"verification_url"`
+	// PasswordResetURL is an absolute URL of a page, which resets a password
+	// with the token from its token query parameter. If empty, only the token
+	// is sent.
+	PasswordResetURL string `yaml:"password_reset_url" toml:"password_reset_url"`
+	// Mailer selects how emails are sent, "log" prints them to the standard
+	// output, "file" appends them to the File and "smtp" sends them to the
+	// SMTPAddress.
+	Mailer string `yaml:"mailer" toml:"mailer"`
+	// From is an address of the sender of emails.
+	From string `yaml:"from" toml:"from"`
+	// File to which emails are appended by the file mailer.
+	File string `yaml:"file" toml:"file"`
+	// SMTPAddress of the mail server in host:port form.
+	SMTPAddress string `yaml:"smtp_address" toml:"smtp_address"`
+	// SMTPUsername and SMTPPassword authenticate to the mail server, if set.
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+}
+
+// Default returns a configuration used when nothing else is configured.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              8080,
+			MaxBodySize:       DefaultMaxBodySize,
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   15 * time.Second,
+		},
+		TLS: TLS{
+			ReloadInterval:  time.Minute,
+			MinVersion:      "1.2",
+			ClientCertPaths: []string{"/introspect", "/stats"},
+		},
+		Database: Database{
+			Driver:          "mysql",
+			User:            "root",
+			Password:        "goAuthDB",
+			Address:         "127.0.0.1:3306",
+			Name:            "users",
+			QueryTimeout:    5 * time.Second,
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectAttempts: 5,
+			ConnectBackoff:  time.Second,
+		},
+		Tokens: Tokens{
+			Issuer:                    "GoAuth",
+			Audience:                  "go-auth",
+			MFAPendingLifetime:        5 * time.Minute,
+			AccessLifetime:            15 * time.Minute,
+			RefreshLifetime:           30 * 24 * time.Hour,
+			EmailVerificationLifetime: 24 * time.Hour,
+			PasswordResetLifetime:     15 * time.Minute,
+			RevocationStore:           "database",
+		},
+		Keys: Keys{
+			Algorithm: security.DefaultAlgorithm,
+		},
+		Password: Password{
+			Algorithm:         "argon2id",
+			BcryptCost:        bcrypt.DefaultCost,
+			Argon2Memory:      security.DefaultArgon2Memory,
+			Argon2Iterations:  security.DefaultArgon2Iterations,
+			Argon2Parallelism: security.DefaultArgon2Parallelism,
+			MinLength:         security.DefaultMinPasswordLength,
+			MaxLength:         security.DefaultMaxPasswordLength,
+			RequireUppercase:  true,
+			RequireLowercase:  true,
+			RequireDigit:      true,
+			BreachCheck:       "none",
+		},
+		TOTP: TOTP{
+			Window: 3,
+			Issuer: "GoAuth",
+		},
+		Email: Email{
+			Mailer: "log",
+			From:   "go-auth@localhost",
+		},
+	}
+}
+
+// Load loads a configuration from the args, which are command line flags
+// without the program name, and from environment variables returned by
+// getenv. The configuration file is specified by the -config flag or the
+// GOAUTH_CONFIG environment variable. Values from the file override defaults,
+// environment variables override the file and flags override everything.
+// Every flag has an environment variable with GOAUTH_ prefix, e.g. -db-user
+// and GOAUTH_DB_USER. The loaded configuration is validated. If -help is set,
+// flag.ErrHelp is returned.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	flagCfg := Default()
+	fs := flagSet(flagCfg)
+	path := fs.String("config", getenv(configFileEnv), "path to a YAML or TOML configuration file")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := loadFile(*path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// flags are set after environment variables, so they take precedence
+	bound := flagSet(cfg)
+	var err error
+	bound.VisitAll(func(f *flag.Flag) {
+		env := EnvName(f.Name)
+		value := getenv(env)
+		if value == "" || err != nil {
+			return
+		}
+		if setErr := bound.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %w", env, setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			bound.Set(f.Name, f.Value.String())
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// EnvName returns a name of the environment variable of the flag.
+func EnvName(flagName string) string {
+	return "GOAUTH_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// flagSet returns a set of flags, which set fields of the cfg.
+func flagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("go-auth", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage of go-auth:")
+		fmt.Fprintln(fs.Output(), "Every flag can be also set by an environment variable, e.g. -db-user by GOAUTH_DB_USER.")
+		fs.PrintDefaults()
+	}
+
+	fs.IntVar(&cfg.Server.Port, "port", cfg.Server.Port, "port on which the application listens")
+	fs.Int64Var(&cfg.Server.MaxBodySize, "max-body-size", cfg.Server.MaxBodySize, "maximal size of a JSON request body in bytes")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "maximal duration of reading a request")
+	fs.DurationVar(&cfg.Server.ReadHeaderTimeout, "read-header-timeout", cfg.Server.ReadHeaderTimeout, "maximal duration of reading request headers")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "maximal duration of writing a response")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "maximal duration of an idle keep-alive connection")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "maximal duration of waiting for in-flight requests on shutdown")
+
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert-file", cfg.TLS.CertFile, "PEM encoded TLS certificate, enables HTTPS")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key-file", cfg.TLS.KeyFile, "PEM encoded private key of the TLS certificate")
+	fs.DurationVar(&cfg.TLS.ReloadInterval, "tls-reload-interval", cfg.TLS.ReloadInterval, "how often TLS certificate files are checked for changes")
+	fs.StringVar(&cfg.TLS.MinVersion, "tls-min-version", cfg.TLS.MinVersion, "minimal TLS version, 1.2 or 1.3")
+	fs.Var((*stringList)(&cfg.TLS.CipherSuites), "tls-cipher-suites", "comma separated TLS 1.2 cipher suites, empty for defaults")
+	fs.StringVar(&cfg.TLS.ClientCAFile, "tls-client-ca-file", cfg.TLS.ClientCAFile, "PEM encoded CA certificates of clients, enables mutual TLS")
+	fs.Var((*stringList)(&cfg.TLS.ClientCertPaths), "tls-client-cert-paths", "comma separated paths requiring a client certificate")
+
+	fs.StringVar(&cfg.Database.Driver, "db-driver", cfg.Database.Driver, "database driver, mysql, postgres, sqlite or memory")
+	fs.StringVar(&cfg.Database.User, "db-user", cfg.Database.User, "database user")
+	fs.StringVar(&cfg.Database.Password, "db-password", cfg.Database.Password, "database password")
+	fs.StringVar(&cfg.Database.Address, "db-address", cfg.Database.Address, "database address in host:port form")
+	fs.StringVar(&cfg.Database.Name, "db-name", cfg.Database.Name, "database name, or a file path for sqlite")
+	fs.BoolVar(&cfg.Database.AutoMigrate, "db-auto-migrate", cfg.Database.AutoMigrate, "apply pending schema migrations on startup")
+	fs.DurationVar(&cfg.Database.QueryTimeout, "db-query-timeout", cfg.Database.QueryTimeout, "maximal duration of a database query, 0 for no limit")
+	fs.IntVar(&cfg.Database.MaxOpenConns, "db-max-open-conns", cfg.Database.MaxOpenConns, "maximal number of open database connections, 0 for no limit")
+	fs.IntVar(&cfg.Database.MaxIdleConns, "db-max-idle-conns", cfg.Database.MaxIdleConns, "maximal number of idle database connections")
+	fs.DurationVar(&cfg.Database.ConnMaxLifetime, "db-conn-max-lifetime", cfg.Database.ConnMaxLifetime, "maximal lifetime of a database connection, 0 for no limit")
+	fs.DurationVar(&cfg.Database.ConnMaxIdleTime, "db-conn-max-idle-time", cfg.Database.ConnMaxIdleTime, "maximal idle time of a database connection, 0 for no limit")
+	fs.IntVar(&cfg.Database.ConnectAttempts, "db-connect-attempts", cfg.Database.ConnectAttempts, "number of attempts to reach the database on startup")
+	fs.DurationVar(&cfg.Database.ConnectBackoff, "db-connect-backoff", cfg.Database.ConnectBackoff, "delay after the first failed attempt to connect, doubled after every next one")
+
+	fs.StringVar(&cfg.Tokens.Issuer, "token-issuer", cfg.Tokens.Issuer, "iss claim of issued tokens")
+	fs.StringVar(&cfg.Tokens.Audience, "token-audience", cfg.Tokens.Audience, "aud claim of issued tokens")
+	fs.DurationVar(&cfg.Tokens.MFAPendingLifetime, "mfa-pending-lifetime", cfg.Tokens.MFAPendingLifetime, "lifetime of tokens issued after login")
+	fs.DurationVar(&cfg.Tokens.AccessLifetime, "access-lifetime", cfg.Tokens.AccessLifetime, "lifetime of tokens issued after 2FA")
+	fs.DurationVar(&cfg.Tokens.RefreshLifetime, "refresh-lifetime", cfg.Tokens.RefreshLifetime, "lifetime of refresh tokens")
+	fs.DurationVar(&cfg.Tokens.EmailVerificationLifetime, "email-verification-lifetime", cfg.Tokens.EmailVerificationLifetime, "lifetime of tokens sent to verify an email address")
+	fs.DurationVar(&cfg.Tokens.PasswordResetLifetime, "password-reset-lifetime", cfg.Tokens.PasswordResetLifetime, "lifetime of tokens sent to reset a password")
+	fs.StringVar(&cfg.Tokens.RevocationStore, "revocation-store", cfg.Tokens.RevocationStore, "store of revoked tokens, database or memory")
+
+	fs.StringVar(&cfg.Keys.Dir, "jwt-key-dir", cfg.Keys.Dir, "directory with PEM encoded signing keys")
+	fs.StringVar(&cfg.Keys.PEM, "jwt-keys", cfg.Keys.PEM, "PEM encoded signing keys")
+	fs.StringVar(&cfg.Keys.Algorithm, "jwt-alg", cfg.Keys.Algorithm, "algorithm of generated keys, one of HS256, RS256, ES256 and EdDSA")
+	fs.DurationVar(&cfg.Keys.Rotation, "jwt-key-rotation", cfg.Keys.Rotation, "interval of key rotation, 0 disables it")
+
+	fs.StringVar(&cfg.Password.Algorithm, "password-algorithm", cfg.Password.Algorithm, "algorithm hashing passwords, argon2id or bcrypt")
+	fs.IntVar(&cfg.Password.BcryptCost, "password-bcrypt-cost", cfg.Password.BcryptCost, "cost of Bcrypt")
+	fs.IntVar(&cfg.Password.Argon2Memory, "password-argon2-memory", cfg.Password.Argon2Memory, "memory used by Argon2id, in KiB")
+	fs.IntVar(&cfg.Password.Argon2Iterations, "password-argon2-iterations", cfg.Password.Argon2Iterations, "number of iterations of Argon2id")
+	fs.IntVar(&cfg.Password.Argon2Parallelism, "password-argon2-parallelism", cfg.Password.Argon2Parallelism, "number of threads used by Argon2id")
+	fs.IntVar(&cfg.Password.MinLength, "password-min-length", cfg.Password.MinLength, "minimal number of characters of passwords")
+	fs.IntVar(&cfg.Password.MaxLength, "password-max-length", cfg.Password.MaxLength, "maximal number of characters of passwords")
+	fs.BoolVar(&cfg.Password.RequireUppercase, "password-require-uppercase", cfg.Password.RequireUppercase, "require an uppercase letter in passwords")
+	fs.BoolVar(&cfg.Password.RequireLowercase, "password-require-lowercase", cfg.Password.RequireLowercase, "require a lowercase letter in passwords")
+	fs.BoolVar(&cfg.Password.RequireDigit, "password-require-digit", cfg.Password.RequireDigit, "require a digit in passwords")
+	fs.BoolVar(&cfg.Password.RequireSymbol, "password-require-symbol", cfg.Password.RequireSymbol, "require a symbol in passwords")
+	fs.StringVar(&cfg.Password.DenylistFile, "password-denylist-file", cfg.Password.DenylistFile, "file with rejected common passwords, one per line")
+	fs.StringVar(&cfg.Password.BreachCheck, "password-breach-check", cfg.Password.BreachCheck, "check of breached passwords, none, range or bloom")
+	fs.StringVar(&cfg.Password.BreachPath, "password-breach-path", cfg.Password.BreachPath, "directory of range files or file of a Bloom filter of breached passwords")
+
+	fs.IntVar(&cfg.TOTP.Window, "totp-window", cfg.TOTP.Window, "number of accepted TOTP codes around the current one")
+	fs.StringVar(&cfg.TOTP.Issuer, "totp-issuer", cfg.TOTP.Issuer, "name of the application shown in authenticator apps")
+
+	fs.StringVar(&cfg.Introspection.Clients, "introspection-clients", cfg.Introspection.Clients, "comma separated id:secret credentials of introspection clients")
+
+	fs.BoolVar(&cfg.Email.RequireVerified, "email-require-verified", cfg.Email.RequireVerified, "reject login of users with unverified email addresses")
+	fs.StringVar(&cfg.Email.VerificationURL, "email-verification-url", cfg.Email.VerificationURL, "URL of a page verifying email addresses with the token query parameter")
+	fs.StringVar(&cfg.Email.PasswordResetURL, "email-password-reset-url", cfg.Email.PasswordResetURL, "URL of a page resetting passwords with the token query parameter")
+	fs.StringVar(&cfg.Email.Mailer, "email-mailer", cfg.Email.Mailer, "how emails are sent, log, file or smtp")
+	fs.StringVar(&cfg.Email.From, "email-from", cfg.Email.From, "address of the sender of emails")
+	fs.StringVar(&cfg.Email.File, "email-file", cfg.Email.File, "file to which the file mailer appends emails")
+	fs.StringVar(&cfg.Email.SMTPAddress, "email-smtp-address", cfg.Email.SMTPAddress, "address of the SMTP server in host:port form")
+	fs.StringVar(&cfg.Email.SMTPUsername, "email-smtp-username", cfg.Email.SMTPUsername, "username of the SMTP server")
+	fs.StringVar(&cfg.Email.SMTPPassword, "email-smtp-password", cfg.Email.SMTPPassword, "password of the SMTP server")
+
+	return fs
+}
+
+// stringList is a flag.Value of comma separated strings.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// loadFile decodes a configuration file into the cfg. The format is chosen
+// by the extension of the file, .yaml, .yml or .toml. Unknown keys are
+// reported as errors, so typos don't go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parsing config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q, expected .yaml, .yml or .toml", ext)
+	}
+
+	return nil
+}
+
+// ValidationError is returned when a configuration is invalid, with all
+// problems found.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks that all values of the configuration are set and valid.
+// All problems are reported at once in a ValidationError.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, key, flagName, msg string) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s (-%s, %s): %s", key, flagName, EnvName(flagName), msg))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port", "port", "must be between 1 and 65535")
+	check(c.Server.MaxBodySize > 0, "server.max_body_size", "max-body-size", "must be positive")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout", "read-timeout", "must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout", "read-header-timeout", "must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout", "write-timeout", "must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout", "idle-timeout", "must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "shutdown-timeout", "must be positive")
+
+	check(c.TLS.CertFile == "" || c.TLS.KeyFile != "", "tls.key_file", "tls-key-file", "must be set with tls.cert_file")
+	check(c.TLS.KeyFile == "" || c.TLS.CertFile != "", "tls.cert_file", "tls-cert-file", "must be set with tls.key_file")
+	check(c.TLS.ClientCAFile == "" || c.TLS.Enabled(), "tls.client_ca_file", "tls-client-ca-file", "requires tls.cert_file")
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval", "tls-reload-interval", "must be positive")
+	if _, err := c.TLS.Version(); err != nil {
+		check(false, "tls.min_version", "tls-min-version", err.Error())
+	}
+	if _, err := c.TLS.CipherSuiteIDs(); err != nil {
+		check(false, "tls.cipher_suites", "tls-cipher-suites", err.Error())
+	}
+
+	switch c.Database.Driver {
+	case "mysql", "postgres":
+		check(c.Database.User != "", "database.user", "db-user", "must not be empty")
+		check(c.Database.Address != "", "database.address", "db-address", "must not be empty")
+		check(c.Database.Name != "", "database.name", "db-name", "must not be empty")
+	case "sqlite":
+		check(c.Database.Name != "", "database.name", "db-name", "must not be empty")
+	case "memory":
+	default:
+		check(false, "database.driver", "db-driver", fmt.Sprintf("unsupported driver %q, expected mysql, postgres, sqlite or memory", c.Database.Driver))
+	}
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout", "db-query-timeout", "must not be negative")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns", "db-max-open-conns", "must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns", "db-max-idle-conns", "must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "db-conn-max-lifetime", "must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "db-conn-max-idle-time", "must not be negative")
+	check(c.Database.ConnectAttempts > 0, "database.connect_attempts", "db-connect-attempts", "must be positive")
+	check(c.Database.ConnectBackoff >= 0, "database.connect_backoff", "db-connect-backoff", "must not be negative")
+
+	check(c.Tokens.Issuer != "", "tokens.issuer", "token-issuer", "must not be empty")
+	check(c.Tokens.Audience != "", "tokens.audience", "token-audience", "must not be empty")
+	check(c.Tokens.MFAPendingLifetime > 0, "tokens.mfa_pending_lifetime", "mfa-pending-lifetime", "must be positive")
+	check(c.Tokens.AccessLifetime > 0, "tokens.access_lifetime", "access-lifetime", "must be positive")
+	check(c.Tokens.RefreshLifetime > 0, "tokens.refresh_lifetime", "refresh-lifetime", "must be positive")
+	check(c.Tokens.EmailVerificationLifetime > 0, "tokens.email_verification_lifetime", "email-verification-lifetime", "must be positive")
+	check(c.Tokens.PasswordResetLifetime > 0, "tokens.password_reset_lifetime", "password-reset-lifetime", "must be positive")
+	check(c.Tokens.RevocationStore == "database" || c.Tokens.RevocationStore == "memory",
+		"tokens.revocation_store", "revocation-store", fmt.Sprintf("unknown store %q, expected database or memory", c.Tokens.RevocationStore))
+
+	switch c.Keys.Algorithm {
+	case security.HS256, security.RS256, security.ES256, security.EdDSA:
+	default:
+		check(false, "keys.algorithm", "jwt-alg", fmt.Sprintf("unsupported algorithm %q, expected HS256, RS256, ES256 or EdDSA", c.Keys.Algorithm))
+	}
+	check(c.Keys.Rotation >= 0, "keys.rotation", "jwt-key-rotation", "must not be negative")
+
+	check(c.Password.Algorithm == "argon2id" || c.Password.Algorithm == "bcrypt",
+		"password.algorithm", "password-algorithm", fmt.Sprintf("unknown algorithm %q, expected argon2id or bcrypt", c.Password.Algorithm))
+	check(c.Password.BcryptCost >= bcrypt.MinCost && c.Password.BcryptCost <= bcrypt.MaxCost,
+		"password.bcrypt_cost", "password-bcrypt-cost", fmt.Sprintf("must be from %d to %d", bcrypt.MinCost, bcrypt.MaxCost))
+	check(c.Password.Argon2Parallelism > 0 && c.Password.Argon2Parallelism <= math.MaxUint8,
+		"password.argon2_parallelism", "password-argon2-parallelism", fmt.Sprintf("must be from 1 to %d", math.MaxUint8))
+	check(c.Password.Argon2Memory >= 8*c.Password.Argon2Parallelism && int64(c.Password.Argon2Memory) <= math.MaxUint32,
+		"password.argon2_memory", "password-argon2-memory", "must be at least 8 KiB per thread")
+	check(c.Password.Argon2Iterations > 0 && int64(c.Password.Argon2Iterations) <= math.MaxUint32,
+		"password.argon2_iterations", "password-argon2-iterations", "must be positive")
+	check(c.Password.MinLength > 0, "password.min_length", "password-min-length", "must be positive")
+	check(c.Password.MaxLength >= c.Password.MinLength, "password.max_length", "password-max-length", "must not be less than the minimal length")
+	check(c.Password.BreachCheck == "none" || c.Password.BreachCheck == "range" || c.Password.BreachCheck == "bloom",
+		"password.breach_check", "password-breach-check", fmt.Sprintf("unknown check %q, expected none, range or bloom", c.Password.BreachCheck))
+	check(c.Password.BreachCheck == "none" || c.Password.BreachPath != "",
+		"password.breach_path", "password-breach-path", "must be set with a breach check")
+
+	check(c.TOTP.Window > 0, "totp.window", "totp-window", "must be positive")
+	check(c.TOTP.Issuer != "", "totp.issuer", "totp-issuer", "must not be empty")
+
+	if _, err := security.ParseClients(c.Introspection.Clients); err != nil {
+		check(false, "introspection.clients", "introspection-clients", err.Error())
+	}
+
+	check(isPageURL(c.Email.VerificationURL), "email.verification_url", "email-verification-url", "must be an absolute http or https URL")
+	check(isPageURL(c.Email.PasswordResetURL), "email.password_reset_url", "email-password-reset-url", "must be an absolute http or https URL")
+	switch c.Email.Mailer {
+	case "log":
+	case "file":
+		check(c.Email.File != "", "email.file", "email-file", "must be set for the file mailer")
+	case "smtp":
+		_, _, err := net.SplitHostPort(c.Email.SMTPAddress)
+		check(err == nil, "email.smtp_address", "email-smtp-address", "must be in host:port form for the smtp mailer")
+	default:
+		check(false, "email.mailer", "email-mailer", fmt.Sprintf("unknown mailer %q, expected log, file or smtp", c.Email.Mailer))
+	}
+	_, err := mail.ParseAddress(c.Email.From)
+	check(err == nil, "email.from", "email-from", "must be an email address")
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// isPageURL reports whether the s is empty or an absolute http or https URL,
+// to which a token query parameter can be added.
+func isPageURL(s string) bool {
+	if s == "" {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Lifetimes returns lifetimes of each token type.
+func (t Tokens) Lifetimes() map[security.TokenType]time.Duration {
+	return map[security.TokenType]time.Duration{
+		security.TokenMFAPending:        t.MFAPendingLifetime,
+		security.TokenAccess:            t.AccessLifetime,
+		security.TokenRefresh:           t.RefreshLifetime,
+		security.TokenEmailVerification: t.EmailVerificationLifetime,
+	}
+}
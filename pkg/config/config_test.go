@@ -0,0 +1,279 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv function reading from the vars.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// writeFile writes the content into a file with the name in a temporary
+// directory and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Expected default config %+v, but was %+v", Default(), cfg)
+	}
+}
+
+func TestLoadYAMLFile(t *testing.T) {
+	path := writeFile(t, "goauth.yaml", `
+server:
+  port: 9090
+database:
+  user: auth
+  address: db:3306
+tokens:
+  access_lifetime: 10m
+totp:
+  window: 1
+`)
+
+	cfg, err := Load([]string{"-config", path}, env(nil))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Expected port to be %d, but was %d", 9090, cfg.Server.Port)
+	}
+	if cfg.Database.User != "auth" || cfg.Database.Address != "db:3306" {
+		t.Errorf("Expected database auth@db:3306, but was %+v", cfg.Database)
+	}
+	if cfg.Tokens.AccessLifetime != 10*time.Minute {
+		t.Errorf("Expected access lifetime to be %s, but was %s", 10*time.Minute, cfg.Tokens.AccessLifetime)
+	}
+	if cfg.TOTP.Window != 1 {
+		t.Errorf("Expected TOTP window to be %d, but was %d", 1, cfg.TOTP.Window)
+	}
+	if cfg.Database.Name != Default().Database.Name {
+		t.Errorf("Expected unset value to be default %s, but was %s", Default().Database.Name, cfg.Database.Name)
+	}
+}
+
+func TestLoadTOMLFile(t *testing.T) {
+	path := writeFile(t, "goauth.toml", `
+[server]
+port = 9090
+
+[tokens]
+refresh_lifetime = "24h"
+
+[keys]
+algorithm = "ES256"
+`)
+
+	cfg, err := Load(nil, env(map[string]string{"GOAUTH_CONFIG": path}))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Expected port to be %d, but was %d", 9090, cfg.Server.Port)
+	}
+	if cfg.Tokens.RefreshLifetime != 24*time.Hour {
+		t.Errorf("Expected refresh lifetime to be %s, but was %s", 24*time.Hour, cfg.Tokens.RefreshLifetime)
+	}
+	if cfg.Keys.Algorithm != "ES256" {
+		t.Errorf("Expected algorithm to be %s, but was %s", "ES256", cfg.Keys.Algorithm)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "goauth.yaml", `
+server:
+  port: 9090
+database:
+  user: file
+  name: file
+`)
+	vars := map[string]string{
+		"GOAUTH_DB_USER": "env",
+		"GOAUTH_DB_NAME": "env",
+	}
+
+	cfg, err := Load([]string{"-config", path, "-db-name", "flag"}, env(vars))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Expected port from file %d, but was %d", 9090, cfg.Server.Port)
+	}
+	if cfg.Database.User != "env" {
+		t.Errorf("Expected user from env %s, but was %s", "env", cfg.Database.User)
+	}
+	if cfg.Database.Name != "flag" {
+		t.Errorf("Expected name from flag %s, but was %s", "flag", cfg.Database.Name)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	unknownKey := writeFile(t, "unknown.yaml", "server:\n  prot: 9090\n")
+	unknownTOMLKey := writeFile(t, "unknown.toml", "[server]\nprot = 9090\n")
+	unsupported := writeFile(t, "goauth.json", "{}")
+
+	testCases := []struct {
+		name    string
+		args    []string
+		vars    map[string]string
+		wantErr string
+	}{
+		{"MissingFile", []string{"-config", "missing.yaml"}, nil, "reading config file"},
+		{"UnknownKey", []string{"-config", unknownKey}, nil, "prot"},
+		{"UnknownTOMLKey", []string{"-config", unknownTOMLKey}, nil, "prot"},
+		{"UnsupportedFormat", []string{"-config", unsupported}, nil, "unsupported config file extension"},
+		{"InvalidEnv", nil, map[string]string{"GOAUTH_PORT": "http"}, "invalid GOAUTH_PORT"},
+		{"InvalidFlag", []string{"-access-lifetime", "forever"}, nil, "access-lifetime"},
+		{"UnknownFlag", []string{"-unknown"}, nil, "unknown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(tc.args, env(tc.vars))
+			if err == nil {
+				t.Fatal("Expected error, but was nil")
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, but was %q", tc.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadListFlag(t *testing.T) {
+	suites := "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	vars := map[string]string{"GOAUTH_TLS_CLIENT_CERT_PATHS": "/introspect,/admin"}
+
+	cfg, err := Load([]string{"-tls-cipher-suites", suites}, env(vars))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	wantSuites := []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	if !reflect.DeepEqual(cfg.TLS.CipherSuites, wantSuites) {
+		t.Errorf("Expected cipher suites %v, but was %v", wantSuites, cfg.TLS.CipherSuites)
+	}
+	wantPaths := []string{"/introspect", "/admin"}
+	if !reflect.DeepEqual(cfg.TLS.ClientCertPaths, wantPaths) {
+		t.Errorf("Expected client cert paths %v, but was %v", wantPaths, cfg.TLS.ClientCertPaths)
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	_, err := Load([]string{"-help"}, env(nil))
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp, but was %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"Port", func(c *Config) { c.Server.Port = 70000 }, "server.port (-port, GOAUTH_PORT)"},
+		{"MaxBodySize", func(c *Config) { c.Server.MaxBodySize = 0 }, "server.max_body_size"},
+		{"WriteTimeout", func(c *Config) { c.Server.WriteTimeout = 0 }, "server.write_timeout"},
+		{"ShutdownTimeout", func(c *Config) { c.Server.ShutdownTimeout = -time.Second }, "server.shutdown_timeout"},
+		{"TLSKeyFile", func(c *Config) { c.TLS.CertFile = "cert.pem" }, "tls.key_file"},
+		{"TLSClientCA", func(c *Config) { c.TLS.ClientCAFile = "ca.pem" }, "tls.client_ca_file"},
+		{"TLSMinVersion", func(c *Config) { c.TLS.MinVersion = "1.0" }, "tls.min_version"},
+		{"TLSCipherSuites", func(c *Config) { c.TLS.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }, "tls.cipher_suites"},
+		{"Driver", func(c *Config) { c.Database.Driver = "oracle" }, "database.driver"},
+		{"User", func(c *Config) { c.Database.User = "" }, "database.user"},
+		{"Address", func(c *Config) { c.Database.Address = "" }, "database.address"},
+		{"SQLiteName", func(c *Config) { c.Database.Driver, c.Database.Name = "sqlite", "" }, "database.name"},
+		{"QueryTimeout", func(c *Config) { c.Database.QueryTimeout = -time.Second }, "database.query_timeout"},
+		{"MaxOpenConns", func(c *Config) { c.Database.MaxOpenConns = -1 }, "database.max_open_conns"},
+		{"ConnectAttempts", func(c *Config) { c.Database.ConnectAttempts = 0 }, "database.connect_attempts"},
+		{"Issuer", func(c *Config) { c.Tokens.Issuer = "" }, "tokens.issuer"},
+		{"Lifetime", func(c *Config) { c.Tokens.AccessLifetime = -time.Minute }, "tokens.access_lifetime"},
+		{"RevocationStore", func(c *Config) { c.Tokens.RevocationStore = "redis" }, "tokens.revocation_store"},
+		{"Algorithm", func(c *Config) { c.Keys.Algorithm = "none" }, "keys.algorithm"},
+		{"Rotation", func(c *Config) { c.Keys.Rotation = -time.Hour }, "keys.rotation"},
+		{"PasswordAlgorithm", func(c *Config) { c.Password.Algorithm = "md5" }, "password.algorithm"},
+		{"BcryptCost", func(c *Config) { c.Password.BcryptCost = 3 }, "password.bcrypt_cost"},
+		{"Argon2Memory", func(c *Config) { c.Password.Argon2Memory = 8 }, "password.argon2_memory"},
+		{"Argon2Iterations", func(c *Config) { c.Password.Argon2Iterations = 0 }, "password.argon2_iterations"},
+		{"Argon2Parallelism", func(c *Config) { c.Password.Argon2Parallelism = 256 }, "password.argon2_parallelism"},
+		{"PasswordMinLength", func(c *Config) { c.Password.MinLength = 0 }, "password.min_length"},
+		{"PasswordMaxLength", func(c *Config) { c.Password.MaxLength = 7 }, "password.max_length"},
+		{"PasswordBreachCheck", func(c *Config) { c.Password.BreachCheck = "http" }, "password.breach_check"},
+		{"PasswordBreachPath", func(c *Config) { c.Password.BreachCheck = "bloom" }, "password.breach_path"},
+		{"TOTPWindow", func(c *Config) { c.TOTP.Window = 0 }, "totp.window"},
+		{"Clients", func(c *Config) { c.Introspection.Clients = "gateway" }, "introspection.clients"},
+		{"EmailVerificationLifetime", func(c *Config) { c.Tokens.EmailVerificationLifetime = 0 }, "tokens.email_verification_lifetime"},
+		{"VerificationURL", func(c *Config) { c.Email.VerificationURL = "/verify" }, "email.verification_url"},
+		{"PasswordResetLifetime", func(c *Config) { c.Tokens.PasswordResetLifetime = 0 }, "tokens.password_reset_lifetime"},
+		{"PasswordResetURL", func(c *Config) { c.Email.PasswordResetURL = "ftp://example.com/reset" }, "email.password_reset_url"},
+		{"Mailer", func(c *Config) { c.Email.Mailer = "sendmail" }, "email.mailer"},
+		{"MailerFile", func(c *Config) { c.Email.Mailer = "file" }, "email.file"},
+		{"SMTPAddress", func(c *Config) { c.Email.Mailer, c.Email.SMTPAddress = "smtp", "mail.example.com" }, "email.smtp_address"},
+		{"From", func(c *Config) { c.Email.From = "go-auth" }, "email.from"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			tc.modify(cfg)
+
+			err := cfg.Validate()
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected ValidationError, but was %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, but was %q", tc.wantErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Database.User = ""
+
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) {
+		t.Fatal("Expected ValidationError")
+	}
+	if len(verr.Problems) != 2 {
+		t.Errorf("Expected %d problems, but was %v", 2, verr.Problems)
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	cfg, err := Load([]string{"-config", "../../goauth.example.yaml"}, env(nil))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Expected example config to have default values %+v, but was %+v", Default(), cfg)
+	}
+}
@@ -1,55 +1,188 @@
-// Package db provides functions for interacting with a database. Only MySQL
-// database is supported for now.
+// Package db provides functions for interacting with a database. MySQL,
+// PostgreSQL and SQLite databases are supported, or data can be kept only in
+// memory.
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
 // DBConnection represents a layer between the database and the application
-// logic.
+// logic. Every query is cancelled when its ctx is done, or when it runs longer
+// than Options.QueryTimeout of the connection.
 type DBConnection interface {
 
 	// UserByUsername returns a UserDBEntity from database specified by the username
 	// parameter. If the username doesn't exist, error is returned.
-	UserByUsername(username string) (*UserDBEntity, error)
+	UserByUsername(ctx context.Context, username string) (*UserDBEntity, error)
 
-	// SaveUser saves the UserModel passed as parameter to a database.
-	SaveUser(user *UserModel) error
+	// UserByEmail returns a UserDBEntity from database specified by the email
+	// parameter. If the email isn't used, error is returned.
+	UserByEmail(ctx context.Context, email string) (*UserDBEntity, error)
+
+	// SaveUser saves the UserModel passed as parameter to a database. If the
+	// username or the email is already used, DuplicateEntryError is returned.
+	SaveUser(ctx context.Context, user *UserModel) error
 
 	// Save2FASecret saves secret for 2FA
-	Save2FASecret(username, secret string) error
+	Save2FASecret(ctx context.Context, username, secret string) error
 
 	// Get2FASecret retrieves 2FA secret
-	Get2FASecret(username string) (string, error)
+	Get2FASecret(ctx context.Context, username string) (string, error)
+
+	UpdateEnabled2FA(ctx context.Context, username string, enabled bool) error
+
+	GetEnabled2FA(ctx context.Context, username string) (bool, error)
+
+	// Enable2FA enables 2FA of the user, if it isn't enabled already. Returns
+	// false if it was, so only one of concurrent calls returns true.
+	Enable2FA(ctx context.Context, username string) (bool, error)
+
+	// UpdateEmailVerified sets whether the user verified the email address.
+	UpdateEmailVerified(ctx context.Context, username string, verified bool) error
+
+	// UpdatePassword replaces the password hash of the user.
+	UpdatePassword(ctx context.Context, username, passwordHash string) error
+
+	// SaveRefreshToken saves a new refresh token.
+	SaveRefreshToken(ctx context.Context, token *RefreshTokenDBEntity) error
+
+	// RefreshTokenByHash returns a refresh token specified by its hash. If
+	// the token doesn't exist, error is returned.
+	RefreshTokenByHash(ctx context.Context, hash string) (*RefreshTokenDBEntity, error)
+
+	// UseRefreshToken marks a refresh token as used. Returns false if the
+	// token was already used before, which means it is being reused.
+	UseRefreshToken(ctx context.Context, hash string) (bool, error)
+
+	// RevokeRefreshTokenFamily revokes all refresh tokens in the family.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+
+	// RefreshTokenFamilies returns IDs of families of refresh tokens of the
+	// user, which are neither revoked nor expired.
+	RefreshTokenFamilies(ctx context.Context, username string) ([]string, error)
+
+	// SavePasswordResetToken saves a new password reset token.
+	SavePasswordResetToken(ctx context.Context, token *PasswordResetTokenDBEntity) error
+
+	// PasswordResetTokenByHash returns a password reset token specified by
+	// its hash. If the token doesn't exist, error is returned.
+	PasswordResetTokenByHash(ctx context.Context, hash string) (*PasswordResetTokenDBEntity, error)
+
+	// UsePasswordResetToken marks a password reset token as used. Returns
+	// false if the token was already used before.
+	UsePasswordResetToken(ctx context.Context, hash string) (bool, error)
+
+	// DeletePasswordResetTokens deletes all password reset tokens of the
+	// user, so none of them can be used after the password was changed.
+	DeletePasswordResetTokens(ctx context.Context, username string) error
+
+	// ReplaceRecoveryCodes replaces all 2FA recovery codes of the user with
+	// new ones, specified by their hashes.
+	ReplaceRecoveryCodes(ctx context.Context, username string, hashes []string) error
 
-	UpdateEnabled2FA(username string, enabled bool) error
+	// UseRecoveryCode marks a 2FA recovery code of the user as used. Returns
+	// false if the user has no such unused code.
+	UseRecoveryCode(ctx context.Context, username, hash string) (bool, error)
 
-	GetEnabled2FA(username string) (bool, error)
+	// RecoveryCodesRemaining returns a number of unused 2FA recovery codes of
+	// the user.
+	RecoveryCodesRemaining(ctx context.Context, username string) (int, error)
+
+	// RevokeToken saves an ID of a revoked JWT, until the JWT expires.
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// IsTokenRevoked reports whether a non-expired JWT with the ID was revoked.
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	// DeleteExpiredRevocations deletes revocations of already expired JWTs.
+	DeleteExpiredRevocations(ctx context.Context) error
+
+	// Ping checks that the database is reachable.
+	Ping(ctx context.Context) error
 }
 
 // connection struct with embedded sql.DB struct serving as a layer between
-// application logic and database logic. Also this struct implements the
+// application logic and a MySQL, PostgreSQL or SQLite database, whose
+// differences are described by the dialect. Also this struct implements the
 // DBConnection interface.
 type connection struct {
 	*sql.DB
+	dialect dialect
+	// queryTimeout limits a duration of every query, zero means no limit.
+	queryTimeout time.Duration
 }
 
-// DBConnectino is a global connection to a database, through which application
-// logic interacts with database.
-var DBConn DBConnection = nil
+// maxConnectBackoff limits a delay between attempts to connect.
+const maxConnectBackoff = 30 * time.Second
 
-// ConnectDB establishes the global connection to a database.
-func ConnectDB(driver, dsn string) error {
-	var err error
+// Pool configures a pool of connections to a database. Zero values keep
+// defaults of database/sql.
+type Pool struct {
+	// MaxOpenConns limits the number of open connections.
+	MaxOpenConns int
+	// MaxIdleConns limits the number of idle connections kept open.
+	MaxIdleConns int
+	// ConnMaxLifetime closes connections open for longer.
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime closes connections idle for longer.
+	ConnMaxIdleTime time.Duration
+}
 
-	if DBConn == nil {
-		DBConn, err = connect(driver, dsn)
+// apply sets limits of the pool to the db.
+func (p Pool) apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
 	}
+}
+
+// Options configure a connection established by Connect.
+type Options struct {
+	Pool
+	// ConnectAttempts is a number of attempts to reach the database, a value
+	// below 2 means a single attempt.
+	ConnectAttempts int
+	// ConnectBackoff is a delay after the first failed attempt, it is doubled
+	// after every next one, up to 30s.
+	ConnectBackoff time.Duration
+	// QueryTimeout limits a duration of every query, so a slow database
+	// doesn't hold requests forever. Zero means no limit, other than the
+	// context of the query.
+	QueryTimeout time.Duration
+}
 
-	return err
+// Stats returns statistics of the connection pool of the conn. Returns false
+// if the connection has no pool, e.g. a memory database.
+func Stats(conn DBConnection) (sql.DBStats, bool) {
+	if c, ok := conn.(interface{ Stats() sql.DBStats }); ok {
+		return c.Stats(), true
+	}
+	return sql.DBStats{}, false
+}
+
+// Close closes the conn established by Connect. A memory database has nothing
+// to close.
+func Close(conn DBConnection) error {
+	if c, ok := conn.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
 }
 
 // MySQLDSNConfig is a simple util function for creating a mysql.Config with
@@ -64,12 +197,43 @@ func MySQLDSNConfig(user, passwd, addr, dbname string) *mysql.Config {
 	}
 }
 
-// connect tries to establish a connection to a database. The param driver
-// specifies the type of the database and dsn is the configuration used to
-// connect to the database. After initializing the connection to the database,
-// it is pinged to see if the connection was established.
-func connect(driver, dsn string) (DBConnection, error) {
-	var db *sql.DB
+// PostgresDSN is a simple util function for creating a connection URL of a
+// PostgreSQL database. SSL mode and other options not set by the URL can be
+// set by the standard PG* environment variables, e.g. PGSSLMODE.
+func PostgresDSN(user, passwd, addr, dbname string) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(user, passwd),
+		Host:   addr,
+		Path:   dbname,
+	}
+	return u.String()
+}
+
+// SQLiteDSN is a simple util function for creating a data source name of
+// a SQLite database stored in the file at path, or in memory if path is
+// ":memory:". Foreign keys are enforced and concurrent writers wait for each
+// other instead of failing.
+func SQLiteDSN(path string) string {
+	return path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+// Connect tries to establish a connection to a database. The param driver
+// specifies the type of the database, mysql, postgres, sqlite or memory, and
+// dsn is the configuration used to connect to the database. After
+// initializing the connection to the database, it is pinged to see if the
+// connection was established, if it fails, it is retried according to the
+// opts. An embedded SQLite database is always migrated to the latest version.
+// A memory database ignores the dsn and the opts.
+func Connect(driver, dsn string, opts Options) (DBConnection, error) {
+	if driver == "memory" {
+		return NewMemoryConnection(), nil
+	}
+
+	d, err := dialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
 
 	db, err := sql.Open(driver, dsn)
 
@@ -77,10 +241,84 @@ func connect(driver, dsn string) (DBConnection, error) {
 		return nil, err
 	}
 
-	pingErr := db.Ping()
+	opts.apply(db)
+	if driver == "sqlite" {
+		// a single connection serializes writes, which SQLite can't run
+		// concurrently, and keeps an in-memory database from being
+		// created again for every new connection
+		db.SetMaxOpenConns(1)
+	}
+
+	pingErr := ping(db, opts)
 	if pingErr != nil {
+		db.Close()
 		return nil, pingErr
 	}
 
-	return &connection{db}, nil
+	conn := &connection{db, d, opts.QueryTimeout}
+	if driver == "sqlite" {
+		if err := migrateUp(conn); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// withTimeout returns a copy of the ctx, which is cancelled after the
+// timeout, if set, and a function releasing it, which must be deferred.
+// If the query failed because the ctx is done, the function wraps the err
+// with the error of the ctx, because drivers don't report it consistently,
+// e.g. SQLite reports it as an interrupt.
+func withTimeout(ctx context.Context, timeout time.Duration, err *error) (context.Context, func()) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	return ctx, func() {
+		if ctxErr := ctx.Err(); *err != nil && ctxErr != nil && !errors.Is(*err, ctxErr) {
+			*err = fmt.Errorf("%w: %v", ctxErr, *err)
+		}
+		cancel()
+	}
+}
+
+// inTransaction runs the fn in a transaction of the db, which is committed if
+// the fn succeeds and rolled back otherwise.
+func inTransaction(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ping pings the db until it is reachable, or until all attempts set by the
+// opts fail, with a growing delay between them, so a database starting at the
+// same time as the application can be waited for.
+func ping(db *sql.DB, opts Options) error {
+	backoff := opts.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.Ping()
+		if err == nil || attempt >= opts.ConnectAttempts {
+			return err
+		}
+
+		fmt.Printf(" - attempt %d of %d failed: %s, retrying in %s\n", attempt, opts.ConnectAttempts, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
 }
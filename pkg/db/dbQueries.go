@@ -1,44 +1,61 @@
 package db
 
 import (
-	"fmt"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 // UserByUsername returns a UserDBEntity from database specified by the username
-// parameter. If the username doesn't exist, sql.ErrNoRows error is returned.
-func (db connection) UserByUsername(username string) (*UserDBEntity, error) {
-	var user UserDBEntity
-	var enabled2FAStr string
-
-	row := db.QueryRow("SELECT * FROM users WHERE username = ?", username)
+// parameter, compared case-insensitively. If the username doesn't exist,
+// sql.ErrNoRows error is returned.
+func (db connection) UserByUsername(ctx context.Context, username string) (_ *UserDBEntity, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
 
-	if err := row.Scan(&user.Uuid, &user.Username, &user.Email, &user.PasswordHash,
-		&user.Secret2FA, &enabled2FAStr); err != nil {
-		fmt.Println(err)
-		return nil, err
-	}
+	return scanUser(db.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE "+db.dialect.equalFold("username"), username))
+}
 
-	if enabled2FAStr == "\x00" {
-		user.Enabled2FA = false
-	} else {
-		user.Enabled2FA = true
-	}
+// UserByEmail returns a UserDBEntity from database specified by the email
+// parameter, compared case-insensitively. If the email isn't used,
+// sql.ErrNoRows error is returned.
+func (db connection) UserByEmail(ctx context.Context, email string) (_ *UserDBEntity, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
 
-	return &user, nil
+	return scanUser(db.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE "+db.dialect.equalFold("email"), email))
 }
 
-// SaveUser saves the UserModel passed as parameter to a database.
-func (db connection) SaveUser(user *UserModel) error {
-	_, err := db.Exec(
-		"INSERT INTO users (username, email, passwordHash, secret2FA, enabled2FA) VALUES (?, ?, ?, ?, ?)",
+// SaveUser saves the UserModel passed as parameter to a database. If the
+// username or the email is already used, DuplicateEntryError is returned.
+func (db connection) SaveUser(ctx context.Context, user *UserModel) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"INSERT INTO users (uuid, username, email, passwordHash, secret2FA, enabled2FA) VALUES (?, ?, ?, ?, ?, ?)",
+		uuid.NewString(),
 		user.Username,
 		user.Email,
 		user.PasswordHash,
 		nil,
-		0,
+		false,
 	)
 
 	if err != nil {
+		err = translateError(err)
+		// SQLite doesn't report the duplicate value, only the column
+		if dupErr, ok := err.(*DuplicateEntryError); ok && dupErr.Value == "" {
+			switch dupErr.Field {
+			case "username":
+				dupErr.Value = user.Username
+			case "email":
+				dupErr.Value = user.Email
+			}
+		}
 		return err
 	}
 
@@ -46,8 +63,12 @@ func (db connection) SaveUser(user *UserModel) error {
 }
 
 // Save2FASecret saves new secret needed during 2FA
-func (db connection) Save2FASecret(username, secret string) error {
-	_, err := db.Exec(
+func (db connection) Save2FASecret(ctx context.Context, username, secret string) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
 		"UPDATE users SET secret2FA = ? WHERE username = ?",
 		secret,
 		username,
@@ -61,10 +82,14 @@ func (db connection) Save2FASecret(username, secret string) error {
 }
 
 // Get2FASecret returns a secret used for 2FA. If an error occured, returns it.
-func (db connection) Get2FASecret(username string) (string, error) {
+func (db connection) Get2FASecret(ctx context.Context, username string) (_ string, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
 	var secret string
-	err := db.QueryRow(
-		"SELECT secret2FA FROM users WHERE users.username=?",
+	err = db.queryRow(
+		ctx,
+		"SELECT secret2FA FROM users WHERE users.username = ?",
 		username,
 	).Scan(&secret)
 
@@ -75,8 +100,12 @@ func (db connection) Get2FASecret(username string) (string, error) {
 	return secret, nil
 }
 
-func (db connection) UpdateEnabled2FA(username string, enabled bool) error {
-	_, err := db.Exec(
+func (db connection) UpdateEnabled2FA(ctx context.Context, username string, enabled bool) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
 		"UPDATE users SET enabled2FA = ? WHERE username = ?",
 		enabled,
 		username,
@@ -88,20 +117,419 @@ func (db connection) UpdateEnabled2FA(username string, enabled bool) error {
 
 	return nil
 }
-func (db connection) GetEnabled2FA(username string) (bool, error) {
-	var enabled2FAStr string
 
-	err := db.QueryRow(
-		"SELECT enabled2FA FROM users WHERE users.username=?",
+func (db connection) GetEnabled2FA(ctx context.Context, username string) (_ bool, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	var enabled flag
+
+	err = db.queryRow(
+		ctx,
+		"SELECT enabled2FA FROM users WHERE users.username = ?",
 		username,
-	).Scan(&enabled2FAStr)
+	).Scan(&enabled)
 
 	if err != nil {
 		return false, err
 	}
 
-	if enabled2FAStr == "\x00" {
-		return false, nil
+	return bool(enabled), nil
+}
+
+// Enable2FA enables 2FA of the user, if it isn't enabled already. The update
+// is conditional, so when 2FA is enabled concurrently, only one of the calls
+// returns true.
+func (db connection) Enable2FA(ctx context.Context, username string) (_ bool, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	res, err := db.exec(
+		ctx,
+		"UPDATE users SET enabled2FA = TRUE WHERE username = ? AND enabled2FA = FALSE",
+		username,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
 	}
-	return true, nil
+
+	return n == 1, nil
+}
+
+// UpdateEmailVerified sets whether the user verified the email address.
+// Updating a non-existent user does nothing.
+func (db connection) UpdateEmailVerified(ctx context.Context, username string, verified bool) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"UPDATE users SET emailVerified = ? WHERE username = ?",
+		verified,
+		username,
+	)
+
+	return err
+}
+
+// UpdatePassword replaces the password hash of the user. Updating
+// a non-existent user does nothing.
+func (db connection) UpdatePassword(ctx context.Context, username, passwordHash string) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"UPDATE users SET passwordHash = ? WHERE username = ?",
+		passwordHash,
+		username,
+	)
+
+	return err
+}
+
+// SaveRefreshToken saves a new refresh token into a database.
+func (db connection) SaveRefreshToken(ctx context.Context, token *RefreshTokenDBEntity) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"INSERT INTO refresh_tokens (tokenHash, familyID, username, expiresAt, used, revoked) VALUES (?, ?, ?, ?, ?, ?)",
+		token.TokenHash,
+		token.FamilyID,
+		token.Username,
+		token.ExpiresAt.Unix(),
+		token.Used,
+		token.Revoked,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RefreshTokenByHash returns a refresh token specified by its hash. If the
+// token doesn't exist, sql.ErrNoRows error is returned.
+func (db connection) RefreshTokenByHash(ctx context.Context, hash string) (_ *RefreshTokenDBEntity, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	var token RefreshTokenDBEntity
+	var expiresAt int64
+
+	err = db.queryRow(
+		ctx,
+		"SELECT tokenHash, familyID, username, expiresAt, used, revoked FROM refresh_tokens WHERE tokenHash = ?",
+		hash,
+	).Scan(&token.TokenHash, &token.FamilyID, &token.Username, &expiresAt,
+		&token.Used, &token.Revoked)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	return &token, nil
+}
+
+// UseRefreshToken marks a refresh token as used. The update is conditional,
+// so when the same token is used concurrently, only one of the uses succeeds.
+// Returns false if the token was already used.
+func (db connection) UseRefreshToken(ctx context.Context, hash string) (_ bool, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	res, err := db.exec(
+		ctx,
+		"UPDATE refresh_tokens SET used = TRUE WHERE tokenHash = ? AND used = FALSE",
+		hash,
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens in the family.
+func (db connection) RevokeRefreshTokenFamily(ctx context.Context, familyID string) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"UPDATE refresh_tokens SET revoked = TRUE WHERE familyID = ?",
+		familyID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RefreshTokenFamilies returns IDs of families of refresh tokens of the user,
+// which are neither revoked nor expired, so they identify active sessions.
+func (db connection) RefreshTokenFamilies(ctx context.Context, username string) (_ []string, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	rows, err := db.query(
+		ctx,
+		"SELECT DISTINCT familyID FROM refresh_tokens WHERE username = ? AND revoked = FALSE AND expiresAt > ?",
+		username,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var families []string
+	for rows.Next() {
+		var family string
+		if err = rows.Scan(&family); err != nil {
+			return nil, err
+		}
+		families = append(families, family)
+	}
+
+	return families, rows.Err()
+}
+
+// SavePasswordResetToken saves a new password reset token into a database.
+func (db connection) SavePasswordResetToken(ctx context.Context, token *PasswordResetTokenDBEntity) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"INSERT INTO password_reset_tokens (tokenHash, username, expiresAt, used) VALUES (?, ?, ?, ?)",
+		token.TokenHash,
+		token.Username,
+		token.ExpiresAt.Unix(),
+		token.Used,
+	)
+
+	return err
+}
+
+// PasswordResetTokenByHash returns a password reset token specified by its
+// hash. If the token doesn't exist, sql.ErrNoRows error is returned.
+func (db connection) PasswordResetTokenByHash(ctx context.Context, hash string) (_ *PasswordResetTokenDBEntity, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	var token PasswordResetTokenDBEntity
+	var expiresAt int64
+
+	err = db.queryRow(
+		ctx,
+		"SELECT tokenHash, username, expiresAt, used FROM password_reset_tokens WHERE tokenHash = ?",
+		hash,
+	).Scan(&token.TokenHash, &token.Username, &expiresAt, &token.Used)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	return &token, nil
+}
+
+// UsePasswordResetToken marks a password reset token as used. The update is
+// conditional, so when the same token is used concurrently, only one of the
+// uses succeeds. Returns false if the token was already used.
+func (db connection) UsePasswordResetToken(ctx context.Context, hash string) (_ bool, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	res, err := db.exec(
+		ctx,
+		"UPDATE password_reset_tokens SET used = TRUE WHERE tokenHash = ? AND used = FALSE",
+		hash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// DeletePasswordResetTokens deletes all password reset tokens of the user.
+func (db connection) DeletePasswordResetTokens(ctx context.Context, username string) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(ctx, "DELETE FROM password_reset_tokens WHERE username = ?", username)
+	return err
+}
+
+// ReplaceRecoveryCodes replaces all 2FA recovery codes of the user with new
+// ones, specified by their hashes, in a single transaction, so the old codes
+// are valid until the new ones are saved.
+func (db connection) ReplaceRecoveryCodes(ctx context.Context, username string, hashes []string) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	return inTransaction(ctx, db.DB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, db.dialect.rebind("DELETE FROM recovery_codes WHERE username = ?"), username); err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			_, err := tx.ExecContext(
+				ctx,
+				db.dialect.rebind("INSERT INTO recovery_codes (codeHash, username, used) VALUES (?, ?, FALSE)"),
+				hash,
+				username,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode marks a 2FA recovery code of the user as used. The update
+// is conditional, so when the same code is used concurrently, only one of the
+// uses succeeds. Returns false if the user has no such unused code.
+func (db connection) UseRecoveryCode(ctx context.Context, username, hash string) (_ bool, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	res, err := db.exec(
+		ctx,
+		"UPDATE recovery_codes SET used = TRUE WHERE codeHash = ? AND username = ? AND used = FALSE",
+		hash,
+		username,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// RecoveryCodesRemaining returns a number of unused 2FA recovery codes of the
+// user.
+func (db connection) RecoveryCodesRemaining(ctx context.Context, username string) (_ int, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	var remaining int
+	err = db.queryRow(
+		ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE username = ? AND used = FALSE",
+		username,
+	).Scan(&remaining)
+
+	return remaining, err
+}
+
+// RevokeToken saves an ID of a revoked JWT, until the JWT expires. Revoking
+// an already revoked JWT is not an error.
+func (db connection) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		db.dialect.insertIgnoring("revoked_tokens", "jti, expiresAt", "?, ?"),
+		jti,
+		expiresAt.Unix(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether a non-expired JWT with the ID was revoked.
+func (db connection) IsTokenRevoked(ctx context.Context, jti string) (_ bool, err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	var count int
+
+	err = db.queryRow(
+		ctx,
+		"SELECT COUNT(*) FROM revoked_tokens WHERE jti = ? AND expiresAt > ?",
+		jti,
+		time.Now().Unix(),
+	).Scan(&count)
+
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpiredRevocations deletes revocations of already expired JWTs.
+func (db connection) DeleteExpiredRevocations(ctx context.Context) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	_, err = db.exec(
+		ctx,
+		"DELETE FROM revoked_tokens WHERE expiresAt <= ?",
+		time.Now().Unix(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Ping checks that the database is reachable.
+func (db connection) Ping(ctx context.Context) (err error) {
+	ctx, done := withTimeout(ctx, db.queryTimeout, &err)
+	defer done()
+
+	return db.PingContext(ctx)
+}
+
+// exec executes the query, with ? placeholders, without returning any rows.
+func (db connection) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(ctx, db.dialect.rebind(query), args...)
+}
+
+// query executes the query, with ? placeholders, returning rows.
+func (db connection) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(ctx, db.dialect.rebind(query), args...)
+}
+
+// queryRow executes the query, with ? placeholders, returning at most one row.
+func (db connection) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(ctx, db.dialect.rebind(query), args...)
 }
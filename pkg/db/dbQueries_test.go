@@ -1,115 +1,874 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"log"
-	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
 )
 
-var stubDB *connection
-var mock sqlmock.Sqlmock
 var model UserModel = UserModel{
 	Username:     "James",
 	Email:        "jam@bar.com",
 	PasswordHash: "as46984asdfkjSDFas",
 }
 
-func TestMain(m *testing.M) {
-	stubDB, mock = newMock()
-	code := m.Run()
-	stubDB.Close()
-	os.Exit(code)
+// backend is a connection to a database on which the same tests are run, so
+// behaviour of backends can't drift apart.
+type backend struct {
+	conn DBConnection
+	// mock is set only for a stub database, which needs expected queries.
+	mock sqlmock.Sqlmock
 }
 
-func Test_connectionSaveUser(t *testing.T) {
-	query := "INSERT INTO users"
+// expect scripts queries expected by the stub database. For real databases
+// it does nothing, they run the queries themselves.
+func (b backend) expect(script func(mock sqlmock.Sqlmock)) {
+	if b.mock != nil {
+		script(b.mock)
+	}
+}
 
-	mock.ExpectExec(query).
-		WithArgs(model.Username, model.Email, model.PasswordHash, nil, 0).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+// forEachBackend runs the test against a stub MySQL database, a new SQLite
+// database and a new MemoryConnection.
+func forEachBackend(t *testing.T, test func(t *testing.T, b backend)) {
+	t.Run("sqlmock", func(t *testing.T) {
+		stubDB, mock := newMock()
+		defer stubDB.Close()
 
-	if err := stubDB.SaveUser(&model); err != nil {
-		t.Errorf("error was not expected: %s", err)
-	}
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
+		test(t, backend{conn: stubDB, mock: mock})
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		conn, err := Connect("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "users.db")), Options{})
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a SQLite database", err)
+		}
+		defer conn.(*connection).Close()
+
+		test(t, backend{conn: conn})
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		test(t, backend{conn: NewMemoryConnection()})
+	})
+}
+
+// saveModel saves the model user, which is required by foreign keys of real
+// databases.
+func saveModel(t *testing.T, b backend) {
+	t.Helper()
+
+	b.expect(func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec("INSERT INTO users").
+			WithArgs(sqlmock.AnyArg(), model.Username, model.Email, model.PasswordHash, nil, false).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	})
+
+	if err := b.conn.SaveUser(context.Background(), &model); err != nil {
+		t.Fatalf("error was not expected: %s", err)
 	}
 }
 
-func Test_connectionSaveUserError(t *testing.T) {
-	query := "INSERT INTO users"
+func Test_connectionSaveUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE username").
+				WithArgs(model.Username).
+				WillReturnRows(sqlmock.NewRows([]string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}).
+					AddRow(uuid.NewString(), model.Username, model.Email, model.PasswordHash, nil, "\x00", "\x00"))
+		})
 
-	mock.ExpectExec(query).
-		WithArgs(model.Username, model.Email, model.PasswordHash, nil, 0).
-		WillReturnError(errors.New("testing error"))
+		user, err := b.conn.UserByUsername(context.Background(), model.Username)
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if user.Uuid == uuid.Nil {
+			t.Error("Expected user to have an uuid")
+		}
+		if user.Email != model.Email || user.PasswordHash != model.PasswordHash {
+			t.Errorf("Expected saved user, but was %s", user)
+		}
+		if user.Enabled2FA || user.Secret2FA.Valid {
+			t.Errorf("Expected 2FA not to be set up, but was %s", user)
+		}
+		if user.EmailVerified {
+			t.Errorf("Expected email not to be verified, but was %s", user)
+		}
+	})
+}
 
-	if err := stubDB.SaveUser(&model); err == nil {
-		t.Errorf("error was expected: %s", err)
+func Test_connectionSaveUserError(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      UserModel
+		wantField string
+		wantValue string
+	}{
+		{
+			name:      "Username",
+			user:      UserModel{Username: "james", Email: "other@bar.com", PasswordHash: model.PasswordHash},
+			wantField: "username",
+			wantValue: "james",
+		},
+		{
+			name:      "Email",
+			user:      UserModel{Username: "Other", Email: model.Email, PasswordHash: model.PasswordHash},
+			wantField: "email",
+			wantValue: model.Email,
+		},
 	}
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, b backend) {
+				saveModel(t, b)
+
+				b.expect(func(mock sqlmock.Sqlmock) {
+					mock.ExpectExec("INSERT INTO users").
+						WithArgs(sqlmock.AnyArg(), tt.user.Username, tt.user.Email, tt.user.PasswordHash, nil, false).
+						WillReturnError(&mysql.MySQLError{
+							Number:  1062,
+							Message: "Duplicate entry '" + tt.wantValue + "' for key 'users." + tt.wantField + "'",
+						})
+				})
+
+				err := b.conn.SaveUser(context.Background(), &tt.user)
+
+				var dupErr *DuplicateEntryError
+				if !errors.As(err, &dupErr) {
+					t.Fatalf("Expected DuplicateEntryError, but was %v", err)
+				}
+				if dupErr.Field != tt.wantField || dupErr.Value != tt.wantValue {
+					t.Errorf("Expected duplicate %s %s, but was %s %s", tt.wantField, tt.wantValue, dupErr.Field, dupErr.Value)
+				}
+			})
+		})
 	}
 }
 
 func TestSave2FASecretNullWhenNotSet(t *testing.T) {
-	query := "UPDATE users SET secret2FA"
 	secret := "ZSOOSQWFTYYO7VZI"
 
-	mock.ExpectExec(query).
-		WithArgs(secret, model.Username).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
 
-	if err := stubDB.Save2FASecret(model.Username, secret); err != nil {
-		t.Errorf("error was not expected: %s", err)
-	}
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
-	}
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("UPDATE users SET secret2FA").
+				WithArgs(secret, model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		})
+
+		if err := b.conn.Save2FASecret(context.Background(), model.Username, secret); err != nil {
+			t.Errorf("error was not expected: %s", err)
+		}
+	})
 }
 
 func TestGet2FASecretReturnCorrectSecret(t *testing.T) {
-	query := "SELECT secret2FA FROM users WHERE"
 	secret := "ZSOOSQWFTYYO7VZI"
 
-	mock.ExpectQuery(query).
-		WithArgs(model.Username).
-		WillReturnRows(sqlmock.NewRows([]string{"secret2FA"}).AddRow(secret))
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
 
-	actual, err := stubDB.Get2FASecret(model.Username)
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("UPDATE users SET secret2FA").
+				WithArgs(secret, model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT secret2FA FROM users WHERE").
+				WithArgs(model.Username).
+				WillReturnRows(sqlmock.NewRows([]string{"secret2FA"}).AddRow(secret))
+		})
 
-	if err != nil {
-		t.Errorf("error was not expected: %s", err)
+		if err := b.conn.Save2FASecret(context.Background(), model.Username, secret); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		got, err := b.conn.Get2FASecret(context.Background(), model.Username)
+
+		if err != nil {
+			t.Errorf("error was not expected: %s", err)
+		}
+		if got != secret {
+			t.Errorf("Expected secret to be %s, but was %s", secret, got)
+		}
+	})
+}
+
+func TestGet2FASecretNonExistentUsername(t *testing.T) {
+	username := "John"
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT secret2FA FROM users WHERE").
+				WithArgs(username).
+				WillReturnRows(sqlmock.NewRows([]string{"secret2FA"}))
+		})
+
+		wantSecret := ""
+		secret, err := b.conn.Get2FASecret(context.Background(), username)
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows, but was %v", err)
+		}
+		if secret != wantSecret {
+			t.Errorf("Expected secret to be %s, but was %s", wantSecret, secret)
+		}
+	})
+}
+
+func TestEnabled2FA(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("UPDATE users SET enabled2FA").
+				WithArgs(true, model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT enabled2FA FROM users WHERE").
+				WithArgs(model.Username).
+				WillReturnRows(sqlmock.NewRows([]string{"enabled2FA"}).AddRow("\x01"))
+		})
+
+		if err := b.conn.UpdateEnabled2FA(context.Background(), model.Username, true); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		enabled, err := b.conn.GetEnabled2FA(context.Background(), model.Username)
+
+		if err != nil {
+			t.Errorf("error was not expected: %s", err)
+		}
+		if !enabled {
+			t.Error("Expected 2FA to be enabled")
+		}
+	})
+}
+
+func TestEnable2FAOnce(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("UPDATE users SET enabled2FA = TRUE WHERE username = \\? AND enabled2FA = FALSE").
+				WithArgs(model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE users SET enabled2FA = TRUE WHERE username = \\? AND enabled2FA = FALSE").
+				WithArgs(model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+
+		for _, want := range []bool{true, false} {
+			enabled, err := b.conn.Enable2FA(context.Background(), model.Username)
+
+			if err != nil {
+				t.Fatalf("error was not expected: %s", err)
+			}
+			if enabled != want {
+				t.Errorf("Expected enabled to be %t, but was %t", want, enabled)
+			}
+		}
+	})
+}
+
+func TestUpdateEmailVerified(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("UPDATE users SET emailVerified").
+				WithArgs(true, model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE username").
+				WithArgs(model.Username).
+				WillReturnRows(sqlmock.NewRows([]string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}).
+					AddRow(uuid.NewString(), model.Username, model.Email, model.PasswordHash, nil, "\x00", "\x01"))
+		})
+
+		if err := b.conn.UpdateEmailVerified(context.Background(), model.Username, true); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		user, err := b.conn.UserByUsername(context.Background(), model.Username)
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if !user.EmailVerified {
+			t.Errorf("Expected email to be verified, but was %s", user)
+		}
+	})
+}
+
+func TestUserByEmail(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE email").
+				WithArgs("JAM@bar.com").
+				WillReturnRows(sqlmock.NewRows([]string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}).
+					AddRow(uuid.NewString(), model.Username, model.Email, model.PasswordHash, nil, "\x00", "\x00"))
+		})
+
+		user, err := b.conn.UserByEmail(context.Background(), "JAM@bar.com")
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if user.Username != model.Username {
+			t.Errorf("Expected user %s, but was %s", model.Username, user)
+		}
+	})
+}
+
+func TestUserByUsernameIgnoresCase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE username").
+				WithArgs("jAMES").
+				WillReturnRows(sqlmock.NewRows([]string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}).
+					AddRow(uuid.NewString(), model.Username, model.Email, model.PasswordHash, nil, "\x00", "\x00"))
+		})
+
+		user, err := b.conn.UserByUsername(context.Background(), "jAMES")
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if user.Username != model.Username {
+			t.Errorf("Expected user %s, but was %s", model.Username, user)
+		}
+	})
+}
+
+func TestUserByEmailNonExistent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE email").
+				WithArgs("nobody@bar.com").
+				WillReturnError(sql.ErrNoRows)
+		})
+
+		_, err := b.conn.UserByEmail(context.Background(), "nobody@bar.com")
+
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows, but was %v", err)
+		}
+	})
+}
+
+func TestUpdatePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("UPDATE users SET passwordHash").
+				WithArgs("newHash", model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT (.+) FROM users WHERE username").
+				WithArgs(model.Username).
+				WillReturnRows(sqlmock.NewRows([]string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}).
+					AddRow(uuid.NewString(), model.Username, model.Email, "newHash", nil, "\x00", "\x00"))
+		})
+
+		if err := b.conn.UpdatePassword(context.Background(), model.Username, "newHash"); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		user, err := b.conn.UserByUsername(context.Background(), model.Username)
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if user.PasswordHash != "newHash" {
+			t.Errorf("Expected password hash %s, but was %s", "newHash", user.PasswordHash)
+		}
+	})
+}
+
+func TestRefreshTokenFamilies(t *testing.T) {
+	active := time.Now().Add(time.Hour)
+	tokens := []RefreshTokenDBEntity{
+		{TokenHash: "a1", FamilyID: "a", Username: model.Username, ExpiresAt: active, Used: true},
+		{TokenHash: "a2", FamilyID: "a", Username: model.Username, ExpiresAt: active},
+		{TokenHash: "b1", FamilyID: "b", Username: model.Username, ExpiresAt: active, Revoked: true},
+		{TokenHash: "c1", FamilyID: "c", Username: model.Username, ExpiresAt: time.Now().Add(-time.Hour)},
 	}
-	if actual != secret {
-		t.Errorf("Expected secret to be %s, but was %s", secret, actual)
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			for range tokens {
+				mock.ExpectExec("INSERT INTO refresh_tokens").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectQuery("SELECT DISTINCT familyID FROM refresh_tokens WHERE").
+				WithArgs(model.Username, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"familyID"}).AddRow("a"))
+		})
+
+		for i := range tokens {
+			if err := b.conn.SaveRefreshToken(context.Background(), &tokens[i]); err != nil {
+				t.Fatalf("error was not expected: %s", err)
+			}
+		}
+
+		families, err := b.conn.RefreshTokenFamilies(context.Background(), model.Username)
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if len(families) != 1 || families[0] != "a" {
+			t.Errorf("Expected only the active family %q, but was %q", "a", families)
+		}
+	})
+}
+
+func TestPasswordResetToken(t *testing.T) {
+	token := PasswordResetTokenDBEntity{
+		TokenHash: "hash",
+		Username:  model.Username,
+		ExpiresAt: time.Unix(1700000000, 0),
+	}
+	columns := []string{"tokenHash", "username", "expiresAt", "used"}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("INSERT INTO password_reset_tokens").
+				WithArgs(token.TokenHash, token.Username, token.ExpiresAt.Unix(), false).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE password_reset_tokens SET used").
+				WithArgs(token.TokenHash).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE password_reset_tokens SET used").
+				WithArgs(token.TokenHash).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("SELECT (.+) FROM password_reset_tokens WHERE").
+				WithArgs(token.TokenHash).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(token.TokenHash, model.Username, int64(1700000000), true))
+		})
+
+		if err := b.conn.SavePasswordResetToken(context.Background(), &token); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		for _, want := range []bool{true, false} {
+			got, err := b.conn.UsePasswordResetToken(context.Background(), token.TokenHash)
+
+			if err != nil {
+				t.Errorf("error was not expected: %s", err)
+			}
+			if got != want {
+				t.Errorf("Expected %v, but was %v", want, got)
+			}
+		}
+
+		found, err := b.conn.PasswordResetTokenByHash(context.Background(), token.TokenHash)
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if found.Username != model.Username || !found.ExpiresAt.Equal(token.ExpiresAt) || !found.Used {
+			t.Errorf("Expected used token of %s, but was %s", model.Username, found)
+		}
+	})
+}
+
+func TestDeletePasswordResetTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			for range []int{1, 2} {
+				mock.ExpectExec("INSERT INTO password_reset_tokens").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectExec("DELETE FROM password_reset_tokens WHERE username").
+				WithArgs(model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectQuery("SELECT (.+) FROM password_reset_tokens WHERE").
+				WithArgs("first").
+				WillReturnError(sql.ErrNoRows)
+		})
+
+		for _, hash := range []string{"first", "second"} {
+			token := PasswordResetTokenDBEntity{TokenHash: hash, Username: model.Username, ExpiresAt: time.Unix(1700000000, 0)}
+			if err := b.conn.SavePasswordResetToken(context.Background(), &token); err != nil {
+				t.Fatalf("error was not expected: %s", err)
+			}
+		}
+
+		if err := b.conn.DeletePasswordResetTokens(context.Background(), model.Username); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+
+		if _, err := b.conn.PasswordResetTokenByHash(context.Background(), "first"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows, but was %v", err)
+		}
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			for _, hashes := range [][]string{{"old"}, {"first", "second"}} {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM recovery_codes").
+					WithArgs(model.Username).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				for _, hash := range hashes {
+					mock.ExpectExec("INSERT INTO recovery_codes").
+						WithArgs(hash, model.Username).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			}
+			mock.ExpectExec("UPDATE recovery_codes SET used").
+				WithArgs("old", model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("UPDATE recovery_codes SET used").
+				WithArgs("first", model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE recovery_codes SET used").
+				WithArgs("first", model.Username).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM recovery_codes").
+				WithArgs(model.Username).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		})
+
+		ctx := context.Background()
+		if err := b.conn.ReplaceRecoveryCodes(ctx, model.Username, []string{"old"}); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if err := b.conn.ReplaceRecoveryCodes(ctx, model.Username, []string{"first", "second"}); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+
+		for _, tt := range []struct {
+			hash string
+			want bool
+		}{{"old", false}, {"first", true}, {"first", false}} {
+			got, err := b.conn.UseRecoveryCode(ctx, model.Username, tt.hash)
+
+			if err != nil {
+				t.Errorf("error was not expected: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("Using %s, expected %v, but was %v", tt.hash, tt.want, got)
+			}
+		}
+
+		remaining, err := b.conn.RecoveryCodesRemaining(ctx, model.Username)
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if remaining != 1 {
+			t.Errorf("Expected 1 remaining code, but was %d", remaining)
+		}
+	})
+}
+
+func TestReplaceRecoveryCodesRollback(t *testing.T) {
+	stubDB, mock := newMock()
+	defer stubDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM recovery_codes").
+		WithArgs(model.Username).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO recovery_codes").
+		WithArgs("hash", model.Username).
+		WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
+
+	if err := stubDB.ReplaceRecoveryCodes(context.Background(), model.Username, []string{"hash"}); err == nil {
+		t.Error("error was expected")
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
 
-func TestGet2FASecretNonExistentUsername(t *testing.T) {
-	query := "SELECT secret2FA FROM users WHERE"
-	username := "John"
+func TestSaveRefreshToken(t *testing.T) {
+	token := RefreshTokenDBEntity{
+		TokenHash: "hash",
+		FamilyID:  "family",
+		Username:  model.Username,
+		ExpiresAt: time.Unix(1700000000, 0),
+	}
 
-	mock.ExpectQuery(query).
-		WithArgs(username).
-		WillReturnError(errors.New("testing error"))
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
 
-	wantSecret := ""
-	secret, err := stubDB.Get2FASecret(username)
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("INSERT INTO refresh_tokens").
+				WithArgs(token.TokenHash, token.FamilyID, token.Username, token.ExpiresAt.Unix(), false, false).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		})
 
-	if err == nil {
-		t.Error("error was expected")
+		if err := b.conn.SaveRefreshToken(context.Background(), &token); err != nil {
+			t.Errorf("error was not expected: %s", err)
+		}
+	})
+}
+
+func TestRefreshTokenByHash(t *testing.T) {
+	hash := "hash"
+	columns := []string{"tokenHash", "familyID", "username", "expiresAt", "used", "revoked"}
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("INSERT INTO refresh_tokens").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE refresh_tokens SET used").
+				WithArgs(hash).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE").
+				WithArgs(hash).
+				WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(hash, "family", model.Username, int64(1700000000), true, false))
+		})
+
+		err := b.conn.SaveRefreshToken(context.Background(), &RefreshTokenDBEntity{
+			TokenHash: hash,
+			FamilyID:  "family",
+			Username:  model.Username,
+			ExpiresAt: time.Unix(1700000000, 0),
+		})
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if _, err := b.conn.UseRefreshToken(context.Background(), hash); err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+
+		token, err := b.conn.RefreshTokenByHash(context.Background(), hash)
+
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if token.FamilyID != "family" {
+			t.Errorf("Expected family to be %s, but was %s", "family", token.FamilyID)
+		}
+		if !token.ExpiresAt.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("Expected expiration to be %d, but was %d", 1700000000, token.ExpiresAt.Unix())
+		}
+		if !token.Used || token.Revoked {
+			t.Errorf("Expected used and not revoked token, but was %s", token)
+		}
+	})
+}
+
+func TestUseRefreshToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("INSERT INTO refresh_tokens").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE refresh_tokens SET used").
+				WithArgs("hash").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE refresh_tokens SET used").
+				WithArgs("hash").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+
+		err := b.conn.SaveRefreshToken(context.Background(), &RefreshTokenDBEntity{
+			TokenHash: "hash",
+			FamilyID:  "family",
+			Username:  model.Username,
+			ExpiresAt: time.Unix(1700000000, 0),
+		})
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+
+		for _, want := range []bool{true, false} {
+			got, err := b.conn.UseRefreshToken(context.Background(), "hash")
+
+			if err != nil {
+				t.Errorf("error was not expected: %s", err)
+			}
+			if got != want {
+				t.Errorf("Expected %v, but was %v", want, got)
+			}
+		}
+	})
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		saveModel(t, b)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("INSERT INTO refresh_tokens").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE refresh_tokens SET revoked").
+				WithArgs("family").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE").
+				WithArgs("hash").
+				WillReturnRows(sqlmock.NewRows([]string{"tokenHash", "familyID", "username", "expiresAt", "used", "revoked"}).
+					AddRow("hash", "family", model.Username, int64(1700000000), false, true))
+		})
+
+		err := b.conn.SaveRefreshToken(context.Background(), &RefreshTokenDBEntity{
+			TokenHash: "hash",
+			FamilyID:  "family",
+			Username:  model.Username,
+			ExpiresAt: time.Unix(1700000000, 0),
+		})
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+
+		if err := b.conn.RevokeRefreshTokenFamily(context.Background(), "family"); err != nil {
+			t.Errorf("error was not expected: %s", err)
+		}
+
+		token, err := b.conn.RefreshTokenByHash(context.Background(), "hash")
+		if err != nil {
+			t.Fatalf("error was not expected: %s", err)
+		}
+		if !token.Revoked {
+			t.Error("Expected token of the family to be revoked")
+		}
+	})
+}
+
+func TestRevokeToken(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+
+	forEachBackend(t, func(t *testing.T, b backend) {
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("INSERT IGNORE INTO revoked_tokens").
+				WithArgs("jti", expiresAt.Unix()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT IGNORE INTO revoked_tokens").
+				WithArgs("jti", expiresAt.Unix()).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+		})
+
+		// revoking an already revoked token is not an error
+		for i := 0; i < 2; i++ {
+			if err := b.conn.RevokeToken(context.Background(), "jti", expiresAt); err != nil {
+				t.Errorf("error was not expected: %s", err)
+			}
+		}
+	})
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      bool
+	}{
+		{"Revoked", time.Now().Add(time.Hour), true},
+		{"Expired", time.Now().Add(-time.Hour), false},
 	}
-	if secret != wantSecret {
-		t.Errorf("Expected secret to be %s, but was %s", wantSecret, secret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, b backend) {
+				count := 0
+				if tt.want {
+					count = 1
+				}
+				b.expect(func(mock sqlmock.Sqlmock) {
+					mock.ExpectExec("INSERT IGNORE INTO revoked_tokens").
+						WithArgs("jti", tt.expiresAt.Unix()).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM revoked_tokens WHERE").
+						WithArgs("jti", sqlmock.AnyArg()).
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+				})
+
+				if err := b.conn.RevokeToken(context.Background(), "jti", tt.expiresAt); err != nil {
+					t.Fatalf("error was not expected: %s", err)
+				}
+				got, err := b.conn.IsTokenRevoked(context.Background(), "jti")
+
+				if err != nil {
+					t.Errorf("error was not expected: %s", err)
+				}
+				if got != tt.want {
+					t.Errorf("Expected %v, but was %v", tt.want, got)
+				}
+			})
+		})
 	}
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
+}
+
+func TestRevocationStorePurgesExpired(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		store := NewRevocationStore(b.conn)
+		store.lastPurge = time.Now().Add(-revocationPurgeInterval)
+
+		b.expect(func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("DELETE FROM revoked_tokens").
+				WithArgs(sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec("INSERT IGNORE INTO revoked_tokens").
+				WithArgs("jti", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		})
+
+		if err := store.Revoke(context.Background(), "jti", time.Now().Add(time.Hour)); err != nil {
+			t.Errorf("error was not expected: %s", err)
+		}
+	})
+}
+
+func TestQueryTimeout(t *testing.T) {
+	stubDB, mock := newMock()
+	stubDB.queryTimeout = 10 * time.Millisecond
+	defer stubDB.Close()
+	mock.ExpectQuery("SELECT (.+) FROM users WHERE username").
+		WithArgs(model.Username).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"uuid"}))
+
+	_, err := stubDB.UserByUsername(context.Background(), model.Username)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, but was %v", err)
+	}
+}
+
+func TestQueryCancelled(t *testing.T) {
+	stubDB, mock := newMock()
+	defer stubDB.Close()
+	mock.ExpectExec("UPDATE users SET secret2FA").
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := stubDB.Save2FASecret(ctx, model.Username, "secret")
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, but was %v", err)
 	}
 }
 
@@ -119,5 +878,5 @@ func newMock() (*connection, sqlmock.Sqlmock) {
 		log.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 
-	return &connection{db}, mock
+	return &connection{DB: db, dialect: mySQLDialect}, mock
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -26,14 +27,57 @@ type UserDBEntity struct {
 
 	// Enabled2FA indicates if user enabled 2FA
 	Enabled2FA bool
+
+	// EmailVerified indicates if user verified the email address
+	EmailVerified bool
+}
+
+// userColumns are columns of the users table in the order scanned by scanUser.
+const userColumns = "uuid, username, email, passwordHash, secret2FA, enabled2FA, emailVerified"
+
+// scanUser scans the row with userColumns into a UserDBEntity.
+func scanUser(row *sql.Row) (*UserDBEntity, error) {
+	var user UserDBEntity
+	var enabled2FA, emailVerified flag
+
+	if err := row.Scan(&user.Uuid, &user.Username, &user.Email, &user.PasswordHash,
+		&user.Secret2FA, &enabled2FA, &emailVerified); err != nil {
+		return nil, err
+	}
+
+	user.Enabled2FA, user.EmailVerified = bool(enabled2FA), bool(emailVerified)
+	return &user, nil
+}
+
+// flag is a boolean column scanned from any driver. MySQL returns BIT columns
+// as bytes, where "\x00" is false, SQLite returns integers and PostgreSQL
+// booleans.
+type flag bool
+
+// Scan implements the sql.Scanner interface.
+func (f *flag) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case bool:
+		*f = flag(v)
+	case int64:
+		*f = v != 0
+	case []byte:
+		*f = flag(len(v) > 0 && v[0] != 0)
+	case string:
+		*f = flag(len(v) > 0 && v[0] != 0)
+	default:
+		return fmt.Errorf("can't scan %T into a flag", src)
+	}
+	return nil
 }
 
 // String returns string representation of a UserDBEntity.
 func (u UserDBEntity) String() string {
-	return fmt.Sprintf("username: %s | email: %s | enabled 2FA: %v | uuid: %s",
+	return fmt.Sprintf("username: %s | email: %s | enabled 2FA: %v | email verified: %v | uuid: %s",
 		u.Username,
 		u.Email,
 		u.Enabled2FA,
+		u.EmailVerified,
 		u.Uuid.String())
 }
 
@@ -56,3 +100,62 @@ func (u UserModel) String() string {
 		u.Email,
 	)
 }
+
+// RefreshTokenDBEntity is a model for how refresh tokens are represented in
+// database. Only a hash of the token is stored.
+type RefreshTokenDBEntity struct {
+	// TokenHash is a SHA-256 hash of the refresh token, primary key.
+	TokenHash string
+
+	// FamilyID identifies all refresh tokens created by rotations of a token
+	// issued after 2FA.
+	FamilyID string
+
+	// Username of the user to which the token was issued.
+	Username string
+
+	// ExpiresAt is when the token expires.
+	ExpiresAt time.Time
+
+	// Used indicates if the token was already exchanged for new tokens.
+	Used bool
+
+	// Revoked indicates if the token, or its whole family, was revoked.
+	Revoked bool
+}
+
+// String returns string representation of a RefreshTokenDBEntity.
+func (t RefreshTokenDBEntity) String() string {
+	return fmt.Sprintf("username: %s | family: %s | expires: %s | used: %v | revoked: %v",
+		t.Username,
+		t.FamilyID,
+		t.ExpiresAt.Format(time.RFC3339),
+		t.Used,
+		t.Revoked,
+	)
+}
+
+// PasswordResetTokenDBEntity is a model for how password reset tokens are
+// represented in database. Only a hash of the token is stored.
+type PasswordResetTokenDBEntity struct {
+	// TokenHash is a SHA-256 hash of the token, primary key.
+	TokenHash string
+
+	// Username of the user, whose password the token resets.
+	Username string
+
+	// ExpiresAt is when the token expires.
+	ExpiresAt time.Time
+
+	// Used indicates if the token was already used to reset the password.
+	Used bool
+}
+
+// String returns string representation of a PasswordResetTokenDBEntity.
+func (t PasswordResetTokenDBEntity) String() string {
+	return fmt.Sprintf("username: %s | expires: %s | used: %v",
+		t.Username,
+		t.ExpiresAt.Format(time.RFC3339),
+		t.Used,
+	)
+}
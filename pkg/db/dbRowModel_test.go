@@ -12,10 +12,11 @@ func TestUserDBEntity_String(t *testing.T) {
 	username, email, passwdHash := "Johny", "john@foo.bar", "$asdfioj5641684"
 
 	want := fmt.Sprintf(
-		"username: %s | email: %s | enabled 2FA: %v | uuid: %s",
+		"username: %s | email: %s | enabled 2FA: %v | email verified: %v | uuid: %s",
 		username,
 		email,
 		false,
+		false,
 		id.String(),
 	)
 
@@ -35,3 +36,32 @@ func TestUserModel_String(t *testing.T) {
 		t.Errorf("UserModel.String() = %v, want %v", got, want)
 	}
 }
+
+func TestFlagScan(t *testing.T) {
+	testCases := []struct {
+		src  interface{}
+		want bool
+	}{
+		{[]byte("\x01"), true},
+		{[]byte("\x00"), false},
+		{"\x01", true},
+		{int64(1), true},
+		{int64(0), false},
+		{true, true},
+	}
+
+	for _, tc := range testCases {
+		var f flag
+		if err := f.Scan(tc.src); err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+		if bool(f) != tc.want {
+			t.Errorf("Expected %#v to be scanned as %t, but was %t", tc.src, tc.want, f)
+		}
+	}
+
+	var f flag
+	if err := f.Scan(1.5); err == nil {
+		t.Error("Expected error for a float")
+	}
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect describes how a SQL database differs from the others, so queries of
+// all of them are written once, with ? placeholders.
+type dialect struct {
+	// name is the name of the driver and of the directory with migrations.
+	name string
+	// numbered databases use $1, $2, ... placeholders instead of ?.
+	numbered bool
+	// foldsCase databases compare usernames and emails case-insensitively by
+	// their schema, others must compare them by lower(), which their unique
+	// indexes are on.
+	foldsCase bool
+	// insertIgnore and onConflictIgnore are added before the table and after
+	// values of an INSERT ignoring rows with a duplicate key.
+	insertIgnore, onConflictIgnore string
+}
+
+var (
+	// mySQLDialect compares text by a case-insensitive collation.
+	mySQLDialect = dialect{
+		name:         "mysql",
+		foldsCase:    true,
+		insertIgnore: "INSERT IGNORE INTO",
+	}
+	// postgresDialect compares text case-sensitively.
+	postgresDialect = dialect{
+		name:             "postgres",
+		numbered:         true,
+		insertIgnore:     "INSERT INTO",
+		onConflictIgnore: " ON CONFLICT DO NOTHING",
+	}
+	// sqliteDialect compares text by the NOCASE collation.
+	sqliteDialect = dialect{
+		name:         "sqlite",
+		foldsCase:    true,
+		insertIgnore: "INSERT OR IGNORE INTO",
+	}
+)
+
+// dialectOf returns the dialect of the driver.
+func dialectOf(driver string) (dialect, error) {
+	for _, d := range []dialect{mySQLDialect, postgresDialect, sqliteDialect} {
+		if d.name == driver {
+			return d, nil
+		}
+	}
+	return dialect{}, fmt.Errorf("unsupported database driver %q", driver)
+}
+
+// rebind replaces ? placeholders of the query with placeholders of the
+// dialect.
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// equalFold returns a condition comparing the column with a placeholder
+// case-insensitively.
+func (d dialect) equalFold(column string) string {
+	if d.foldsCase {
+		return column + " = ?"
+	}
+	return "lower(" + column + ") = lower(?)"
+}
+
+// insertIgnoring returns an INSERT of the values into the columns of the
+// table, which ignores rows with a duplicate key.
+func (d dialect) insertIgnoring(table, columns, values string) string {
+	return fmt.Sprintf("%s %s (%s) VALUES (%s)%s", d.insertIgnore, table, columns, values, d.onConflictIgnore)
+}
@@ -0,0 +1,41 @@
+package db
+
+import "testing"
+
+func TestDialectRebind(t *testing.T) {
+	query := "DELETE FROM t WHERE a = ? AND b = ?"
+
+	if got := mySQLDialect.rebind(query); got != query {
+		t.Errorf("Expected %q, but was %q", query, got)
+	}
+
+	want := "DELETE FROM t WHERE a = $1 AND b = $2"
+	if got := postgresDialect.rebind(query); got != want {
+		t.Errorf("Expected %q, but was %q", want, got)
+	}
+}
+
+func TestDialectInsertIgnoring(t *testing.T) {
+	testCases := []struct {
+		dialect dialect
+		want    string
+	}{
+		{mySQLDialect, "INSERT IGNORE INTO t (a, b) VALUES (?, ?)"},
+		{postgresDialect, "INSERT INTO t (a, b) VALUES (?, ?) ON CONFLICT DO NOTHING"},
+		{sqliteDialect, "INSERT OR IGNORE INTO t (a, b) VALUES (?, ?)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.dialect.name, func(t *testing.T) {
+			if got := tc.dialect.insertIgnoring("t", "a, b", "?, ?"); got != tc.want {
+				t.Errorf("Expected %q, but was %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDialectOfUnknownDriver(t *testing.T) {
+	if _, err := dialectOf("oracle"); err == nil {
+		t.Error("Expected error for unsupported driver")
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// DuplicateEntryError is returned when saved data violates a unique
+// constraint of a database. Errors of all supported database drivers are
+// translated to it, so the application logic doesn't depend on any driver.
+type DuplicateEntryError struct {
+	// Field is the name of the column with the duplicate value, e.g.
+	// "username" or "email". It is empty if the column couldn't be
+	// identified.
+	Field string
+	// Value is the duplicate value, if the driver reports it.
+	Value string
+	// Err is the original error of the driver.
+	Err error
+}
+
+func (e *DuplicateEntryError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("duplicate entry '%s' for %s", e.Value, e.Field)
+}
+
+func (e *DuplicateEntryError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// mySQLDuplicateEntry is the number of the MySQL error ER_DUP_ENTRY.
+	mySQLDuplicateEntry = 1062
+	// postgresUniqueViolation is the code of the PostgreSQL error
+	// unique_violation.
+	postgresUniqueViolation = "23505"
+	// sqliteUniqueViolation is the extended code of the SQLite error
+	// SQLITE_CONSTRAINT_UNIQUE.
+	sqliteUniqueViolation = 2067
+)
+
+var (
+	// mySQLDuplicateMessage matches messages of the MySQL error 1062, e.g.
+	// "Duplicate entry 'joe' for key 'users.username'".
+	mySQLDuplicateMessage = regexp.MustCompile(`'(.*)' for key '(?:\w+\.)?(\w+)'`)
+	// postgresDuplicateDetail matches details of the PostgreSQL error 23505,
+	// e.g. "Key (username)=(joe) already exists.", or of a unique index on
+	// lower() of a column, e.g. "Key (lower(username::text))=(joe) already
+	// exists.".
+	postgresDuplicateDetail = regexp.MustCompile(`Key \((?:lower\()?(\w+)(?:::\w+)?\)?\)=\((.*)\) already exists`)
+	// sqliteDuplicateMessage matches messages of the SQLite error
+	// SQLITE_CONSTRAINT_UNIQUE, e.g. "UNIQUE constraint failed: users.email".
+	// SQLite doesn't report the duplicate value.
+	sqliteDuplicateMessage = regexp.MustCompile(`UNIQUE constraint failed: \w+\.(\w+)`)
+)
+
+// translateError translates the err of a database driver to a driver
+// independent error. Errors which don't have an equivalent are returned
+// unchanged.
+func translateError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mySQLDuplicateEntry {
+		dup := &DuplicateEntryError{Err: err}
+		if m := mySQLDuplicateMessage.FindStringSubmatch(mysqlErr.Message); m != nil {
+			dup.Value, dup.Field = m[1], m[2]
+		}
+		return dup
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == postgresUniqueViolation {
+		dup := &DuplicateEntryError{Err: err}
+		if m := postgresDuplicateDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+			dup.Field, dup.Value = m[1], m[2]
+		}
+		return dup
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqliteUniqueViolation {
+		dup := &DuplicateEntryError{Err: err}
+		if m := sqliteDuplicateMessage.FindStringSubmatch(sqliteErr.Error()); m != nil {
+			dup.Field = m[1]
+		}
+		return dup
+	}
+
+	return err
+}
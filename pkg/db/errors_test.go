@@ -0,0 +1,86 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestTranslateErrorDuplicateEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantField string
+		wantValue string
+	}{
+		{
+			name:      "MySQLUsername",
+			err:       &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'joe' for key 'users.username'"},
+			wantField: "username",
+			wantValue: "joe",
+		},
+		{
+			name:      "MySQLEmailOldFormat",
+			err:       &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'joe@bar.com' for key 'email'"},
+			wantField: "email",
+			wantValue: "joe@bar.com",
+		},
+		{
+			name:      "MySQLUnknown",
+			err:       &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"},
+			wantField: "",
+			wantValue: "",
+		},
+		{
+			name:      "PostgresUsername",
+			err:       &pq.Error{Code: "23505", Detail: "Key (username)=(joe) already exists."},
+			wantField: "username",
+			wantValue: "joe",
+		},
+		{
+			name:      "PostgresLowerEmail",
+			err:       &pq.Error{Code: "23505", Detail: "Key (lower(email::text))=(joe@bar.com) already exists."},
+			wantField: "email",
+			wantValue: "joe@bar.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := translateError(tt.err)
+
+			var dupErr *DuplicateEntryError
+			if !errors.As(err, &dupErr) {
+				t.Fatalf("Expected DuplicateEntryError, but was %v", err)
+			}
+			if dupErr.Field != tt.wantField {
+				t.Errorf("Expected field %q, but was %q", tt.wantField, dupErr.Field)
+			}
+			if dupErr.Value != tt.wantValue {
+				t.Errorf("Expected value %q, but was %q", tt.wantValue, dupErr.Value)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Error("Expected the driver error to be wrapped")
+			}
+		})
+	}
+}
+
+func TestTranslateErrorOther(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"MySQL", &mysql.MySQLError{Number: 1, Message: "unknown error"}},
+		{"Postgres", &pq.Error{Code: "23503"}},
+		{"Other", errors.New("unknown error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := translateError(tt.err); err != tt.err {
+				t.Errorf("Expected error to be unchanged, but was %v", err)
+			}
+		})
+	}
+}
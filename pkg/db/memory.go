@@ -0,0 +1,441 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryConnection is a DBConnection storing everything in memory, so it is
+// lost on exit. It is safe for concurrent use and has the same semantics as
+// the MySQL schema: usernames and emails are unique case-insensitively,
+// saving a duplicate returns DuplicateEntryError and missing entries return
+// sql.ErrNoRows. Operations never block, so their contexts are ignored. It is
+// meant for tests and single-instance deployments without a database.
+type MemoryConnection struct {
+	mu sync.RWMutex
+	// users are keyed by lowercase usernames.
+	users map[string]*UserDBEntity
+	// emails are lowercase usernames keyed by lowercase emails of users.
+	emails              map[string]string
+	refreshTokens       map[string]*RefreshTokenDBEntity
+	passwordResetTokens map[string]*PasswordResetTokenDBEntity
+	// recoveryCodes are keyed by lowercase usernames, each maps hashes of
+	// codes to whether they were used.
+	recoveryCodes map[string]map[string]bool
+	revocations   map[string]time.Time
+}
+
+// NewMemoryConnection creates an empty MemoryConnection.
+func NewMemoryConnection() *MemoryConnection {
+	return &MemoryConnection{
+		users:               make(map[string]*UserDBEntity),
+		emails:              make(map[string]string),
+		refreshTokens:       make(map[string]*RefreshTokenDBEntity),
+		passwordResetTokens: make(map[string]*PasswordResetTokenDBEntity),
+		recoveryCodes:       make(map[string]map[string]bool),
+		revocations:         make(map[string]time.Time),
+	}
+}
+
+// errSecretNotSet is returned by Get2FASecret, when a user didn't set up 2FA
+// yet, like a MySQL database can't return its NULL secret as a string.
+var errSecretNotSet = errors.New("2FA secret is not set")
+
+// UserByUsername returns a copy of the user with the username. If the username
+// doesn't exist, sql.ErrNoRows error is returned.
+func (m *MemoryConnection) UserByUsername(ctx context.Context, username string) (*UserDBEntity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	found := *user
+	return &found, nil
+}
+
+// UserByEmail returns a copy of the user with the email. If the email isn't
+// used, sql.ErrNoRows error is returned.
+func (m *MemoryConnection) UserByEmail(ctx context.Context, email string) (*UserDBEntity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	username, ok := m.emails[strings.ToLower(email)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	found := *m.users[username]
+	return &found, nil
+}
+
+// SaveUser saves the user with a new UUID. If the username or the email is
+// already used, DuplicateEntryError is returned.
+func (m *MemoryConnection) SaveUser(ctx context.Context, user *UserModel) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	username, email := strings.ToLower(user.Username), strings.ToLower(user.Email)
+	if _, ok := m.users[username]; ok {
+		return &DuplicateEntryError{Field: "username", Value: user.Username}
+	}
+	if _, ok := m.emails[email]; ok {
+		return &DuplicateEntryError{Field: "email", Value: user.Email}
+	}
+
+	m.users[username] = &UserDBEntity{
+		Uuid:         uuid.New(),
+		Username:     user.Username,
+		Email:        user.Email,
+		PasswordHash: user.PasswordHash,
+	}
+	m.emails[email] = username
+
+	return nil
+}
+
+// Save2FASecret saves new secret needed during 2FA. Saving a secret of
+// a non-existent user does nothing.
+func (m *MemoryConnection) Save2FASecret(ctx context.Context, username, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[strings.ToLower(username)]; ok {
+		user.Secret2FA = sql.NullString{String: secret, Valid: true}
+	}
+
+	return nil
+}
+
+// Get2FASecret returns a secret used for 2FA. If the username doesn't exist,
+// sql.ErrNoRows error is returned.
+func (m *MemoryConnection) Get2FASecret(ctx context.Context, username string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if !user.Secret2FA.Valid {
+		return "", errSecretNotSet
+	}
+
+	return user.Secret2FA.String, nil
+}
+
+// UpdateEnabled2FA sets whether the user enabled 2FA. Updating
+// a non-existent user does nothing.
+func (m *MemoryConnection) UpdateEnabled2FA(ctx context.Context, username string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[strings.ToLower(username)]; ok {
+		user.Enabled2FA = enabled
+	}
+
+	return nil
+}
+
+// Enable2FA enables 2FA of the user, if it isn't enabled already. Returns
+// false if it was, or if the username doesn't exist.
+func (m *MemoryConnection) Enable2FA(ctx context.Context, username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[strings.ToLower(username)]
+	if !ok || user.Enabled2FA {
+		return false, nil
+	}
+
+	user.Enabled2FA = true
+	return true, nil
+}
+
+// GetEnabled2FA reports whether the user enabled 2FA. If the username doesn't
+// exist, sql.ErrNoRows error is returned.
+func (m *MemoryConnection) GetEnabled2FA(ctx context.Context, username string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+
+	return user.Enabled2FA, nil
+}
+
+// UpdateEmailVerified sets whether the user verified the email address.
+// Updating a non-existent user does nothing.
+func (m *MemoryConnection) UpdateEmailVerified(ctx context.Context, username string, verified bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[strings.ToLower(username)]; ok {
+		user.EmailVerified = verified
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the password hash of the user. Updating
+// a non-existent user does nothing.
+func (m *MemoryConnection) UpdatePassword(ctx context.Context, username, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[strings.ToLower(username)]; ok {
+		user.PasswordHash = passwordHash
+	}
+
+	return nil
+}
+
+// SaveRefreshToken saves a copy of the token. The token must belong to an
+// existing user and its hash must be unique.
+func (m *MemoryConnection) SaveRefreshToken(ctx context.Context, token *RefreshTokenDBEntity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[strings.ToLower(token.Username)]; !ok {
+		return fmt.Errorf("refresh token of unknown user %q", token.Username)
+	}
+	if _, ok := m.refreshTokens[token.TokenHash]; ok {
+		return &DuplicateEntryError{Field: "tokenHash", Value: token.TokenHash}
+	}
+
+	saved := *token
+	m.refreshTokens[token.TokenHash] = &saved
+
+	return nil
+}
+
+// RefreshTokenByHash returns a copy of the token with the hash. If the token
+// doesn't exist, sql.ErrNoRows error is returned.
+func (m *MemoryConnection) RefreshTokenByHash(ctx context.Context, hash string) (*RefreshTokenDBEntity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.refreshTokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	found := *token
+	return &found, nil
+}
+
+// UseRefreshToken marks a refresh token as used. Returns false if the token
+// was already used, or it doesn't exist.
+func (m *MemoryConnection) UseRefreshToken(ctx context.Context, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[hash]
+	if !ok || token.Used {
+		return false, nil
+	}
+
+	token.Used = true
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens in the family.
+func (m *MemoryConnection) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.refreshTokens {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+		}
+	}
+
+	return nil
+}
+
+// RefreshTokenFamilies returns IDs of families of refresh tokens of the user,
+// which are neither revoked nor expired.
+func (m *MemoryConnection) RefreshTokenFamilies(ctx context.Context, username string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var families []string
+	for _, token := range m.refreshTokens {
+		if !strings.EqualFold(token.Username, username) || token.Revoked || !token.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		if !seen[token.FamilyID] {
+			seen[token.FamilyID] = true
+			families = append(families, token.FamilyID)
+		}
+	}
+
+	return families, nil
+}
+
+// SavePasswordResetToken saves a copy of the token. The token must belong to
+// an existing user and its hash must be unique.
+func (m *MemoryConnection) SavePasswordResetToken(ctx context.Context, token *PasswordResetTokenDBEntity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[strings.ToLower(token.Username)]; !ok {
+		return fmt.Errorf("password reset token of unknown user %q", token.Username)
+	}
+	if _, ok := m.passwordResetTokens[token.TokenHash]; ok {
+		return &DuplicateEntryError{Field: "tokenHash", Value: token.TokenHash}
+	}
+
+	saved := *token
+	m.passwordResetTokens[token.TokenHash] = &saved
+
+	return nil
+}
+
+// PasswordResetTokenByHash returns a copy of the token with the hash. If the
+// token doesn't exist, sql.ErrNoRows error is returned.
+func (m *MemoryConnection) PasswordResetTokenByHash(ctx context.Context, hash string) (*PasswordResetTokenDBEntity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	token, ok := m.passwordResetTokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	found := *token
+	return &found, nil
+}
+
+// UsePasswordResetToken marks a password reset token as used. Returns false
+// if the token was already used, or it doesn't exist.
+func (m *MemoryConnection) UsePasswordResetToken(ctx context.Context, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.passwordResetTokens[hash]
+	if !ok || token.Used {
+		return false, nil
+	}
+
+	token.Used = true
+	return true, nil
+}
+
+// DeletePasswordResetTokens deletes all password reset tokens of the user.
+func (m *MemoryConnection) DeletePasswordResetTokens(ctx context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.passwordResetTokens {
+		if strings.EqualFold(token.Username, username) {
+			delete(m.passwordResetTokens, hash)
+		}
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces all 2FA recovery codes of the user with new
+// ones, specified by their hashes. The user must exist.
+func (m *MemoryConnection) ReplaceRecoveryCodes(ctx context.Context, username string, hashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := strings.ToLower(username)
+	if _, ok := m.users[key]; !ok {
+		return fmt.Errorf("recovery codes of unknown user %q", username)
+	}
+
+	codes := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = false
+	}
+	m.recoveryCodes[key] = codes
+
+	return nil
+}
+
+// UseRecoveryCode marks a 2FA recovery code of the user as used. Returns
+// false if the user has no such unused code.
+func (m *MemoryConnection) UseRecoveryCode(ctx context.Context, username, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := m.recoveryCodes[strings.ToLower(username)]
+	if used, ok := codes[hash]; !ok || used {
+		return false, nil
+	}
+
+	codes[hash] = true
+	return true, nil
+}
+
+// RecoveryCodesRemaining returns a number of unused 2FA recovery codes of the
+// user.
+func (m *MemoryConnection) RecoveryCodesRemaining(ctx context.Context, username string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	remaining := 0
+	for _, used := range m.recoveryCodes[strings.ToLower(username)] {
+		if !used {
+			remaining++
+		}
+	}
+
+	return remaining, nil
+}
+
+// RevokeToken saves an ID of a revoked JWT, until the JWT expires. Revoking
+// an already revoked JWT is not an error.
+func (m *MemoryConnection) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.revocations[jti]; !ok {
+		m.revocations[jti] = expiresAt
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether a non-expired JWT with the ID was revoked.
+func (m *MemoryConnection) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	exp, ok := m.revocations[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// DeleteExpiredRevocations deletes revocations of already expired JWTs.
+func (m *MemoryConnection) DeleteExpiredRevocations(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for jti, exp := range m.revocations {
+		if !time.Now().Before(exp) {
+			delete(m.revocations, jti)
+		}
+	}
+
+	return nil
+}
+
+// Ping always succeeds, the memory is always reachable.
+func (m *MemoryConnection) Ping(ctx context.Context) error {
+	return nil
+}
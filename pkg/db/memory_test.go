@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryConnectionConcurrentSaveUser(t *testing.T) {
+	conn := NewMemoryConnection()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	saved, duplicates := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := conn.SaveUser(context.Background(), &UserModel{
+				Username:     "James",
+				Email:        fmt.Sprintf("james%d@bar.com", i),
+				PasswordHash: "hash",
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			var dupErr *DuplicateEntryError
+			if err == nil {
+				saved++
+			} else if errors.As(err, &dupErr) {
+				duplicates++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if saved != 1 || duplicates != 19 {
+		t.Errorf("Expected 1 saved user and 19 duplicates, but was %d and %d", saved, duplicates)
+	}
+}
+
+func TestMemoryConnectionReturnsCopies(t *testing.T) {
+	conn := NewMemoryConnection()
+	conn.SaveUser(context.Background(), &model)
+
+	user, _ := conn.UserByUsername(context.Background(), model.Username)
+	user.Enabled2FA = true
+
+	if enabled, _ := conn.GetEnabled2FA(context.Background(), model.Username); enabled {
+		t.Error("Modifying a returned user should not modify the stored one")
+	}
+}
+
+func TestMemoryConnectionRefreshTokenOfUnknownUser(t *testing.T) {
+	conn := NewMemoryConnection()
+
+	err := conn.SaveRefreshToken(context.Background(), &RefreshTokenDBEntity{
+		TokenHash: "hash",
+		FamilyID:  "family",
+		Username:  "Unknown",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	if err == nil {
+		t.Error("Expected error for refresh token of unknown user")
+	}
+}
+
+func TestConnectMemory(t *testing.T) {
+	conn, err := Connect("memory", "", Options{})
+
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if _, ok := conn.(*MemoryConnection); !ok {
+		t.Errorf("Expected MemoryConnection, but was %T", conn)
+	}
+}
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles are numbered up and down migrations of every driver, e.g.
+// migrations/mysql/0001_create_users.up.sql. Every change of a schema must be
+// a new migration, applied ones must never be modified.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFileName matches names of migration files, capturing the version,
+// the name and the direction.
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrNoMigrations is returned by Migrator.Down when no migration is applied.
+var ErrNoMigrations = errors.New("no migration is applied")
+
+// LegacySchemaVersion is the version of the schema created by the
+// SQL/CreateTable.sql scripts used before migrations, with only the users
+// table.
+const LegacySchemaVersion = 1
+
+// Migration is a versioned change of a database schema.
+type Migration struct {
+	// Version orders migrations, they are applied in ascending order.
+	Version int
+	// Name describes the change.
+	Name string
+	// Up applies the change and Down reverts it.
+	Up, Down string
+}
+
+// MigrationStatus is a migration with the time when it was applied, which is
+// zero if the migration is pending.
+type MigrationStatus struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations to a database and records applied versions in
+// the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator of the database behind the conn established
+// by Connect. A memory database has no schema, so an error is returned for
+// it.
+func NewMigrator(conn DBConnection) (*Migrator, error) {
+	c, ok := conn.(*connection)
+	if !ok {
+		return nil, fmt.Errorf("%T has no schema to migrate", conn)
+	}
+
+	migrations, err := loadMigrations(c.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: c.DB, dialect: c.dialect, migrations: migrations}, nil
+}
+
+// Up applies all pending migrations in order and returns them. Every migration
+// is applied in a transaction with recording its version, but MySQL commits
+// schema changes implicitly, so a failed MySQL migration may need a manual
+// fix.
+func (m *Migrator) Up() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, s := range statuses {
+		if !s.AppliedAt.IsZero() {
+			continue
+		}
+
+		err := m.apply(s.Version, s.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(
+				m.dialect.rebind("INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)"),
+				s.Version,
+				s.Name,
+				time.Now().Unix(),
+			)
+			return err
+		})
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, s.Migration)
+	}
+
+	return applied, nil
+}
+
+// Down reverts the last applied migration and returns it. If no migration is
+// applied, ErrNoMigrations is returned.
+func (m *Migrator) Down() (*Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(statuses) - 1; i >= 0; i-- {
+		s := statuses[i]
+		if s.AppliedAt.IsZero() {
+			continue
+		}
+
+		err := m.apply(s.Version, s.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(m.dialect.rebind("DELETE FROM schema_migrations WHERE version = ?"), s.Version)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s.Migration, nil
+	}
+
+	return nil, ErrNoMigrations
+}
+
+// Baseline records migrations up to the version as applied, without running
+// them, and returns them. It adopts a database whose schema was created
+// before migrations, so that Up applies only the later ones. The database
+// must have the users table and no applied migration.
+func (m *Migrator) Baseline(version int) ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var baseline []Migration
+	for _, s := range statuses {
+		if !s.AppliedAt.IsZero() {
+			return nil, fmt.Errorf("migration %04d is already applied", s.Version)
+		}
+		if s.Version <= version {
+			baseline = append(baseline, s.Migration)
+		}
+	}
+	if len(baseline) == 0 || baseline[len(baseline)-1].Version != version {
+		return nil, fmt.Errorf("unknown migration %04d", version)
+	}
+
+	var users int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		return nil, fmt.Errorf("database has no schema to baseline: %w", err)
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, migration := range baseline {
+		_, err := tx.Exec(
+			m.dialect.rebind("INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)"),
+			migration.Version,
+			migration.Name,
+			time.Now().Unix(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return baseline, tx.Commit()
+}
+
+// Status returns all known migrations in order, with times when they were
+// applied. The schema_migrations table is created if it doesn't exist. If
+// the database has applied a version unknown to this binary, which was
+// probably built from an older source, an error is returned.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	_, err := m.db.Exec(
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, appliedAt BIGINT NOT NULL)",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query("SELECT version, appliedAt FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = time.Unix(at, 0)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		statuses = append(statuses, MigrationStatus{Migration: migration, AppliedAt: appliedAt[migration.Version]})
+		delete(appliedAt, migration.Version)
+	}
+	if len(appliedAt) > 0 {
+		return nil, fmt.Errorf("database has %d migrations unknown to this version of the application", len(appliedAt))
+	}
+
+	return statuses, nil
+}
+
+// apply executes statements of the script and the record function in
+// a transaction.
+func (m *Migrator) apply(version int, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %04d: %w", version, err)
+		}
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("migration %04d: %w", version, err)
+	}
+
+	return tx.Commit()
+}
+
+// statements splits the script into single statements, because not all
+// drivers can execute multiple statements at once. Comment lines are dropped,
+// MySQL rejects a statement consisting only of comments.
+func statements(script string) []string {
+	var code []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			code = append(code, line)
+		}
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(code, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// loadMigrations loads embedded migrations of the driver, sorted by their
+// versions. Every migration must have both up and down files.
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %04d has two names, %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// migrateUp applies all pending migrations to the database behind the conn.
+func migrateUp(conn DBConnection) error {
+	m, err := NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.Up()
+	return err
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSQLiteWithoutSchema opens a new SQLite database, which is not migrated
+// yet.
+func newSQLiteWithoutSchema(t *testing.T) *connection {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "users.db")))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return &connection{DB: db, dialect: sqliteDialect}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	conn := newSQLiteWithoutSchema(t)
+	m, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if len(applied) != len(m.migrations) {
+		t.Errorf("Expected %d applied migrations, but was %d", len(m.migrations), len(applied))
+	}
+	if err := conn.SaveUser(context.Background(), &model); err != nil {
+		t.Errorf("Expected migrated schema, but %q", err.Error())
+	}
+
+	if applied, _ := m.Up(); len(applied) != 0 {
+		t.Errorf("Expected no migration to be applied again, but was %d", len(applied))
+	}
+
+	reverted, err := m.Down()
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	last := m.migrations[len(m.migrations)-1]
+	if reverted.Version != last.Version {
+		t.Errorf("Expected last migration %04d to be reverted, but was %04d", last.Version, reverted.Version)
+	}
+
+	statuses, _ := m.Status()
+	for i, s := range statuses {
+		pending := s.AppliedAt.IsZero()
+		if wantPending := i == len(statuses)-1; pending != wantPending {
+			t.Errorf("Migration %04d, expected pending %v, but was %v", s.Version, wantPending, pending)
+		}
+	}
+
+	for range m.migrations[1:] {
+		if _, err := m.Down(); err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+	}
+	if _, err := m.Down(); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("Expected ErrNoMigrations, but was %v", err)
+	}
+	if _, err := conn.UserByUsername(context.Background(), model.Username); err == nil {
+		t.Error("Expected users table to be dropped")
+	}
+}
+
+func TestMigrationWidenPasswordHash(t *testing.T) {
+	ctx := context.Background()
+	conn := newSQLiteWithoutSchema(t)
+	m, _ := NewMigrator(conn)
+	m.migrations = m.migrations[:5]
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	conn.SaveUser(ctx, &model)
+	token := &RefreshTokenDBEntity{TokenHash: "hash", FamilyID: "family", Username: model.Username, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := conn.SaveRefreshToken(ctx, token); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	m.migrations, _ = loadMigrations("sqlite")
+	if _, err := m.Up(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	argon2Hash := "$argon2id$v=19$m=65536,t=3,p=4$" + strings.Repeat("s", 22) + "$" + strings.Repeat("h", 43)
+	if err := conn.UpdatePassword(ctx, model.Username, argon2Hash); err != nil {
+		t.Errorf("Expected a long hash to fit, but %q", err.Error())
+	}
+	if _, err := conn.RefreshTokenByHash(ctx, token.TokenHash); err != nil {
+		t.Errorf("Expected refresh token to survive the migration, but %q", err.Error())
+	}
+	if err := conn.SaveUser(ctx, &UserModel{Username: model.Username, Email: "other@bar.com", PasswordHash: "hash"}); err == nil {
+		t.Error("Expected usernames to stay unique")
+	}
+
+	for len(m.migrations) > 5 {
+		if _, err := m.Down(); err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+		m.migrations = m.migrations[:len(m.migrations)-1]
+	}
+	if user, err := conn.UserByUsername(ctx, model.Username); err != nil || user.PasswordHash != argon2Hash {
+		t.Errorf("Expected a long hash to survive the down migration, but was %v, %v", user, err)
+	}
+}
+
+func TestMigratorBaseline(t *testing.T) {
+	conn := newSQLiteWithoutSchema(t)
+	m, _ := NewMigrator(conn)
+
+	if _, err := m.Baseline(LegacySchemaVersion); err == nil {
+		t.Error("Expected error when database has no schema")
+	}
+
+	// schema created by SQL/CreateTable.sql before migrations
+	for _, migration := range m.migrations[:LegacySchemaVersion] {
+		for _, stmt := range statements(migration.Up) {
+			if _, err := conn.Exec(stmt); err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+		}
+	}
+
+	baseline, err := m.Baseline(LegacySchemaVersion)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if len(baseline) != LegacySchemaVersion {
+		t.Errorf("Expected %d recorded migrations, but was %d", LegacySchemaVersion, len(baseline))
+	}
+	if _, err := m.Baseline(LegacySchemaVersion); err == nil {
+		t.Error("Expected error when migrations are already applied")
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if len(applied) != len(m.migrations)-LegacySchemaVersion {
+		t.Errorf("Expected %d applied migrations, but was %d", len(m.migrations)-LegacySchemaVersion, len(applied))
+	}
+	if err := conn.SaveUser(context.Background(), &model); err != nil {
+		t.Errorf("Expected migrated schema, but %q", err.Error())
+	}
+	token := &RefreshTokenDBEntity{TokenHash: "hash", FamilyID: "family", Username: model.Username, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := conn.SaveRefreshToken(context.Background(), token); err != nil {
+		t.Errorf("Expected refresh tokens table to be created, but %q", err.Error())
+	}
+}
+
+func TestMigratorUnknownVersion(t *testing.T) {
+	conn := newSQLiteWithoutSchema(t)
+	m, _ := NewMigrator(conn)
+	m.Up()
+
+	m.migrations = m.migrations[:1]
+	if _, err := m.Status(); err == nil {
+		t.Error("Expected error when database has unknown migrations")
+	}
+}
+
+func TestNewMigratorMemory(t *testing.T) {
+	if _, err := NewMigrator(NewMemoryConnection()); err == nil {
+		t.Error("Expected error for memory database")
+	}
+}
+
+func TestLoadMigrationsOfAllDrivers(t *testing.T) {
+	var want []int
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := loadMigrations(driver)
+		if err != nil {
+			t.Fatalf("%s: err was not nil, %q", driver, err.Error())
+		}
+
+		var versions []int
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s: expected migration %04d, but was %04d", driver, i+1, m.Version)
+			}
+			versions = append(versions, m.Version)
+		}
+
+		// every driver must have the same migrations
+		if want == nil {
+			want = versions
+		} else if !reflect.DeepEqual(versions, want) {
+			t.Errorf("%s: expected versions %v, but was %v", driver, want, versions)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	got := statements("-- table a\nCREATE TABLE a(x INT);\nCREATE INDEX ON a (x);\n")
+
+	want := []string{"CREATE TABLE a(x INT)", "CREATE INDEX ON a (x)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, but was %q", want, got)
+	}
+
+	if got := statements("-- nothing to do\n"); len(got) != 0 {
+		t.Errorf("Expected no statements, but was %q", got)
+	}
+}
@@ -0,0 +1,10 @@
+CREATE TABLE refresh_tokens(
+    tokenHash CHAR(64) NOT NULL PRIMARY KEY,
+    familyID VARCHAR(36) NOT NULL,
+    username VARCHAR(30) NOT NULL,
+    expiresAt BIGINT NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX (familyID),
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
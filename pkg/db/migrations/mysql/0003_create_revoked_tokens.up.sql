@@ -0,0 +1,5 @@
+CREATE TABLE revoked_tokens(
+    jti VARCHAR(36) NOT NULL PRIMARY KEY,
+    expiresAt BIGINT NOT NULL,
+    INDEX (expiresAt)
+);
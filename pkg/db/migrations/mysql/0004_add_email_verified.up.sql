@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN emailVerified BIT NOT NULL DEFAULT 0;
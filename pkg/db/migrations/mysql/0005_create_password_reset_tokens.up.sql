@@ -0,0 +1,7 @@
+CREATE TABLE password_reset_tokens(
+    tokenHash CHAR(64) NOT NULL PRIMARY KEY,
+    username VARCHAR(30) NOT NULL,
+    expiresAt BIGINT NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE users MODIFY passwordHash VARCHAR(255) BINARY NOT NULL;
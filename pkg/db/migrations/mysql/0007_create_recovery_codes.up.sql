@@ -0,0 +1,6 @@
+CREATE TABLE recovery_codes(
+    codeHash CHAR(64) NOT NULL PRIMARY KEY,
+    username VARCHAR(30) NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (username) REFERENCES users(username) ON DELETE CASCADE
+);
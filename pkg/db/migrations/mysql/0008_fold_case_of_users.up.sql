@@ -0,0 +1,2 @@
+-- Usernames and emails are already unique case-insensitively, by the
+-- collation of the columns. Only PostgreSQL needs the change.
@@ -0,0 +1,8 @@
+CREATE TABLE users(
+    uuid UUID DEFAULT gen_random_uuid() NOT NULL PRIMARY KEY,
+    username VARCHAR(30) NOT NULL UNIQUE,
+    email VARCHAR(320) NOT NULL UNIQUE,
+    passwordHash CHAR(60) NOT NULL,
+    secret2FA CHAR(16),
+    enabled2FA BOOLEAN NOT NULL DEFAULT FALSE
+);
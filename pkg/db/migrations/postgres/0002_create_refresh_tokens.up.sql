@@ -0,0 +1,9 @@
+CREATE TABLE refresh_tokens(
+    tokenHash CHAR(64) NOT NULL PRIMARY KEY,
+    familyID VARCHAR(36) NOT NULL,
+    username VARCHAR(30) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    expiresAt BIGINT NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX refresh_tokens_familyID ON refresh_tokens (familyID);
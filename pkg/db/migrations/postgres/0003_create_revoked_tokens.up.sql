@@ -0,0 +1,5 @@
+CREATE TABLE revoked_tokens(
+    jti VARCHAR(36) NOT NULL PRIMARY KEY,
+    expiresAt BIGINT NOT NULL
+);
+CREATE INDEX revoked_tokens_expiresAt ON revoked_tokens (expiresAt);
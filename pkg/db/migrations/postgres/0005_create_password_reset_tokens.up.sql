@@ -0,0 +1,6 @@
+CREATE TABLE password_reset_tokens(
+    tokenHash CHAR(64) NOT NULL PRIMARY KEY,
+    username VARCHAR(30) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    expiresAt BIGINT NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE
+);
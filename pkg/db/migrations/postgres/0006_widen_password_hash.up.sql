@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN passwordHash TYPE VARCHAR(255);
@@ -0,0 +1,5 @@
+CREATE TABLE recovery_codes(
+    codeHash CHAR(64) NOT NULL PRIMARY KEY,
+    username VARCHAR(30) NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    used BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,2 @@
+DROP INDEX users_lower_email;
+DROP INDEX users_lower_username;
@@ -0,0 +1,6 @@
+-- Usernames and emails are unique case-insensitively, like in the MySQL and
+-- SQLite schemas. The unique constraint of username stays, foreign keys
+-- reference it. Fails if the table already has names differing only in case,
+-- which must be merged manually first.
+CREATE UNIQUE INDEX users_lower_username ON users (lower(username));
+CREATE UNIQUE INDEX users_lower_email ON users (lower(email));
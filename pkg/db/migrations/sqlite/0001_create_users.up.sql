@@ -0,0 +1,11 @@
+-- Same semantics as the MySQL schema: usernames and emails are unique
+-- case-insensitively and lengths of columns are limited. UUIDs of users are
+-- generated by the application.
+CREATE TABLE users(
+    uuid TEXT NOT NULL PRIMARY KEY CHECK (length(uuid) = 36),
+    username TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (length(username) <= 30),
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (length(email) <= 320),
+    passwordHash TEXT NOT NULL CHECK (length(passwordHash) <= 60),
+    secret2FA TEXT CHECK (length(secret2FA) <= 16),
+    enabled2FA INTEGER NOT NULL DEFAULT 0 CHECK (enabled2FA IN (0, 1))
+);
@@ -0,0 +1,9 @@
+CREATE TABLE refresh_tokens(
+    tokenHash TEXT NOT NULL PRIMARY KEY CHECK (length(tokenHash) <= 64),
+    familyID TEXT NOT NULL CHECK (length(familyID) <= 36),
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    expiresAt INTEGER NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    revoked INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX refresh_tokens_familyID ON refresh_tokens (familyID);
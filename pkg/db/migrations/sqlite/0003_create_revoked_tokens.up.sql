@@ -0,0 +1,5 @@
+CREATE TABLE revoked_tokens(
+    jti TEXT NOT NULL PRIMARY KEY CHECK (length(jti) <= 36),
+    expiresAt INTEGER NOT NULL
+);
+CREATE INDEX revoked_tokens_expiresAt ON revoked_tokens (expiresAt);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN emailVerified INTEGER NOT NULL DEFAULT 0 CHECK (emailVerified IN (0, 1));
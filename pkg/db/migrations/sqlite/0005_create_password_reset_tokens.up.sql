@@ -0,0 +1,6 @@
+CREATE TABLE password_reset_tokens(
+    tokenHash TEXT NOT NULL PRIMARY KEY CHECK (length(tokenHash) <= 64),
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    expiresAt INTEGER NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,3 @@
+-- The column isn't narrowed back, Argon2id hashes don't fit into 60
+-- characters and would be truncated or fail the migration. The wider column
+-- works with bcrypt hashes too.
@@ -0,0 +1,21 @@
+-- SQLite can't change a CHECK constraint, so the table is rebuilt. Dropping
+-- users deletes tokens referencing it, so they are copied back afterwards.
+CREATE TABLE users_new(
+    uuid TEXT NOT NULL PRIMARY KEY CHECK (length(uuid) = 36),
+    username TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (length(username) <= 30),
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (length(email) <= 320),
+    passwordHash TEXT NOT NULL CHECK (length(passwordHash) <= 255),
+    secret2FA TEXT CHECK (length(secret2FA) <= 16),
+    enabled2FA INTEGER NOT NULL DEFAULT 0 CHECK (enabled2FA IN (0, 1)),
+    emailVerified INTEGER NOT NULL DEFAULT 0 CHECK (emailVerified IN (0, 1))
+);
+INSERT INTO users_new (uuid, username, email, passwordHash, secret2FA, enabled2FA, emailVerified)
+    SELECT uuid, username, email, passwordHash, secret2FA, enabled2FA, emailVerified FROM users;
+CREATE TEMP TABLE refresh_tokens_copy AS SELECT * FROM refresh_tokens;
+CREATE TEMP TABLE password_reset_tokens_copy AS SELECT * FROM password_reset_tokens;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+INSERT INTO refresh_tokens SELECT * FROM refresh_tokens_copy;
+INSERT INTO password_reset_tokens SELECT * FROM password_reset_tokens_copy;
+DROP TABLE refresh_tokens_copy;
+DROP TABLE password_reset_tokens_copy;
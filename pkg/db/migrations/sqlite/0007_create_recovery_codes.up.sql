@@ -0,0 +1,5 @@
+CREATE TABLE recovery_codes(
+    codeHash TEXT NOT NULL PRIMARY KEY CHECK (length(codeHash) <= 64),
+    username TEXT NOT NULL REFERENCES users(username) ON DELETE CASCADE,
+    used INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// newPostgresMock returns a postgresConnection to a stub database, which is
+// closed when the test finishes.
+func newPostgresMock(t *testing.T) (*connection, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &connection{DB: db, dialect: postgresDialect}, mock
+}
+
+func TestPostgresSaveUser(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+
+	mock.ExpectExec(`INSERT INTO users \(.+\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\)`).
+		WithArgs(sqlmock.AnyArg(), model.Username, model.Email, model.PasswordHash, nil, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := pg.SaveUser(context.Background(), &model); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresSaveUserDuplicate(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+
+	mock.ExpectExec("INSERT INTO users").
+		WillReturnError(&pq.Error{
+			Code:       "23505",
+			Constraint: "users_email_key",
+			Detail:     "Key (email)=(jam@bar.com) already exists.",
+		})
+
+	err := pg.SaveUser(context.Background(), &model)
+
+	var dupErr *DuplicateEntryError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("Expected DuplicateEntryError, but was %v", err)
+	}
+	if dupErr.Field != "email" || dupErr.Value != model.Email {
+		t.Errorf("Expected duplicate email %s, but was %s %s", model.Email, dupErr.Field, dupErr.Value)
+	}
+}
+
+func TestPostgresUserByUsername(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+	columns := []string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE lower\(username\) = lower\(\$1\)`).
+		WithArgs(model.Username).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(
+			"5f3c7e5a-5b4b-4c8a-9d1e-2f6a7b8c9d0e", model.Username, model.Email,
+			model.PasswordHash, nil, true, false))
+
+	user, err := pg.UserByUsername(context.Background(), model.Username)
+
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if user.Uuid.String() != "5f3c7e5a-5b4b-4c8a-9d1e-2f6a7b8c9d0e" {
+		t.Errorf("Expected uuid %s, but was %s", "5f3c7e5a-5b4b-4c8a-9d1e-2f6a7b8c9d0e", user.Uuid)
+	}
+	if !user.Enabled2FA || user.Secret2FA.Valid {
+		t.Errorf("Expected enabled 2FA without secret, but was %s", user)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresGetEnabled2FA(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+
+	mock.ExpectQuery(`SELECT enabled2FA FROM users WHERE users.username = \$1`).
+		WithArgs(model.Username).
+		WillReturnRows(sqlmock.NewRows([]string{"enabled2FA"}).AddRow(true))
+
+	enabled, err := pg.GetEnabled2FA(context.Background(), model.Username)
+
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if !enabled {
+		t.Error("Expected 2FA to be enabled")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresEnable2FA(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+
+	mock.ExpectExec(`UPDATE users SET enabled2FA = TRUE WHERE username = \$1 AND enabled2FA = FALSE`).
+		WithArgs(model.Username).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	enabled, err := pg.Enable2FA(context.Background(), model.Username)
+
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if !enabled {
+		t.Error("Expected 2FA to be enabled")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresUserByEmailIgnoresCase(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+	columns := []string{"uuid", "username", "email", "passwordHash", "secret2FA", "enabled2FA", "emailVerified"}
+
+	mock.ExpectQuery(`SELECT (.+) FROM users WHERE lower\(email\) = lower\(\$1\)`).
+		WithArgs("JAM@bar.com").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(
+			"5f3c7e5a-5b4b-4c8a-9d1e-2f6a7b8c9d0e", model.Username, model.Email,
+			model.PasswordHash, nil, false, true))
+
+	user, err := pg.UserByEmail(context.Background(), "JAM@bar.com")
+
+	if err != nil {
+		t.Fatalf("error was not expected: %s", err)
+	}
+	if user.Username != model.Username || !user.EmailVerified {
+		t.Errorf("Expected user %s with verified email, but was %s", model.Username, user)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresUseRefreshToken(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+
+	mock.ExpectExec(`UPDATE refresh_tokens SET used = TRUE WHERE tokenHash = \$1 AND used = FALSE`).
+		WithArgs("hash").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	used, err := pg.UseRefreshToken(context.Background(), "hash")
+
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if used {
+		t.Error("Expected already used token not to be used again")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresRevokeToken(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+	expiresAt := time.Unix(1700000000, 0)
+
+	mock.ExpectExec(`INSERT INTO revoked_tokens (.+) ON CONFLICT DO NOTHING`).
+		WithArgs("jti", expiresAt.Unix()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := pg.RevokeToken(context.Background(), "jti", expiresAt); err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPostgresUseRecoveryCode(t *testing.T) {
+	pg, mock := newPostgresMock(t)
+
+	mock.ExpectExec(`UPDATE recovery_codes SET used = TRUE WHERE codeHash = \$1 AND username = \$2 AND used = FALSE`).
+		WithArgs("hash", model.Username).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	used, err := pg.UseRecoveryCode(context.Background(), model.Username, "hash")
+
+	if err != nil {
+		t.Errorf("error was not expected: %s", err)
+	}
+	if !used {
+		t.Error("Expected unused code to be used")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
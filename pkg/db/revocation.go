@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// revocationPurgeInterval is how often revocations of expired tokens are
+// deleted from a database.
+const revocationPurgeInterval = time.Minute
+
+// RevocationStore is a store of revoked JWTs backed by a database, shared by
+// all instances of the application. It implements security.RevocationStore.
+type RevocationStore struct {
+	conn DBConnection
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewRevocationStore creates a RevocationStore using the conn.
+func NewRevocationStore(conn DBConnection) *RevocationStore {
+	return &RevocationStore{conn: conn, lastPurge: time.Now()}
+}
+
+// Revoke saves the jti of a revoked token until expiresAt. Revocations of
+// expired tokens are periodically deleted.
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.purge(ctx)
+	return s.conn.RevokeToken(ctx, jti, expiresAt)
+}
+
+// IsRevoked reports whether a token with the jti was revoked.
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.conn.IsTokenRevoked(ctx, jti)
+}
+
+// purge deletes revocations of expired tokens, if the last purge was longer
+// than revocationPurgeInterval ago.
+func (s *RevocationStore) purge(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastPurge) < revocationPurgeInterval {
+		return
+	}
+	s.lastPurge = time.Now()
+
+	if err := s.conn.DeleteExpiredRevocations(ctx); err != nil {
+		fmt.Printf("Deleting expired revocations failed: %s\n", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Package mail sends emails to users, like links for verification of their
+// email addresses. Mailer is implemented by SMTPMailer, for production, and
+// by FileMailer, which only writes emails for local development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	// To is an address of the recipient.
+	To string
+	// Subject of the email, may contain non-ASCII characters.
+	Subject string
+	// Body is a plain text content of the email.
+	Body string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	// Send sends the msg. It returns when the msg is accepted for delivery,
+	// or when the ctx is done.
+	Send(ctx context.Context, msg Message) error
+}
+
+// format returns the msg with headers, including the From address, as sent
+// over SMTP. Headers containing line breaks are rejected, so a user can't
+// inject own headers, e.g. with a crafted email address.
+func format(from string, msg Message, date time.Time) ([]byte, error) {
+	for name, value := range map[string]string{"From": from, "To": msg.To, "Subject": msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%s header contains a line break", name)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if !strings.HasSuffix(body, "\n") {
+		b.WriteString("\r\n")
+	}
+
+	return b.Bytes(), nil
+}
+
+// FileMailer writes emails into a writer instead of sending them, e.g. to
+// the standard output or a file, for local development. It is safe for
+// concurrent use.
+type FileMailer struct {
+	// From is an address of the sender.
+	From string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFileMailer creates a FileMailer writing emails from the address into
+// the w.
+func NewFileMailer(from string, w io.Writer) *FileMailer {
+	return &FileMailer{From: from, w: w}
+}
+
+// Send writes the msg, followed by an empty line, so emails are separated.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = m.w.Write(append(data, "\r\n"...))
+	return err
+}
@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+var msg = Message{To: "susan@barz.com", Subject: "Verify your email", Body: "Hi,\nyour token is abc.\n"}
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	data, err := format("go-auth@localhost", msg, date)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	want := "From: go-auth@localhost\r\n" +
+		"To: susan@barz.com\r\n" +
+		"Subject: Verify your email\r\n" +
+		"Date: Wed, 01 Jun 2022 12:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Hi,\r\nyour token is abc.\r\n"
+	if string(data) != want {
+		t.Errorf("Expected %q, but was %q", want, data)
+	}
+}
+
+func TestFormatEncodesSubject(t *testing.T) {
+	data, _ := format("go-auth@localhost", Message{To: msg.To, Subject: "Potvrďte email", Body: msg.Body}, time.Now())
+
+	if !strings.Contains(string(data), "Subject: =?utf-8?q?Potvr=C4=8Fte_email?=\r\n") {
+		t.Errorf("Expected encoded subject, but was %q", data)
+	}
+}
+
+func TestFormatRejectsLineBreaks(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		msg  Message
+	}{
+		{"From", "go-auth@localhost\r\nBcc: eve@evil.com", msg},
+		{"To", "go-auth@localhost", Message{To: "susan@barz.com\nBcc: eve@evil.com", Subject: msg.Subject}},
+		{"Subject", "go-auth@localhost", Message{To: msg.To, Subject: "Hi\r\nBcc: eve@evil.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := format(tt.from, tt.msg, time.Now()); err == nil {
+				t.Error("error was expected")
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewFileMailer("go-auth@localhost", &buf)
+
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if n := strings.Count(buf.String(), "To: susan@barz.com\r\n"); n != 2 {
+		t.Errorf("Expected %d written emails, but was %d", 2, n)
+	}
+	if !strings.Contains(buf.String(), "your token is abc.\r\n\r\nFrom:") {
+		t.Errorf("Expected emails separated by an empty line, but was %q", buf.String())
+	}
+}
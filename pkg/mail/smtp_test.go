@@ -0,0 +1,122 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one connection on a random port and records commands and
+// data sent by a client. It supports neither STARTTLS nor authentication.
+type fakeSMTP struct {
+	addr     string
+	commands chan []string
+	data     chan string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+
+	f := &fakeSMTP{addr: l.Addr().String(), commands: make(chan []string, 1), data: make(chan string, 1)}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		f.serve(textproto.NewConn(conn))
+	}()
+
+	return f
+}
+
+func (f *fakeSMTP) serve(c *textproto.Conn) {
+	var commands []string
+	defer func() { f.commands <- commands }()
+
+	c.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		commands = append(commands, line)
+
+		switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+		case "EHLO":
+			c.PrintfLine("250 localhost")
+		case "DATA":
+			c.PrintfLine("354 go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			f.data <- string(data)
+			c.PrintfLine("250 queued")
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newFakeSMTP(t)
+	m := &SMTPMailer{Addr: server.addr, From: "go-auth@localhost"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	commands := <-server.commands
+	for _, want := range []string{"MAIL FROM:<go-auth@localhost>", "RCPT TO:<susan@barz.com>", "DATA", "QUIT"} {
+		if !contains(commands, want) {
+			t.Errorf("Expected command %q, but was %q", want, commands)
+		}
+	}
+	data := <-server.data
+	if !strings.Contains(data, "Subject: Verify your email\n") || !strings.Contains(data, "your token is abc.") {
+		t.Errorf("Expected the message, but was %q", data)
+	}
+}
+
+func TestSMTPMailerUnreachable(t *testing.T) {
+	m := &SMTPMailer{Addr: "127.0.0.1:1", From: "go-auth@localhost"}
+
+	if err := m.Send(context.Background(), msg); err == nil {
+		t.Error("error was expected")
+	}
+}
+
+func TestSMTPMailerRejectsLineBreaks(t *testing.T) {
+	server := newFakeSMTP(t)
+	m := &SMTPMailer{Addr: server.addr, From: "go-auth@localhost"}
+
+	err := m.Send(context.Background(), Message{To: "susan@barz.com\r\nRCPT TO:<eve@evil.com>", Subject: "Hi"})
+
+	if err == nil {
+		t.Error("error was expected")
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// TokenLevel represents what a JWT must prove about its owner to be accepted.
+// Each level accepts tokens of one security.TokenType.
+type TokenLevel security.TokenType
+
+const (
+	// PreTwoFactor level accepts tokens issued after login, before 2FA.
+	PreTwoFactor = TokenLevel(security.TokenMFAPending)
+	// FullyAuthenticated level accepts tokens issued after 2FA.
+	FullyAuthenticated = TokenLevel(security.TokenAccess)
+)
+
+// TokenValidator validates bearer tokens, it is implemented by
+// security.JWTIssuer.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string, uses ...security.TokenType) (*security.Claims, error)
+}
+
+// claimsContextKey is a key under which validated claims are stored in
+// a request context.
+type claimsContextKey struct{}
+
+// RequireToken is a middleware which accepts only requests with a bearer token
+// of one of the levels, which the validator v accepts. Claims of the token are
+// stored in the request context, from which they are retrieved by
+// ClaimsFromContext. If the revocation of the token can't be checked in time,
+// 503 is returned.
+func RequireToken(v TokenValidator, levels ...TokenLevel) func(http.Handler) http.Handler {
+
+	uses := make([]security.TokenType, len(levels))
+	for i, l := range levels {
+		uses[i] = security.TokenType(l)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			bearer := r.Header.Get(consts.Authorization)
+			if !strings.HasPrefix(bearer, consts.BearerPrefix) {
+				respondWithProblemDetails(w, unauthorized(r.URL.Path))
+				return
+			}
+
+			token := strings.TrimPrefix(bearer, consts.BearerPrefix)
+			c, err := v.ValidateToken(r.Context(), token, uses...)
+			if errors.Is(err, context.DeadlineExceeded) {
+				respondWithProblemDetails(w, serviceUnavailable(r.URL.Path))
+				return
+			} else if err != nil {
+				respondWithProblemDetails(w, unauthorized(r.URL.Path))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey{}, c)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// BearerAuth returns a middleware applying RequireToken with the v to routes
+// according to the security schemes declared for them in the OpenAPI
+// specification. Generated handlers put scopes of the schemes into the request
+// context. The unauthBearerToken scheme requires a PreTwoFactor token and the
+// authBearerToken scheme a FullyAuthenticated one. If a route declares both,
+// either is accepted. Routes without bearer schemes are passed through.
+func BearerAuth(v TokenValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		preTwoFactor := RequireToken(v, PreTwoFactor)(next)
+		fullyAuthenticated := RequireToken(v, FullyAuthenticated)(next)
+		anyToken := RequireToken(v, PreTwoFactor, FullyAuthenticated)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			unauth := ctx.Value(api.UnauthBearerTokenScopes) != nil
+			auth := ctx.Value(api.AuthBearerTokenScopes) != nil
+
+			switch {
+			case unauth && auth:
+				anyToken.ServeHTTP(w, r)
+			case unauth:
+				preTwoFactor.ServeHTTP(w, r)
+			case auth:
+				fullyAuthenticated.ServeHTTP(w, r)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// ClaimsFromContext returns claims of a token validated by RequireToken.
+// Returns false if the context doesn't contain any.
+func ClaimsFromContext(ctx context.Context) (*security.Claims, bool) {
+	c, ok := ctx.Value(claimsContextKey{}).(*security.Claims)
+	return c, ok
+}
+
+// unauthorized returns a problem details response used when a request has
+// a missing or invalid token.
+func unauthorized(relPath string) api.ProblemDetails {
+	return api.ProblemDetails{
+		StatusCode: http.StatusUnauthorized,
+		Title:      "Invalid token",
+		Detail:     "Token you submitted was not valid.",
+		Instance:   relPath,
+	}
+}
+
+// serviceUnavailable returns a problem details response used when a token
+// couldn't be validated in time, because the database is too slow.
+func serviceUnavailable(relPath string) api.ProblemDetails {
+	return api.ProblemDetails{
+		StatusCode: http.StatusServiceUnavailable,
+		Title:      "Service unavailable",
+		Detail:     "The service is temporarily unavailable, try again later.",
+		Instance:   relPath,
+	}
+}
@@ -0,0 +1,159 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/middleware"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+var joe = security.Subject{UserID: "1", Username: "Joe"}
+
+// claimsHandler responds with 200 if claims are in the request context.
+var claimsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.ClaimsFromContext(r.Context()); !ok {
+		w.WriteHeader(http.StatusTeapot)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+})
+
+// newIssuer creates a JWTIssuer with a new random key, which consults the
+// revocations.
+func newIssuer(t *testing.T, revocations security.RevocationStore) *security.JWTIssuer {
+	t.Helper()
+
+	tokens := config.Default().Tokens
+	keys := security.NewKeyStore("", security.DefaultAlgorithm, time.Hour)
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	return &security.JWTIssuer{
+		Keys:        keys,
+		Revocations: revocations,
+		Lifetimes:   tokens.Lifetimes(),
+		Issuer:      tokens.Issuer,
+		Audience:    tokens.Audience,
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	t.Parallel()
+	issuer := newIssuer(t, security.NewMemoryRevocationStore())
+	unauthToken, _ := issuer.GenerateJWT(security.TokenMFAPending, joe)
+	authToken, _ := issuer.GenerateJWT(security.TokenAccess, joe)
+	refreshToken, _ := issuer.GenerateJWT(security.TokenRefresh, joe)
+	otherToken, _ := newIssuer(t, security.NewMemoryRevocationStore()).GenerateJWT(security.TokenAccess, joe)
+
+	testCases := []struct {
+		name     string
+		level    middleware.TokenLevel
+		header   string
+		wantCode int
+	}{
+		{"NoHeader", middleware.PreTwoFactor, "", http.StatusUnauthorized},
+		{"NotBearer", middleware.PreTwoFactor, "Basic xyz", http.StatusUnauthorized},
+		{"InvalidToken", middleware.PreTwoFactor, consts.BearerPrefix + "invalid", http.StatusUnauthorized},
+		{"PreTwoFactor", middleware.PreTwoFactor, consts.BearerPrefix + unauthToken, http.StatusOK},
+		{"PreTwoFactorWithFullToken", middleware.PreTwoFactor, consts.BearerPrefix + authToken, http.StatusUnauthorized},
+		{"FullyAuthenticated", middleware.FullyAuthenticated, consts.BearerPrefix + authToken, http.StatusOK},
+		{"FullyAuthenticatedWithPreTwoFactorToken", middleware.FullyAuthenticated, consts.BearerPrefix + unauthToken, http.StatusUnauthorized},
+		{"FullyAuthenticatedWithRefreshToken", middleware.FullyAuthenticated, consts.BearerPrefix + refreshToken, http.StatusUnauthorized},
+		{"TokenOfOtherIssuer", middleware.FullyAuthenticated, consts.BearerPrefix + otherToken, http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add(consts.Authorization, tc.header)
+			rr := httptest.NewRecorder()
+
+			middleware.RequireToken(issuer, tc.level)(claimsHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", tc.wantCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestBearerAuthSecuritySchemes(t *testing.T) {
+	t.Parallel()
+	issuer := newIssuer(t, security.NewMemoryRevocationStore())
+	unauthToken, _ := issuer.GenerateJWT(security.TokenMFAPending, joe)
+	authToken, _ := issuer.GenerateJWT(security.TokenAccess, joe)
+
+	testCases := []struct {
+		name     string
+		schemes  []string
+		token    string
+		wantCode int
+	}{
+		{"NoScheme", nil, "", http.StatusTeapot},
+		{"UnauthScheme", []string{api.UnauthBearerTokenScopes}, unauthToken, http.StatusOK},
+		{"AuthScheme", []string{api.AuthBearerTokenScopes}, unauthToken, http.StatusUnauthorized},
+		{"BothSchemesUnauth", []string{api.AuthBearerTokenScopes, api.UnauthBearerTokenScopes}, unauthToken, http.StatusOK},
+		{"BothSchemesAuth", []string{api.AuthBearerTokenScopes, api.UnauthBearerTokenScopes}, authToken, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, scheme := range tc.schemes {
+				ctx = context.WithValue(ctx, scheme, []string{""})
+			}
+
+			req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+			if tc.token != "" {
+				req.Header.Add(consts.Authorization, consts.BearerPrefix+tc.token)
+			}
+			rr := httptest.NewRecorder()
+
+			middleware.BearerAuth(issuer)(claimsHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", tc.wantCode, rr.Code)
+			}
+		})
+	}
+}
+
+// slowRevocations is a revocation store, which never answers before the
+// context of a lookup is done.
+type slowRevocations struct{}
+
+func (slowRevocations) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (slowRevocations) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestRequireTokenRevocationTimeout(t *testing.T) {
+	t.Parallel()
+	issuer := newIssuer(t, slowRevocations{})
+	authToken, _ := issuer.GenerateJWT(security.TokenAccess, joe)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	req.Header.Add(consts.Authorization, consts.BearerPrefix+authToken)
+	rr := httptest.NewRecorder()
+
+	middleware.RequireToken(issuer, middleware.FullyAuthenticated)(claimsHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
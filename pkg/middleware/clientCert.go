@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+)
+
+// RequireClientCert is a middleware for mutual TLS, which rejects requests to
+// any of the paths without a verified client certificate. The certificate is
+// verified by the TLS server against trusted CAs, so only its presence is
+// checked here. Requests to other paths are passed through.
+func RequireClientCert(paths ...string) func(http.Handler) http.Handler {
+	protected := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		protected[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !protected[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				respondWithProblemDetails(w, api.ProblemDetails{
+					StatusCode: http.StatusUnauthorized,
+					Title:      "Client certificate required",
+					Detail:     "A valid TLS client certificate is required for this endpoint.",
+					Instance:   r.URL.Path,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Nesquiko/go-auth/pkg/middleware"
+)
+
+func TestRequireClientCert(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}
+
+	testCases := []struct {
+		name     string
+		path     string
+		tls      *tls.ConnectionState
+		wantCode int
+	}{
+		{"UnprotectedPath", "/login", nil, http.StatusOK},
+		{"PlainHTTP", "/introspect", nil, http.StatusUnauthorized},
+		{"NoClientCert", "/introspect", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"VerifiedClientCert", "/introspect", verified, http.StatusOK},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.RequireClientCert("/introspect")(ok)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tc.path, nil)
+			req.TLS = tc.tls
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", tc.wantCode, rr.Code)
+			}
+		})
+	}
+}
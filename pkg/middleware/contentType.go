@@ -8,14 +8,18 @@ import (
 )
 
 // ContentTypeFilter is a middleware for filtering requests which do not have
-// Content-Type header set to application/json. Firstly checks if any bearer
-// token is in Headers, if yes, then proceed, if no check for correct Content-Type
-// header.
+// Content-Type header set to application/json. Firstly checks if the request
+// is a GET or HEAD request, which have no body, or if any bearer token is in
+// Headers, if yes, then proceed, if no check for correct Content-Type header.
 func ContentTypeFilter(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		if bearer := r.Header.Get(consts.Authorization); bearer != "" {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+
+		} else if bearer := r.Header.Get(consts.Authorization); bearer != "" {
 			next.ServeHTTP(w, r)
 			return
 
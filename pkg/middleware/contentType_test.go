@@ -1,4 +1,4 @@
-package middleware
+package middleware_test
 
 import (
 	"bytes"
@@ -7,9 +7,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
 	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/middleware"
+	"github.com/Nesquiko/go-auth/pkg/security"
 	"github.com/Nesquiko/go-auth/pkg/server"
 	"github.com/go-chi/chi/v5"
 )
@@ -18,10 +23,29 @@ var handler http.Handler
 
 func TestMain(m *testing.M) {
 	r := chi.NewRouter()
-	var s server.GoAuthServer
+	cfg := config.Default()
+	keys := security.NewKeyStore("", security.DefaultAlgorithm, time.Hour)
+	if _, err := keys.Rotate(); err != nil {
+		panic(err)
+	}
+	tokens := &security.JWTIssuer{
+		Keys:        keys,
+		Revocations: security.NewMemoryRevocationStore(),
+		Lifetimes:   cfg.Tokens.Lifetimes(),
+		Issuer:      cfg.Tokens.Issuer,
+		Audience:    cfg.Tokens.Audience,
+	}
+	s, err := server.NewGoAuthServer(cfg, server.Dependencies{
+		Store:  db.NewMemoryConnection(),
+		Tokens: tokens,
+	})
+	if err != nil {
+		panic(err)
+	}
 
 	middlewares := []api.MiddlewareFunc{
-		ContentTypeFilter,
+		middleware.ContentTypeFilter,
+		middleware.BearerAuth(tokens),
 	}
 	servOpts := api.ChiServerOptions{
 		BaseRouter:  r,
@@ -90,3 +114,19 @@ func TestContentTypeFilterInvalidHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestContentTypeFilterGetWithoutContentType(t *testing.T) {
+	for _, path := range []string{"/.well-known/jwks.json", "/healthz", "/readyz"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+
+			wantCode := http.StatusOK
+
+			res := executeRequest(req)
+
+			if res.Code != wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Default parameters of Argon2id, the second recommended option of RFC 9106.
+const (
+	DefaultArgon2Memory      = 64 * 1024
+	DefaultArgon2Iterations  = 3
+	DefaultArgon2Parallelism = 4
+)
+
+// argon2SaltSize and argon2KeySize are lengths, in Bytes, of salts and keys
+// of Argon2id hashes.
+const (
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+)
+
+// argon2Prefix starts every Argon2id hash in the PHC string format.
+const argon2Prefix = "$argon2id$"
+
+// Argon2idHasher hashes passwords with Argon2id. Hashes are encoded in the
+// PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>, so
+// they carry their own parameters. Zero parameters mean the defaults.
+type Argon2idHasher struct {
+	// Memory used by the hashing, in KiB.
+	Memory uint32
+	// Iterations over the memory.
+	Iterations uint32
+	// Parallelism is a number of threads.
+	Parallelism uint8
+}
+
+// argon2Params are parameters of an Argon2id hash.
+type argon2Params struct {
+	memory, iterations uint32
+	parallelism        uint8
+}
+
+// params returns parameters of the hasher with defaults for zero ones.
+func (h Argon2idHasher) params() argon2Params {
+	p := argon2Params{memory: h.Memory, iterations: h.Iterations, parallelism: h.Parallelism}
+	if p.memory == 0 {
+		p.memory = DefaultArgon2Memory
+	}
+	if p.iterations == 0 {
+		p.iterations = DefaultArgon2Iterations
+	}
+	if p.parallelism == 0 {
+		p.parallelism = DefaultArgon2Parallelism
+	}
+	return p
+}
+
+// Hash returns an Argon2id hash of the password with a random salt.
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := h.params()
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeySize)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the hash is a hash of the password. Hashes of all
+// supported algorithms are verified, so users keep logging in while their
+// hashes are upgraded.
+func (Argon2idHasher) Verify(hash, password string) bool {
+	return HashAndPasswordMatch(hash, password)
+}
+
+// NeedsRehash reports whether the hash isn't an Argon2id hash, or was
+// computed with less memory or fewer iterations than the hasher uses.
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	p, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	want := h.params()
+	return p.memory < want.memory || p.iterations < want.iterations
+}
+
+// argon2idMatch reports whether the Argon2id hash is a hash of the password.
+func argon2idMatch(hash, password string) bool {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// errInvalidArgon2Hash is returned when a hash isn't a valid Argon2id hash in
+// the PHC string format.
+var errInvalidArgon2Hash = errors.New("invalid Argon2id hash")
+
+// decodeArgon2id decodes parameters, the salt and the key of an Argon2id
+// hash in the PHC string format.
+func decodeArgon2id(hash string) (p argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, errInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidArgon2Hash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, errInvalidArgon2Hash
+	}
+	if p.iterations == 0 || p.parallelism == 0 {
+		return p, nil, nil, errInvalidArgon2Hash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errInvalidArgon2Hash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errInvalidArgon2Hash
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,108 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2 is an Argon2idHasher with low parameters to keep tests fast.
+var fastArgon2 = Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2idHasher(t *testing.T) {
+	hash, err := fastArgon2.Hash("123")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Expected a PHC formatted hash, but was %q", hash)
+	}
+	if !fastArgon2.Verify(hash, "123") {
+		t.Error("Comparison failed, but expected not to")
+	}
+	if fastArgon2.Verify(hash, "invalid") {
+		t.Error("Comparison succeded, but expected not to")
+	}
+	if other, _ := fastArgon2.Hash("123"); other == hash {
+		t.Error("Hashes of same password match, they should not")
+	}
+}
+
+func TestArgon2idHasherDefaults(t *testing.T) {
+	p := Argon2idHasher{}.params()
+
+	if p.memory != DefaultArgon2Memory || p.iterations != DefaultArgon2Iterations || p.parallelism != DefaultArgon2Parallelism {
+		t.Errorf("Expected default parameters, but was %+v", p)
+	}
+}
+
+func TestVerifyInvalidArgon2idHashes(t *testing.T) {
+	hash, _ := fastArgon2.Hash("123")
+	parts := strings.Split(hash, "$")
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"Empty", ""},
+		{"Argon2i", strings.Replace(hash, "$argon2id$", "$argon2i$", 1)},
+		{"Version", strings.Replace(hash, "v=19", "v=16", 1)},
+		{"Params", strings.Replace(hash, parts[3], "m=1024,t=1", 1)},
+		{"ZeroIterations", strings.Replace(hash, "t=1", "t=0", 1)},
+		{"Salt", strings.Replace(hash, parts[4], "!!", 1)},
+		{"MissingKey", strings.TrimSuffix(hash, parts[5])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if HashAndPasswordMatch(tt.hash, "123") {
+				t.Errorf("Expected %q not to match", tt.hash)
+			}
+		})
+	}
+}
+
+func TestHashersVerifyEachOther(t *testing.T) {
+	bcryptHasher := BcryptHasher{Cost: bcrypt.MinCost}
+	bcryptHash, _ := bcryptHasher.Hash("123")
+	argon2Hash, _ := fastArgon2.Hash("123")
+
+	if !fastArgon2.Verify(bcryptHash, "123") {
+		t.Error("Expected Argon2id hasher to verify a Bcrypt hash")
+	}
+	if !bcryptHasher.Verify(argon2Hash, "123") {
+		t.Error("Expected Bcrypt hasher to verify an Argon2id hash")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptMin, _ := BcryptHasher{Cost: bcrypt.MinCost}.Hash("123")
+	bcryptStronger, _ := BcryptHasher{Cost: bcrypt.MinCost + 1}.Hash("123")
+	argon2Weak, _ := fastArgon2.Hash("123")
+	argon2Strong, _ := Argon2idHasher{Memory: 2048, Iterations: 2, Parallelism: 1}.Hash("123")
+
+	tests := []struct {
+		name   string
+		hasher interface{ NeedsRehash(string) bool }
+		hash   string
+		want   bool
+	}{
+		{"BcryptSameCost", BcryptHasher{Cost: bcrypt.MinCost}, bcryptMin, false},
+		{"BcryptHigherCost", BcryptHasher{Cost: bcrypt.MinCost}, bcryptStronger, false},
+		{"BcryptLowerCost", BcryptHasher{Cost: bcrypt.MinCost + 1}, bcryptMin, true},
+		{"BcryptFromArgon2id", BcryptHasher{Cost: bcrypt.MinCost}, argon2Weak, true},
+		{"Argon2idSameParams", fastArgon2, argon2Weak, false},
+		{"Argon2idStrongerParams", fastArgon2, argon2Strong, false},
+		{"Argon2idLessMemory", Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1}, argon2Weak, true},
+		{"Argon2idFewerIterations", Argon2idHasher{Memory: 1024, Iterations: 2, Parallelism: 1}, argon2Weak, true},
+		{"Argon2idFromBcrypt", fastArgon2, bcryptStronger, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("Expected %v, but was %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,13 +3,51 @@
 package security
 
 import (
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
 // EncryptPassword encrypts the given password with Bcrypt algorithm and returns
 // the generated hash.
 func EncryptPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return BcryptHasher{}.Hash(password)
+}
+
+// HashAndPasswordMatch takes a hash and a password and determines if the hash
+// matches the entered password. The hash is either a Bcrypt hash or an
+// Argon2id hash in the PHC string format.
+func HashAndPasswordMatch(hash, password string) bool {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		return argon2idMatch(hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}
+
+// BcryptMaxPasswordBytes is a maximal length of passwords in bytes, which
+// Bcrypt hashes. Longer passwords are truncated or rejected by it, so the
+// password policy must not allow them.
+const BcryptMaxPasswordBytes = 72
+
+// BcryptHasher hashes passwords with Bcrypt of the Cost, zero means
+// bcrypt.DefaultCost.
+type BcryptHasher struct {
+	Cost int
+}
+
+// cost returns the Cost, or bcrypt.DefaultCost if it isn't set.
+func (h BcryptHasher) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+// Hash returns a Bcrypt hash of the password.
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
 	if err != nil {
 		return "", err
 	}
@@ -17,9 +55,15 @@ func EncryptPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-// HashAndPasswordMatch takes a hash and a password and determines if the hash
-// matches the entered password.
-func HashAndPasswordMatch(hash, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// Verify reports whether the hash is a hash of the password. Hashes of all
+// supported algorithms are verified, see HashAndPasswordMatch.
+func (BcryptHasher) Verify(hash, password string) bool {
+	return HashAndPasswordMatch(hash, password)
+}
+
+// NeedsRehash reports whether the hash isn't a Bcrypt hash, or was computed
+// with a lower cost than the hasher uses.
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.cost()
 }
@@ -2,6 +2,8 @@ package security
 
 import (
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func Test_encryptPasswordSamePasswordsHashDoNotMatch(t *testing.T) {
@@ -34,3 +36,22 @@ func Test_compareHashAndPasswordInvalid(t *testing.T) {
 		t.Fatalf("Comparison succeded, but expected not to")
 	}
 }
+
+func TestBcryptHasherCost(t *testing.T) {
+	h := BcryptHasher{Cost: bcrypt.MinCost}
+
+	hash, err := h.Hash("123")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != bcrypt.MinCost {
+		t.Errorf("Expected cost %d, but was %d", bcrypt.MinCost, cost)
+	}
+	if !h.Verify(hash, "123") {
+		t.Error("Comparison failed, but expected not to")
+	}
+	if h.Verify(hash, "invalid") {
+		t.Error("Comparison succeded, but expected not to")
+	}
+}
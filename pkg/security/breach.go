@@ -0,0 +1,293 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachChecker checks passwords against a corpus of passwords exposed in data
+// breaches, e.g. Pwned Passwords of Have I Been Pwned.
+type BreachChecker interface {
+
+	// Breached reports whether the password appeared in a data breach.
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// rangePrefixLength is a number of hex characters of SHA-1 hashes, by which
+// the Pwned Passwords range format splits them into files.
+const rangePrefixLength = 5
+
+// RangeChecker is a BreachChecker reading a local copy of Pwned Passwords in
+// the range format. The Dir contains a file for every 5 character prefix of
+// SHA-1 hashes, e.g. 21BD1.txt, with one SUFFIX:COUNT line for every breached
+// hash with the prefix, the same as responses of the range API.
+type RangeChecker struct {
+	// Dir is the directory with range files.
+	Dir string
+}
+
+// Breached reads the range file of the SHA-1 prefix of the password and
+// reports whether it contains the rest of the hash. A missing range file
+// means no hash with the prefix was breached.
+func (c RangeChecker) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:rangePrefixLength], hash[rangePrefixLength:]
+
+	f, err := os.Open(filepath.Join(c.Dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		other, count, err := parseHashLine(scanner.Text())
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		if count > 0 && strings.EqualFold(other, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// parseHashLine parses a HASH:COUNT line of Pwned Passwords, either a full
+// hash of a dump or a suffix of a range file. Lines without a count are
+// accepted with a count of 1.
+func parseHashLine(line string) (hash string, count uint64, err error) {
+	hash, countStr, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found {
+		return hash, 1, nil
+	}
+	count, err = strconv.ParseUint(countStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid count in line %q", line)
+	}
+	return hash, count, nil
+}
+
+// bloomMagic starts every encoded BloomFilter, followed by a version, a number
+// of bits and a number of hashes, together bloomHeaderSize Bytes.
+const (
+	bloomMagic      = "GABF"
+	bloomVersion    = 1
+	bloomHeaderSize = 20
+)
+
+// bloomMaxHashes is a maximal number of hashes of a BloomFilter, enough for a
+// false positive rate of about 10^-19. More hashes only slow down every check.
+const bloomMaxHashes = 64
+
+// errInvalidBloomFilter is returned when a file isn't an encoded BloomFilter.
+var errInvalidBloomFilter = errors.New("invalid Bloom filter")
+
+// BloomFilter is a BreachChecker keeping SHA-1 hashes of breached passwords in
+// a Bloom filter, a compact probabilistic set. It never misses a breached
+// password, but rejects a few more with the configured false positive rate,
+// which is fine for a password check. The full Pwned Passwords corpus fits
+// into about 1.7 GB with a rate of 0.1%.
+type BloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint32
+}
+
+// NewBloomFilter creates an empty BloomFilter sized for n hashes with the
+// false positive rate fpRate.
+func NewBloomFilter(n uint64, fpRate float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint32(math.Min(math.Round(float64(m)/float64(n)*math.Ln2), bloomMaxHashes))
+	if k == 0 {
+		k = 1
+	}
+
+	return &BloomFilter{bits: make([]uint64, (m+63)/64), m: m, hashes: k}
+}
+
+// Add adds the SHA-1 hash of a breached password to the filter.
+func (f *BloomFilter) Add(hash [sha1.Size]byte) {
+	h1, h2 := bloomHashes(hash)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains reports whether the SHA-1 hash was probably added to the filter.
+func (f *BloomFilter) Contains(hash [sha1.Size]byte) bool {
+	h1, h2 := bloomHashes(hash)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Breached reports whether the SHA-1 hash of the password is in the filter.
+func (f *BloomFilter) Breached(ctx context.Context, password string) (bool, error) {
+	return f.Contains(sha1.Sum([]byte(password))), nil
+}
+
+// bloomHashes derives two hashes for double hashing of the filter from the
+// SHA-1 hash, which is already uniformly distributed. The second one is odd,
+// so probes don't repeat a single bit.
+func bloomHashes(hash [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(hash[:8]), binary.BigEndian.Uint64(hash[8:16]) | 1
+}
+
+// WriteTo encodes the filter into the w, in the format read by
+// ReadBloomFilter.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, bloomHeaderSize)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[4:8], bloomVersion)
+	binary.BigEndian.PutUint64(header[8:16], f.m)
+	binary.BigEndian.PutUint32(header[16:20], f.hashes)
+	n, err := bw.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	word := make([]byte, 8)
+	for _, bits := range f.bits {
+		binary.BigEndian.PutUint64(word, bits)
+		n, err := bw.Write(word)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// ReadBloomFilter decodes a BloomFilter written by BloomFilter.WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	return readBloomFilter(r, -1)
+}
+
+// bloomReadChunk is a maximal number of words allocated for a filter before
+// they are read, so a corrupted header can't exhaust memory.
+const bloomReadChunk = 1 << 16
+
+// readBloomFilter decodes a BloomFilter of the size in Bytes from the r, or
+// of unknown size if it is negative.
+func readBloomFilter(r io.Reader, size int64) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, bloomHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, errInvalidBloomFilter
+	}
+	if string(header[:4]) != bloomMagic || binary.BigEndian.Uint32(header[4:8]) != bloomVersion {
+		return nil, errInvalidBloomFilter
+	}
+
+	f := &BloomFilter{
+		m:      binary.BigEndian.Uint64(header[8:16]),
+		hashes: binary.BigEndian.Uint32(header[16:20]),
+	}
+	if f.m == 0 || f.hashes == 0 || f.hashes > bloomMaxHashes || f.m > math.MaxInt64-63 {
+		return nil, errInvalidBloomFilter
+	}
+	words := int64(f.m+63) / 64
+	if size >= 0 && size != bloomHeaderSize+8*words {
+		return nil, errInvalidBloomFilter
+	}
+
+	word := make([]byte, 8)
+	if size >= 0 {
+		// the size was checked, so all words can be allocated at once
+		f.bits = make([]uint64, words)
+		for i := range f.bits {
+			if _, err := io.ReadFull(br, word); err != nil {
+				return nil, errInvalidBloomFilter
+			}
+			f.bits[i] = binary.BigEndian.Uint64(word)
+		}
+		return f, nil
+	}
+
+	// without the size the words are allocated as they are read
+	f.bits = make([]uint64, 0, minInt64(words, bloomReadChunk))
+	for i := int64(0); i < words; i++ {
+		if _, err := io.ReadFull(br, word); err != nil {
+			return nil, errInvalidBloomFilter
+		}
+		f.bits = append(f.bits, binary.BigEndian.Uint64(word))
+	}
+	return f, nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// LoadBloomFilter reads a BloomFilter from the file at the path, see
+// ReadBloomFilter. The filter must fill the whole file.
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readBloomFilter(file, info.Size())
+}
+
+// ReadHashes calls the fn with every breached SHA-1 hash of a Pwned Passwords
+// dump read from the r, with one HASH:COUNT line for every hash.
+func ReadHashes(r io.Reader, fn func(hash [sha1.Size]byte)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		hexHash, count, err := parseHashLine(scanner.Text())
+		if err != nil {
+			return err
+		}
+		var hash [sha1.Size]byte
+		if len(hexHash) != hex.EncodedLen(sha1.Size) {
+			return fmt.Errorf("invalid SHA-1 hash in line %q", scanner.Text())
+		}
+		if _, err := hex.Decode(hash[:], []byte(hexHash)); err != nil {
+			return fmt.Errorf("invalid SHA-1 hash in line %q", scanner.Text())
+		}
+		if count > 0 {
+			fn(hash)
+		}
+	}
+	return scanner.Err()
+}
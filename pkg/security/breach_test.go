@@ -0,0 +1,162 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sha1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+const breachedDump = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n" +
+	"7C4A8D09CA3762AF61E59520943DC26494F8941B:37359195\n" +
+	"\n" +
+	"5BAA6FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:0\n"
+
+func TestRangeChecker(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"+
+			"1E4C9B93F3F0682250B6CF8331B7EE68FD9:0\r\n",
+	), 0600)
+	c := RangeChecker{Dir: dir}
+
+	tests := []struct {
+		password string
+		breached bool
+	}{
+		{"password", true},
+		{"S3cret-pass", false},
+	}
+	for _, tt := range tests {
+		breached, err := c.Breached(context.Background(), tt.password)
+		if err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+		if breached != tt.breached {
+			t.Errorf("Expected %q breached to be %t, but was %t", tt.password, tt.breached, breached)
+		}
+	}
+}
+
+func TestRangeCheckerInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:many\n"), 0600)
+
+	if _, err := (RangeChecker{Dir: dir}).Breached(context.Background(), "password"); err == nil {
+		t.Error("error was expected")
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	f := NewBloomFilter(2, 0.001)
+	if err := ReadHashes(strings.NewReader(breachedDump), f.Add); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "pwned.bloom")
+	os.WriteFile(path, buf.Bytes(), 0600)
+
+	loaded, err := LoadBloomFilter(path)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	for _, password := range []string{"password", "123456"} {
+		if breached, _ := loaded.Breached(context.Background(), password); !breached {
+			t.Errorf("Expected %q to be breached", password)
+		}
+	}
+	if loaded.Contains(sha1.Sum([]byte("S3cret-pass"))) {
+		t.Error("Expected not added password not to be breached")
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const n = 10000
+	f := NewBloomFilter(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(sha1.Sum([]byte(fmt.Sprintf("breached-%d", i))))
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.Contains(sha1.Sum([]byte(fmt.Sprintf("safe-%d", i)))) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Errorf("Expected false positive rate about 0.01, but was %f", rate)
+	}
+}
+
+func TestReadBloomFilterInvalid(t *testing.T) {
+	for _, data := range []string{"", "GABF", "XXXX\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x40\x00\x00\x00\x01"} {
+		if _, err := ReadBloomFilter(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected error for %q", data)
+		}
+	}
+}
+
+func TestLoadBloomFilterCorruptedSize(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewBloomFilter(2, 0.001).WriteTo(&buf); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	valid := append([]byte(nil), buf.Bytes()...)
+	data := buf.Bytes()
+	// 2^62 bits would need 512 PiB of words
+	binary.BigEndian.PutUint64(data[8:16], 1<<62)
+
+	path := filepath.Join(t.TempDir(), "pwned.bloom")
+	os.WriteFile(path, data, 0600)
+	if _, err := LoadBloomFilter(path); err == nil {
+		t.Error("Expected error for filter larger than its file")
+	}
+	if _, err := ReadBloomFilter(bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for filter larger than its data")
+	}
+
+	os.WriteFile(path, append(valid, 0), 0600)
+	if _, err := LoadBloomFilter(path); err == nil {
+		t.Error("Expected error for file with trailing data")
+	}
+}
+
+func TestReadBloomFilterTooManyHashes(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewBloomFilter(2, 0.001).WriteTo(&buf); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:20], bloomMaxHashes+1)
+
+	if _, err := ReadBloomFilter(bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for filter with too many hashes")
+	}
+}
+
+func TestNewBloomFilterLimitsHashes(t *testing.T) {
+	f := NewBloomFilter(1, 1e-30)
+
+	if f.hashes != bloomMaxHashes {
+		t.Errorf("Expected %d hashes, but was %d", bloomMaxHashes, f.hashes)
+	}
+}
+
+func TestReadHashesInvalid(t *testing.T) {
+	for _, dump := range []string{"5BAA61E4:1\n", "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8XX:1\n", "ZZAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:1\n"} {
+		if err := ReadHashes(strings.NewReader(dump), func([sha1.Size]byte) {}); err == nil {
+			t.Errorf("Expected error for %q", dump)
+		}
+	}
+}
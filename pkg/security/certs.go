@@ -0,0 +1,150 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader holds a TLS certificate loaded from a certificate and a key
+// file, and reloads it when the files change, so renewed certificates are
+// used without a restart.
+type CertReloader struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certFile string
+	keyFile  string
+	// modTimes are modification times of the certificate and the key file
+	// when they were loaded.
+	modTimes [2]time.Time
+}
+
+// NewCertReloader loads the certificate from the PEM encoded certFile and
+// keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate returns the current certificate, it is used as
+// tls.Config.GetCertificate.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// Reload loads the certificate again if any of its files was modified since
+// the last load. If the new files are invalid, e.g. only one of them was
+// replaced yet, the current certificate is kept and the error is returned.
+func (cr *CertReloader) Reload() error {
+	modTimes, err := cr.modTimesOfFiles()
+	if err != nil {
+		return err
+	}
+
+	cr.mu.RLock()
+	changed := modTimes != cr.modTimes
+	cr.mu.RUnlock()
+
+	if !changed {
+		return nil
+	}
+	return cr.load()
+}
+
+// Check returns an error if the current certificate is expired, used as
+// a readiness check.
+func (cr *CertReloader) Check() error {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	if notAfter := cr.cert.Leaf.NotAfter; time.Now().After(notAfter) {
+		return fmt.Errorf("certificate expired at %s", notAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// StartReloading periodically reloads the certificate in a background
+// goroutine. Errors are printed, and the current certificate is kept. The
+// returned function stops the reloading.
+func (cr *CertReloader) StartReloading(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := cr.Reload(); err != nil {
+					fmt.Printf("Reloading TLS certificate failed: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// load loads the certificate and the key from files.
+func (cr *CertReloader) load() error {
+	modTimes, err := cr.modTimesOfFiles()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert = &cert
+	cr.modTimes = modTimes
+
+	return nil
+}
+
+// modTimesOfFiles returns modification times of the certificate and the key
+// file.
+func (cr *CertReloader) modTimesOfFiles() (modTimes [2]time.Time, err error) {
+	for i, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// LoadCertPool loads PEM encoded certificates from the file into a pool, used
+// for verifying client certificates.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return pool, nil
+}
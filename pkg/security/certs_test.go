@@ -0,0 +1,142 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert generates a self-signed certificate with the common name
+// and writes it with its key into the dir. Returns paths of the files.
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+// commonName returns the common name of the current certificate of the cr.
+func commonName(t *testing.T, cr *CertReloader) string {
+	t.Helper()
+
+	cert, _ := cr.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	return leaf.Subject.CommonName
+}
+
+// touch sets modification times of the files to the future, so they are seen
+// as modified even on file systems with coarse timestamps.
+func touch(files ...string) {
+	future := time.Now().Add(time.Minute)
+	for _, f := range files {
+		os.Chtimes(f, future, future)
+	}
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "old.example.com")
+
+	cr, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if name := commonName(t, cr); name != "old.example.com" {
+		t.Fatalf("Expected certificate %s, but was %s", "old.example.com", name)
+	}
+
+	writeSelfSignedCert(t, dir, "new.example.com")
+	touch(certFile, keyFile)
+
+	if err := cr.Reload(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if name := commonName(t, cr); name != "new.example.com" {
+		t.Errorf("Expected reloaded certificate %s, but was %s", "new.example.com", name)
+	}
+}
+
+func TestCertReloaderKeepsCertOnInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "old.example.com")
+
+	cr, _ := NewCertReloader(certFile, keyFile)
+
+	os.WriteFile(certFile, []byte("invalid"), 0600)
+	touch(certFile)
+
+	if err := cr.Reload(); err == nil {
+		t.Error("Expected error for invalid certificate")
+	}
+	if name := commonName(t, cr); name != "old.example.com" {
+		t.Errorf("Expected certificate %s to be kept, but was %s", "old.example.com", name)
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	if _, err := NewCertReloader("missing.pem", "missing-key.pem"); err == nil {
+		t.Error("Expected error for missing files")
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "ca.example.com")
+
+	if _, err := LoadCertPool(certFile); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	}
+	if _, err := LoadCertPool(keyFile); err == nil {
+		t.Error("Expected error for file without certificates")
+	}
+}
+
+func TestCertReloaderCheck(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "example.com")
+
+	cr, _ := NewCertReloader(certFile, keyFile)
+	if err := cr.Check(); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	}
+
+	cr.cert.Leaf.NotAfter = time.Now().Add(-time.Minute)
+	if err := cr.Check(); err == nil {
+		t.Error("Expected error for expired certificate")
+	}
+}
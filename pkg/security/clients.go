@@ -0,0 +1,44 @@
+package security
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// ClientStore holds credentials of clients, like an API gateway, which are
+// allowed to call privileged endpoints. Only SHA-256 hashes of secrets are
+// kept.
+type ClientStore struct {
+	secrets map[string][sha256.Size]byte
+}
+
+// ParseClients creates a ClientStore from comma separated "id:secret" pairs.
+func ParseClients(s string) (*ClientStore, error) {
+	cs := &ClientStore{secrets: make(map[string][sha256.Size]byte)}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("invalid client credentials %q, expected id:secret", id)
+		}
+		cs.secrets[id] = sha256.Sum256([]byte(secret))
+	}
+
+	return cs, nil
+}
+
+// Authenticate reports whether the client with the id has the secret. Secrets
+// are compared in constant time, also for unknown clients.
+func (cs *ClientStore) Authenticate(id, secret string) bool {
+	want, ok := cs.secrets[id]
+	got := sha256.Sum256([]byte(secret))
+
+	return subtle.ConstantTimeCompare(want[:], got[:]) == 1 && ok
+}
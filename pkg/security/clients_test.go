@@ -0,0 +1,38 @@
+package security
+
+import (
+	"testing"
+)
+
+func TestParseClientsAuthenticate(t *testing.T) {
+	cs, err := ParseClients("gateway:s3cret, billing:other")
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	tests := []struct {
+		name, id, secret string
+		want             bool
+	}{
+		{"Valid", "gateway", "s3cret", true},
+		{"ValidSecond", "billing", "other", true},
+		{"WrongSecret", "gateway", "other", false},
+		{"UnknownClient", "unknown", "s3cret", false},
+		{"Empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cs.Authenticate(tt.id, tt.secret); got != tt.want {
+				t.Errorf("Expected %v, but was %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseClientsInvalid(t *testing.T) {
+	for _, s := range []string{"gateway", "gateway:", ":secret"} {
+		if _, err := ParseClients(s); err == nil {
+			t.Errorf("error was expected for %q", s)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package security
+
+import "time"
+
+// Clock tells the current time. Time dependent code takes a Clock instead of
+// calling time.Now, so tests can move the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock telling the time of the system.
+type SystemClock struct{}
+
+// Now returns the current local time.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,58 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is a JSON Web Key (RFC 7517) representation of a public part of
+// a signing key. Only fields relevant for the key type are set.
+type JWK struct {
+	Kty string
+	Kid string
+	Use string
+	Alg string
+
+	// N and E are a modulus and an exponent of a RSA key.
+	N, E string
+
+	// Crv is a curve of an elliptic curve or an Ed25519 key, X and Y are its
+	// coordinates. Ed25519 keys have only X.
+	Crv, X, Y string
+}
+
+// PublicJWK returns the public part of the key as a JWK. Returns false if the
+// key is a HMAC key, which has no public part.
+func (k *SigningKey) PublicJWK() (JWK, bool) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+
+	switch pub := k.verificationKey().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64URL(pub.N.Bytes())
+		jwk.E = encodeBase64URL(big.NewInt(int64(pub.E)).Bytes())
+
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty, jwk.Crv = "EC", pub.Curve.Params().Name
+		jwk.X = encodeBase64URL(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64URL(pub.Y.FillBytes(make([]byte, size)))
+
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = encodeBase64URL(pub)
+
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
+
+// encodeBase64URL encodes b with unpadded base64url encoding used in JWKs.
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
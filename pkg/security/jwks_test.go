@@ -0,0 +1,45 @@
+package security
+
+import (
+	"testing"
+)
+
+func TestSigningKeyPublicJWK(t *testing.T) {
+	tests := []struct {
+		alg, wantKty, wantCrv string
+	}{
+		{RS256, "RSA", ""},
+		{ES256, "EC", "P-256"},
+		{EdDSA, "OKP", "Ed25519"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			key, _ := GenerateSigningKey(tt.alg)
+
+			jwk, ok := key.PublicJWK()
+			if !ok {
+				t.Fatal("Expected asymmetric key to have a JWK")
+			}
+			if jwk.Kty != tt.wantKty {
+				t.Errorf("Expected kty to be %s, but was %s", tt.wantKty, jwk.Kty)
+			}
+			if jwk.Crv != tt.wantCrv {
+				t.Errorf("Expected crv to be %s, but was %s", tt.wantCrv, jwk.Crv)
+			}
+			if jwk.Kid != key.ID {
+				t.Errorf("Expected kid to be %s, but was %s", key.ID, jwk.Kid)
+			}
+			if jwk.Alg != tt.alg {
+				t.Errorf("Expected alg to be %s, but was %s", tt.alg, jwk.Alg)
+			}
+		})
+	}
+}
+
+func TestSigningKeyPublicJWKHMAC(t *testing.T) {
+	key, _ := GenerateSigningKey(HS256)
+
+	if _, ok := key.PublicJWK(); ok {
+		t.Error("HMAC key must not have a public JWK")
+	}
+}
@@ -1,65 +1,151 @@
 package security
 
 import (
-	"crypto/rand"
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
-// jwtKey is used as a secret when generating and validating a JWT token.
-var jwtKey []byte
+// DefaultAlgorithm is a signing algorithm used when none is configured.
+const DefaultAlgorithm = HS256
 
-// expirationDurationUnauth is how long a JWT token is valid.
-var expirationDurationUnauth time.Duration = 5 * time.Minute
-var expirationDurationAuth time.Duration = 3 * 24 * time.Hour
+// TokenType is a type of a JWT stored in its token_use claim. Each endpoint
+// accepts only tokens of specific types.
+type TokenType string
 
-// init function creates new key using crypto/rand. If the creation of the key
-// is not successful, it panics.
-func init() {
-	keyLen := 64
-	jwtKey = make([]byte, keyLen)
-	n, err := rand.Read(jwtKey)
+const (
+	// TokenMFAPending is issued after login, it can only be used for 2FA.
+	TokenMFAPending TokenType = "mfa_pending"
+	// TokenAccess is issued after 2FA and grants full access.
+	TokenAccess TokenType = "access"
+	// TokenRefresh can only be exchanged for a new access token. Refresh
+	// tokens are opaque, not JWTs, the type only keys their lifetime.
+	TokenRefresh TokenType = "refresh"
+	// TokenEmailVerification is sent to an email address after signup, it
+	// can only be used once to verify the address.
+	TokenEmailVerification TokenType = "email_verification"
+)
 
-	if n != keyLen {
-		panic("Didn't create a secret")
-	}
-	if err != nil {
-		panic("Error occured wihle creating a secret")
+// clockSkew is a tolerance of time based claims, for instances with slightly
+// different clocks.
+const clockSkew = 30 * time.Second
+
+// KeyRetention returns for how long a rotated key should still be accepted.
+// It equals the longest of the lifetimes of JWTs, so no token becomes invalid
+// by a rotation. Refresh tokens are not signed, so their lifetime is skipped.
+func KeyRetention(lifetimes map[TokenType]time.Duration) time.Duration {
+	var longest time.Duration
+	for tokenType, lifetime := range lifetimes {
+		if tokenType != TokenRefresh && lifetime > longest {
+			longest = lifetime
+		}
 	}
+	return longest
 }
 
-// claims represents JWT claims used in body of JWT.
-type claims struct {
-	Username      string `json:"username"`
-	Authenticated bool   `json:"authenticated"`
+// Subject identifies the user to whom a token is issued.
+type Subject struct {
+	// UserID is the UUID of the user, stored in the sub claim.
+	UserID string
+	// Username of the user.
+	Username string
+	// SessionID is an ID of the refresh token family, empty for tokens
+	// issued before 2FA.
+	SessionID string
+	// Recovered is set when 2FA was completed with a recovery code.
+	Recovered bool
+}
+
+// Claims represents JWT claims used in body of JWT. Every token has a unique
+// ID in the jti claim, used for its revocation.
+type Claims struct {
+	Username string    `json:"username"`
+	TokenUse TokenType `json:"token_use"`
+	// SessionID is an ID of the refresh token family issued together with
+	// the token, empty for tokens issued before 2FA.
+	SessionID string `json:"sid,omitempty"`
+	// Recovered is set for tokens issued after 2FA completed with a recovery
+	// code, which can replace the 2FA secret.
+	Recovered bool `json:"recovered,omitempty"`
 	jwt.StandardClaims
 }
 
-// GenerateJWT generates new JWT with a username as a claim and
-// authenticated claim set to false, because 2FA is needed to be fully
-// authenticated. The JWT has an expiration time equal to the expirationDuration
-// variable. The signing algorithm is HS256.
-func GenerateJWT(username string, authenticated bool) (string, error) {
-
-	var expirationTime time.Time
-	if authenticated {
-		expirationTime = time.Now().Add(expirationDurationUnauth)
-	} else {
-		expirationTime = time.Now().Add(expirationDurationAuth)
+// Valid validates only time based claims by the system time, it implements the
+// jwt.Claims interface. Tokens are validated by JWTIssuer.ValidateToken, which
+// also checks the issuer, the audience and the type of the token.
+func (c *Claims) Valid() error {
+	return c.StandardClaims.Valid()
+}
+
+// Scopes returns what the token grants access to, which is its type.
+func (c *Claims) Scopes() []string {
+	return []string{string(c.TokenUse)}
+}
+
+// JWTIssuer issues JWTs signed with its Keys and validates them. It holds
+// everything the issuing depends on, so more issuers with different keys or
+// clocks can coexist, e.g. in parallel tests.
+type JWTIssuer struct {
+	// Keys sign issued tokens and verify validated ones.
+	Keys *KeyStore
+	// Revocations is a store of revoked tokens consulted by ValidateToken.
+	Revocations RevocationStore
+	// Lifetimes specifies how long a JWT of each type is valid.
+	Lifetimes map[TokenType]time.Duration
+	// Issuer and Audience are values of the iss and aud claims.
+	Issuer, Audience string
+	// Clock tells the time of issuing and validation, nil means the system
+	// time.
+	Clock Clock
+}
+
+// now returns the current time of the Clock.
+func (t *JWTIssuer) now() time.Time {
+	if t.Clock == nil {
+		return time.Now()
 	}
+	return t.Clock.Now()
+}
 
-	claims := &claims{
-		Username:      username,
-		Authenticated: authenticated,
+// GenerateJWT generates new JWT of the type typ for the subject. The JWT has
+// an expiration time according to the Lifetimes of its type and a random jti.
+// The token is signed with the primary key from Keys, using its algorithm,
+// and the key ID is set as the kid header.
+func (t *JWTIssuer) GenerateJWT(typ TokenType, subject Subject) (string, error) {
+
+	lifetime, ok := t.Lifetimes[typ]
+	if !ok {
+		return "", fmt.Errorf("unknown token type %q", typ)
+	}
+
+	now := t.now()
+	claims := &Claims{
+		Username:  subject.Username,
+		TokenUse:  typ,
+		SessionID: subject.SessionID,
+		Recovered: subject.Recovered,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        uuid.NewString(),
+			Subject:   subject.UserID,
+			Issuer:    t.Issuer,
+			Audience:  t.Audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(lifetime).Unix(),
 		}}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	key, err := t.Keys.Primary()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.signingKey())
 	if err != nil {
 		return "", err
 	}
@@ -67,26 +153,126 @@ func GenerateJWT(username string, authenticated bool) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateToken(tokenString string) (*claims, error) {
-	token, err := jwt.ParseWithClaims(
+// ValidateToken parses the token and validates its signature with a key from
+// Keys specified by the kid header of the token. Tokens signed with unknown or
+// expired keys, or with a different algorithm than the key is used with, are
+// rejected. Then claims are validated, and only tokens of one of the types
+// uses, which aren't revoked in Revocations, neither by themselves, nor by
+// their session, are accepted. The ctx limits lookups of revocations.
+func (t *JWTIssuer) ValidateToken(ctx context.Context, tokenString string, uses ...TokenType) (*Claims, error) {
+	// claims are validated below against the clock of the issuer
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(
 		tokenString,
-		&claims{},
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		&Claims{},
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, err := t.Keys.Key(kid)
+			if err != nil {
+				return nil, err
+			}
+
+			if token.Method.Alg() != key.Algorithm {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 
-			return jwtKey, nil
+			return key.verificationKey(), nil
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	c := token.Claims.(*claims)
-	if token.Valid {
-		return c, nil
+	c := token.Claims.(*Claims)
+	if !token.Valid {
+		return nil, errors.New("invalid JWT token")
 	}
+	if err := t.validate(c); err != nil {
+		return nil, err
+	}
+
+	if !c.hasType(uses) {
+		return nil, fmt.Errorf("unexpected token type %q", c.TokenUse)
+	}
+
+	revoked, err := t.Revocations.IsRevoked(ctx, c.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	if c.SessionID != "" {
+		revoked, err = t.Revocations.IsRevoked(ctx, c.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return c, nil
+}
+
+// validate validates time based claims with tolerance of clockSkew and checks
+// that all of iss, aud, sub, iat, nbf and exp are present and iss and aud
+// have expected values.
+func (t *JWTIssuer) validate(c *Claims) error {
+	now := t.now().Unix()
+	skew := int64(clockSkew.Seconds())
+
+	switch {
+	case !c.VerifyExpiresAt(now-skew, true):
+		return errors.New("token is expired")
+	case !c.VerifyIssuedAt(now+skew, true):
+		return errors.New("token used before issued")
+	case !c.VerifyNotBefore(now+skew, true):
+		return errors.New("token is not valid yet")
+	case !c.VerifyIssuer(t.Issuer, true):
+		return errors.New("token has invalid issuer")
+	case !c.VerifyAudience(t.Audience, true):
+		return errors.New("token has invalid audience")
+	case c.Subject == "":
+		return errors.New("token has no subject")
+	case c.Id == "":
+		return errors.New("token has no ID")
+	}
+
+	return nil
+}
+
+// hasType reports whether the token is of one of the types.
+func (c *Claims) hasType(types []TokenType) bool {
+	for _, t := range types {
+		if c.TokenUse == t {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeToken revokes the token with claims c in Revocations until it expires.
+func (t *JWTIssuer) RevokeToken(ctx context.Context, c *Claims) error {
+	return t.Revocations.Revoke(ctx, c.Id, time.Unix(c.ExpiresAt, 0))
+}
+
+// RevokeSession revokes all access tokens issued with the sessionID, until the
+// last of them expires. Session IDs are random UUIDs, like IDs of tokens, so
+// they are kept in the same Revocations.
+func (t *JWTIssuer) RevokeSession(ctx context.Context, sessionID string) error {
+	expiresAt := t.now().Add(t.Lifetimes[TokenAccess] + clockSkew)
+	return t.Revocations.Revoke(ctx, sessionID, expiresAt)
+}
+
+// PublicKeys returns public parts of the Keys, published as a JWK set.
+func (t *JWTIssuer) PublicKeys() []*SigningKey {
+	return t.Keys.PublicKeys()
+}
 
-	return nil, errors.New("invalid JWT token")
+// CheckKeys returns an error if the Keys have no key to sign tokens with.
+func (t *JWTIssuer) CheckKeys() error {
+	_, err := t.Keys.Primary()
+	return err
 }
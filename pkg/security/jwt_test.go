@@ -1,17 +1,53 @@
 package security
 
 import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
 	"time"
+
+	jwtlib "github.com/golang-jwt/jwt"
 )
 
+var joe = Subject{UserID: "1", Username: "Joe"}
+
+// testLifetimes are lifetimes of tokens issued in tests.
+var testLifetimes = map[TokenType]time.Duration{
+	TokenMFAPending:        5 * time.Minute,
+	TokenAccess:            15 * time.Minute,
+	TokenRefresh:           30 * 24 * time.Hour,
+	TokenEmailVerification: 24 * time.Hour,
+}
+
+// newIssuer creates a JWTIssuer with a new random key of the algorithm and
+// a memory revocation store.
+func newIssuer(t *testing.T, alg string) *JWTIssuer {
+	t.Helper()
+
+	keys := NewKeyStore("", alg, KeyRetention(testLifetimes))
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	return &JWTIssuer{
+		Keys:        keys,
+		Revocations: NewMemoryRevocationStore(),
+		Lifetimes:   testLifetimes,
+		Issuer:      "GoAuth",
+		Audience:    "go-auth",
+	}
+}
+
 func TestGenerateJWTPayloadCorrectUsernameClaim(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
 	username := "Joe"
 	wantClaim := fmt.Sprintf("%q:%q", "username", username)
-	jwt, err := GenerateJWT(username, false)
+	jwt, err := issuer.GenerateJWT(TokenMFAPending, Subject{UserID: "1", Username: username})
 
 	if err != nil {
 		t.Fatalf("err was not nil, %q", err.Error())
@@ -28,10 +64,11 @@ func TestGenerateJWTPayloadCorrectUsernameClaim(t *testing.T) {
 }
 
 func TestGenerateJWTPayloadCorrectExpClaim(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
 	username := "Joe"
-	exp := time.Now().Add(expirationDurationUnauth)
+	exp := time.Now().Add(issuer.Lifetimes[TokenMFAPending])
 	wantClaim := fmt.Sprintf("%q:%d", "exp", exp.Unix())
-	jwt, err := GenerateJWT(username, false)
+	jwt, err := issuer.GenerateJWT(TokenMFAPending, Subject{UserID: "1", Username: username})
 
 	if err != nil {
 		t.Fatalf("err was not nil, %q", err.Error())
@@ -46,3 +83,297 @@ func TestGenerateJWTPayloadCorrectExpClaim(t *testing.T) {
 		t.Errorf("No valid exp claim in payload %s", payload)
 	}
 }
+
+func TestGenerateJWTHeaderContainsKid(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	key, _ := issuer.Keys.Primary()
+	wantHeader := fmt.Sprintf("%q:%q", "kid", key.ID)
+
+	jwt, err := issuer.GenerateJWT(TokenMFAPending, joe)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	jwtSplit := strings.Split(jwt, ".")
+
+	header, err := base64.RawURLEncoding.DecodeString(jwtSplit[0])
+	if err != nil {
+		t.Fatalf("decoding err was not nil, %q", err.Error())
+	}
+	if !strings.Contains(string(header), wantHeader) {
+		t.Errorf("No valid kid in header %s", header)
+	}
+}
+
+func TestValidateTokenAfterRotation(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	jwt, _ := issuer.GenerateJWT(TokenMFAPending, joe)
+
+	if _, err := issuer.Keys.Rotate(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	c, err := issuer.ValidateToken(context.Background(), jwt, TokenMFAPending)
+	if err != nil {
+		t.Fatalf("Token signed by a rotated key should be valid, but %q", err.Error())
+	}
+	if c.Username != "Joe" {
+		t.Errorf("Expected username to be %s, but was %s", "Joe", c.Username)
+	}
+}
+
+func TestValidateTokenUnknownKey(t *testing.T) {
+	jwt, _ := newIssuer(t, DefaultAlgorithm).GenerateJWT(TokenMFAPending, joe)
+	issuer := newIssuer(t, DefaultAlgorithm)
+
+	if _, err := issuer.ValidateToken(context.Background(), jwt, TokenMFAPending); err == nil {
+		t.Error("Token signed by an unknown key should not be valid")
+	}
+}
+
+func TestValidateTokenAsymmetricAlgorithms(t *testing.T) {
+	for _, alg := range []string{RS256, ES256, EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			issuer := newIssuer(t, alg)
+
+			jwt, err := issuer.GenerateJWT(TokenMFAPending, joe)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+
+			if _, err := issuer.ValidateToken(context.Background(), jwt, TokenMFAPending); err != nil {
+				t.Errorf("err was not nil, %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateTokenAlgorithmMismatch(t *testing.T) {
+	issuer := newIssuer(t, RS256)
+	key, _ := issuer.Keys.Primary()
+
+	// HS256 token using the public key of the RSA key as a HMAC secret
+	token := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, &Claims{Username: "Joe", TokenUse: TokenMFAPending})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(x509.MarshalPKCS1PublicKey(&key.PrivateKey.(*rsa.PrivateKey).PublicKey))
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if _, err := issuer.ValidateToken(context.Background(), signed, TokenMFAPending); err == nil {
+		t.Error("Token with a different algorithm than its key should not be valid")
+	}
+}
+
+func TestValidateTokenRevoked(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	jwt, _ := issuer.GenerateJWT(TokenAccess, Subject{UserID: "1", Username: "Joe", SessionID: "session"})
+
+	c, err := issuer.ValidateToken(context.Background(), jwt, TokenAccess)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if c.Id == "" {
+		t.Fatal("Token has no jti")
+	}
+	if c.SessionID != "session" {
+		t.Errorf("Expected sid to be %s, but was %s", "session", c.SessionID)
+	}
+
+	if err := issuer.RevokeToken(context.Background(), c); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if _, err := issuer.ValidateToken(context.Background(), jwt, TokenAccess); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, but was %v", err)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	session := Subject{UserID: "1", Username: "Joe", SessionID: "5f3c7e5a-5b4b-4c8a-9d1e-2f6a7b8c9d0e"}
+	access, _ := issuer.GenerateJWT(TokenAccess, session)
+	other, _ := issuer.GenerateJWT(TokenAccess, Subject{UserID: "1", Username: "Joe", SessionID: "other"})
+
+	if err := issuer.RevokeSession(context.Background(), session.SessionID); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if _, err := issuer.ValidateToken(context.Background(), access, TokenAccess); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Access token, expected ErrTokenRevoked, but was %v", err)
+	}
+	if _, err := issuer.ValidateToken(context.Background(), other, TokenAccess); err != nil {
+		t.Errorf("Token of other session should be valid, but %q", err.Error())
+	}
+}
+
+func TestGenerateJWTUniqueJti(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	jwt1, _ := issuer.GenerateJWT(TokenMFAPending, joe)
+	jwt2, _ := issuer.GenerateJWT(TokenMFAPending, joe)
+
+	c1, _ := issuer.ValidateToken(context.Background(), jwt1, TokenMFAPending)
+	c2, _ := issuer.ValidateToken(context.Background(), jwt2, TokenMFAPending)
+
+	if c1.Id == c2.Id {
+		t.Errorf("Tokens have the same jti %s", c1.Id)
+	}
+}
+
+func TestValidateTokenType(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	jwt, _ := issuer.GenerateJWT(TokenMFAPending, joe)
+
+	c, err := issuer.ValidateToken(context.Background(), jwt, TokenMFAPending, TokenAccess)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if c.TokenUse != TokenMFAPending {
+		t.Errorf("Expected token_use to be %s, but was %s", TokenMFAPending, c.TokenUse)
+	}
+	if c.Subject != joe.UserID {
+		t.Errorf("Expected sub to be %s, but was %s", joe.UserID, c.Subject)
+	}
+
+	if _, err := issuer.ValidateToken(context.Background(), jwt, TokenAccess, TokenRefresh); err == nil {
+		t.Error("Token of unexpected type should not be valid")
+	}
+}
+
+func TestGenerateJWTLifetimes(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	for typ, lifetime := range issuer.Lifetimes {
+		t.Run(string(typ), func(t *testing.T) {
+			jwt, err := issuer.GenerateJWT(typ, joe)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+
+			c, err := issuer.ValidateToken(context.Background(), jwt, typ)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+			if got := time.Duration(c.ExpiresAt-c.IssuedAt) * time.Second; got != lifetime {
+				t.Errorf("Expected lifetime to be %s, but was %s", lifetime, got)
+			}
+		})
+	}
+}
+
+func TestValidateTokenInvalidClaims(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	key, _ := issuer.Keys.Primary()
+	now := time.Now()
+	valid := func() *Claims {
+		return &Claims{
+			Username: "Joe",
+			TokenUse: TokenAccess,
+			StandardClaims: jwtlib.StandardClaims{
+				Id:        "id",
+				Subject:   "1",
+				Issuer:    issuer.Issuer,
+				Audience:  issuer.Audience,
+				IssuedAt:  now.Unix(),
+				NotBefore: now.Unix(),
+				ExpiresAt: now.Add(time.Minute).Unix(),
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+	}{
+		{"WrongIssuer", func(c *Claims) { c.Issuer = "Other" }},
+		{"WrongAudience", func(c *Claims) { c.Audience = "other" }},
+		{"MissingSubject", func(c *Claims) { c.Subject = "" }},
+		{"MissingIssuedAt", func(c *Claims) { c.IssuedAt = 0 }},
+		{"MissingNotBefore", func(c *Claims) { c.NotBefore = 0 }},
+		{"NotYetValid", func(c *Claims) { c.NotBefore = now.Add(time.Hour).Unix() }},
+		{"Expired", func(c *Claims) { c.ExpiresAt = now.Add(-time.Hour).Unix() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+
+			token := jwtlib.NewWithClaims(key.method(), c)
+			token.Header["kid"] = key.ID
+			signed, err := token.SignedString(key.signingKey())
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+
+			if _, err := issuer.ValidateToken(context.Background(), signed, TokenAccess); err == nil {
+				t.Error("Token with invalid claims should not be valid")
+			}
+		})
+	}
+}
+
+func TestValidateTokenClockSkew(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	key, _ := issuer.Keys.Primary()
+	now := time.Now()
+	c := &Claims{
+		Username: "Joe",
+		TokenUse: TokenAccess,
+		StandardClaims: jwtlib.StandardClaims{
+			Id:        "id",
+			Subject:   "1",
+			Issuer:    issuer.Issuer,
+			Audience:  issuer.Audience,
+			IssuedAt:  now.Add(clockSkew / 2).Unix(),
+			NotBefore: now.Add(clockSkew / 2).Unix(),
+			ExpiresAt: now.Add(-clockSkew / 2).Unix(),
+		},
+	}
+
+	token := jwtlib.NewWithClaims(key.method(), c)
+	token.Header["kid"] = key.ID
+	signed, _ := token.SignedString(key.signingKey())
+
+	if _, err := issuer.ValidateToken(context.Background(), signed, TokenAccess); err != nil {
+		t.Errorf("Token within clock skew should be valid, but %q", err.Error())
+	}
+}
+
+// fixedClock is a Clock telling a time set by a test.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestJWTIssuerClock(t *testing.T) {
+	clock := &fixedClock{now: time.Now()}
+	issuer := newIssuer(t, DefaultAlgorithm)
+	issuer.Clock = clock
+
+	token, err := issuer.GenerateJWT(TokenAccess, joe)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if _, err := issuer.ValidateToken(context.Background(), token, TokenAccess); err != nil {
+		t.Fatalf("Token should be valid, but %q", err.Error())
+	}
+
+	clock.now = clock.now.Add(issuer.Lifetimes[TokenAccess] + clockSkew + time.Second)
+	if _, err := issuer.ValidateToken(context.Background(), token, TokenAccess); err == nil {
+		t.Error("Token should expire by the clock of the issuer")
+	}
+}
+
+func TestJWTIssuerOtherAudience(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	token, _ := issuer.GenerateJWT(TokenAccess, joe)
+
+	other := *issuer
+	other.Audience = "other"
+
+	if _, err := other.ValidateToken(context.Background(), token, TokenAccess); err == nil {
+		t.Error("Token for a different audience should not be valid")
+	}
+}
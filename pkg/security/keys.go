@@ -0,0 +1,584 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported JWT signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+const (
+	// hmacKeyPEMType is a PEM block type of a HMAC signing key.
+	hmacKeyPEMType = "GOAUTH HMAC KEY"
+	// privateKeyPEMType is a PEM block type of a PKCS #8 private key used by
+	// asymmetric algorithms.
+	privateKeyPEMType = "PRIVATE KEY"
+	// keyFileExt is an extension of key files in a key directory.
+	keyFileExt = ".pem"
+	// keyReloadInterval is how often a key directory is checked for keys
+	// created by other instances.
+	keyReloadInterval = time.Minute
+
+	kidHeader     = "Kid"
+	createdHeader = "Created"
+	expiresHeader = "Expires"
+)
+
+var (
+	// ErrNoSigningKey is returned when a key store has no key usable for signing.
+	ErrNoSigningKey = errors.New("no signing key available")
+	// ErrUnknownKey is returned when a token references a key which is not in
+	// the key store, or which has already expired.
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// SigningKey is a key used for signing and validating JWT tokens. Each key is
+// identified by its ID, which is written into the kid header of every JWT
+// signed with it.
+type SigningKey struct {
+	// ID identifies the key in the kid header of a JWT.
+	ID string
+
+	// Algorithm is the JWT signing algorithm the key is used with.
+	Algorithm string
+
+	// Secret used by HMAC signing.
+	Secret []byte
+
+	// PrivateKey used by asymmetric signing, nil for HMAC keys.
+	PrivateKey crypto.Signer
+
+	// CreatedAt is when the key was generated. The newest key is used for
+	// signing.
+	CreatedAt time.Time
+
+	// ExpiresAt is when the key stops being accepted during validation of
+	// tokens. Zero value means that the key doesn't expire.
+	ExpiresAt time.Time
+}
+
+// expired reports whether the key is no longer valid at the time t.
+func (k *SigningKey) expired(t time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !t.Before(k.ExpiresAt)
+}
+
+// method returns the JWT signing method of the key.
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// signingKey returns the key in a form accepted by the signing method.
+func (k *SigningKey) signingKey() interface{} {
+	if k.Algorithm == HS256 {
+		return k.Secret
+	}
+	return k.PrivateKey
+}
+
+// verificationKey returns the key in a form accepted by the signing method
+// during validation of a signature.
+func (k *SigningKey) verificationKey() interface{} {
+	if k.Algorithm == HS256 {
+		return k.Secret
+	}
+	return k.PrivateKey.Public()
+}
+
+// GenerateSigningKey creates new signing key for the algorithm alg with
+// a random ID using crypto/rand.
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	key := &SigningKey{
+		Algorithm: alg,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	var err error
+	switch alg {
+	case HS256:
+		key.Secret = make([]byte, 64)
+		_, err = rand.Read(key.Secret)
+	case RS256:
+		key.PrivateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		key.PrivateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, key.PrivateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key.ID = hex.EncodeToString(id)
+
+	return key, nil
+}
+
+// EncodeKeyPEM encodes the key into a PEM block. HMAC secrets are stored as
+// they are, private keys in PKCS #8 form. Key ID, creation and expiration
+// time are stored as PEM headers.
+func EncodeKeyPEM(key *SigningKey) ([]byte, error) {
+	headers := map[string]string{
+		kidHeader:     key.ID,
+		createdHeader: key.CreatedAt.Format(time.RFC3339),
+	}
+	if !key.ExpiresAt.IsZero() {
+		headers[expiresHeader] = key.ExpiresAt.Format(time.RFC3339)
+	}
+
+	block := &pem.Block{Type: hmacKeyPEMType, Headers: headers, Bytes: key.Secret}
+	if key.Algorithm != HS256 {
+		der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		block.Type, block.Bytes = privateKeyPEMType, der
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
+
+// ParseKeysPEM parses all PEM encoded keys in data. An error is returned if
+// data contains no key or any of the keys is malformed.
+func ParseKeysPEM(data []byte) ([]*SigningKey, error) {
+	var keys []*SigningKey
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key, err := parseKeyBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded key found")
+	}
+
+	return keys, nil
+}
+
+// parseKeyBlock creates a SigningKey from a single PEM block. Algorithm of
+// a private key is determined by its type.
+func parseKeyBlock(block *pem.Block) (*SigningKey, error) {
+	key := &SigningKey{ID: block.Headers[kidHeader]}
+	if key.ID == "" {
+		return nil, errors.New("key has no kid")
+	}
+
+	switch block.Type {
+	case hmacKeyPEMType:
+		key.Algorithm, key.Secret = HS256, block.Bytes
+		if len(key.Secret) < 32 {
+			return nil, fmt.Errorf("key %s is shorter than 32 bytes", key.ID)
+		}
+
+	case privateKeyPEMType:
+		if err := parsePrivateKey(key, block.Bytes); err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", block.Type)
+	}
+
+	var err error
+	key.CreatedAt, err = time.Parse(time.RFC3339, block.Headers[createdHeader])
+	if err != nil {
+		return nil, fmt.Errorf("key %s has invalid creation time: %w", key.ID, err)
+	}
+
+	if exp, ok := block.Headers[expiresHeader]; ok {
+		key.ExpiresAt, err = time.Parse(time.RFC3339, exp)
+		if err != nil {
+			return nil, fmt.Errorf("key %s has invalid expiration time: %w", key.ID, err)
+		}
+	}
+
+	return key, nil
+}
+
+// parsePrivateKey parses PKCS #8 private key in der into the key and sets its
+// algorithm.
+func parsePrivateKey(key *SigningKey, der []byte) error {
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return err
+	}
+
+	switch pk := private.(type) {
+	case *rsa.PrivateKey:
+		if pk.N.BitLen() < 2048 {
+			return errors.New("RSA key is shorter than 2048 bits")
+		}
+		key.Algorithm, key.PrivateKey = RS256, pk
+	case *ecdsa.PrivateKey:
+		if pk.Curve != elliptic.P256() {
+			return errors.New("only P-256 curve is supported")
+		}
+		key.Algorithm, key.PrivateKey = ES256, pk
+	case ed25519.PrivateKey:
+		key.Algorithm, key.PrivateKey = EdDSA, pk
+	default:
+		return fmt.Errorf("unsupported private key %T", private)
+	}
+
+	return nil
+}
+
+// KeyStore holds all signing keys known to the application. The newest key
+// without an expiration is the primary one, used for signing. Older keys are
+// only used for validating tokens issued before a rotation, until they expire.
+// If the KeyStore has a directory, rotated keys are persisted there, so that
+// multiple instances sharing the directory accept each others tokens.
+type KeyStore struct {
+	mu      sync.RWMutex
+	keys    map[string]*SigningKey
+	primary *SigningKey
+
+	// dir is a directory in which keys are persisted, empty if none.
+	dir string
+	// algorithm is used for keys generated by a rotation.
+	algorithm string
+	// retention is for how long a key is accepted after it stopped being
+	// the primary key. It should be at least the longest token lifetime.
+	retention time.Duration
+}
+
+// NewKeyStore creates an empty KeyStore persisting keys into the dir. If dir
+// is empty, keys are only held in memory. Keys generated by rotations use the
+// algorithm alg.
+func NewKeyStore(dir, alg string, retention time.Duration) *KeyStore {
+	return &KeyStore{
+		keys:      make(map[string]*SigningKey),
+		dir:       dir,
+		algorithm: alg,
+		retention: retention,
+	}
+}
+
+// LoadKeyStore creates a KeyStore from keys in the dir and from PEM encoded
+// keys in pemKeys. If no key is found, new one is generated for the algorithm
+// alg and persisted into the dir.
+func LoadKeyStore(dir, pemKeys, alg string, retention time.Duration) (*KeyStore, error) {
+	if jwt.GetSigningMethod(alg) == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	ks := NewKeyStore(dir, alg, retention)
+
+	if pemKeys != "" {
+		keys, err := ParseKeysPEM([]byte(pemKeys))
+		if err != nil {
+			return nil, err
+		}
+		ks.add(keys...)
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		if err := ks.Reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := ks.Primary(); errors.Is(err, ErrNoSigningKey) {
+		if _, err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// Reload reads all keys from the directory of the KeyStore and adds the ones
+// not yet known. Keys already in the KeyStore are updated, so that expiration
+// set by other instances is respected.
+func (ks *KeyStore) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*"+keyFileExt))
+	if err != nil {
+		return err
+	}
+
+	var keys []*SigningKey
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+
+		fileKeys, err := ParseKeysPEM(data)
+		if err != nil {
+			return fmt.Errorf("key file %s: %w", f, err)
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	ks.add(keys...)
+	return nil
+}
+
+// Rotate generates new primary key. Every other key without an expiration,
+// including keys created by concurrent rotations of other instances sharing
+// the directory, is still accepted for validation during the retention period
+// of the KeyStore.
+func (ks *KeyStore) Rotate() (*SigningKey, error) {
+	key, err := GenerateSigningKey(ks.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	if err := ks.persist(key); err != nil {
+		return nil, err
+	}
+	ks.add(key)
+
+	if err := ks.retire(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Primary returns the key used for signing new tokens.
+func (ks *KeyStore) Primary() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.primary == nil || ks.primary.expired(time.Now()) {
+		return nil, ErrNoSigningKey
+	}
+
+	return ks.primary, nil
+}
+
+// Key returns a key specified by its ID. If the key is not known or has
+// already expired, ErrUnknownKey is returned.
+func (ks *KeyStore) Key(kid string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	if !ok || key.expired(time.Now()) {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// PublicKeys returns all non-expired asymmetric keys, whose public parts can
+// be published for validation of tokens by other services.
+func (ks *KeyStore) PublicKeys() []*SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		if k.Algorithm != HS256 && !k.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys
+}
+
+// StartRotation starts a goroutine which periodically reloads keys from the
+// directory of the KeyStore, removes expired keys and, if the interval is not
+// zero, rotates the primary key once it is older than the interval. Returned
+// function stops the goroutine.
+func (ks *KeyStore) StartRotation(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(keyReloadInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ks.tick(interval)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// tick is a single step of the rotation goroutine.
+func (ks *KeyStore) tick(interval time.Duration) {
+	if err := ks.Reload(); err != nil {
+		fmt.Printf("Reloading signing keys failed: %s\n", err)
+	}
+	if primary, err := ks.Primary(); err == nil {
+		if err := ks.retire(primary); err != nil {
+			fmt.Printf("Retiring signing keys failed: %s\n", err)
+		}
+	}
+	ks.prune()
+
+	if interval == 0 {
+		return
+	}
+
+	primary, err := ks.Primary()
+	if err == nil && time.Since(primary.CreatedAt) < interval {
+		return
+	}
+
+	if _, err := ks.Rotate(); err != nil {
+		fmt.Printf("Rotating signing key failed: %s\n", err)
+	}
+}
+
+// add adds keys into the KeyStore and recomputes the primary key.
+func (ks *KeyStore) add(keys ...*SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, k := range keys {
+		ks.keys[k.ID] = k
+	}
+
+	candidates := make([]*SigningKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		if k.ExpiresAt.IsZero() {
+			candidates = append(candidates, k)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].CreatedAt.Equal(candidates[j].CreatedAt) {
+			return candidates[i].ID > candidates[j].ID
+		}
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+
+	ks.primary = nil
+	if len(candidates) > 0 {
+		ks.primary = candidates[0]
+	}
+}
+
+// retire sets an expiration on every key without one, except the primary key,
+// and persists it. Instances rotating at the same time each create a key
+// without an expiration, only the newest of them stays primary and the rest
+// are retired, so that they are eventually pruned.
+func (ks *KeyStore) retire(primary *SigningKey) error {
+	ks.mu.RLock()
+	expires := time.Now().Add(ks.retention)
+	var retired []*SigningKey
+	for _, k := range ks.keys {
+		if k.ID != primary.ID && k.ExpiresAt.IsZero() {
+			r := *k
+			r.ExpiresAt = expires
+			retired = append(retired, &r)
+		}
+	}
+	ks.mu.RUnlock()
+
+	for _, k := range retired {
+		if err := ks.persist(k); err != nil {
+			return err
+		}
+	}
+
+	ks.add(retired...)
+	return nil
+}
+
+// prune removes expired keys from the KeyStore and from its directory.
+func (ks *KeyStore) prune() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	for id, k := range ks.keys {
+		if !k.expired(now) {
+			continue
+		}
+
+		delete(ks.keys, id)
+		if ks.dir != "" {
+			os.Remove(ks.keyPath(id))
+		}
+	}
+}
+
+// persist writes the key into the directory of the KeyStore, if it has one.
+// The key is firstly written into a temporary file, which is then renamed, so
+// that other instances never read a partially written key.
+func (ks *KeyStore) persist(key *SigningKey) error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	data, err := EncodeKeyPEM(key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(ks.dir, key.ID+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), ks.keyPath(key.ID))
+}
+
+// keyPath returns a path of the file with the key specified by kid.
+func (ks *KeyStore) keyPath(kid string) string {
+	return filepath.Join(ks.dir, kid+keyFileExt)
+}
@@ -0,0 +1,252 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeKeyPEMRoundTrip(t *testing.T) {
+	for _, alg := range []string{HS256, RS256, ES256, EdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+			key.ExpiresAt = key.CreatedAt.Add(time.Hour)
+
+			data, err := EncodeKeyPEM(key)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+			keys, err := ParseKeysPEM(data)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+
+			if len(keys) != 1 {
+				t.Fatalf("Expected 1 key, but was %d", len(keys))
+			}
+			got := keys[0]
+			if got.ID != key.ID {
+				t.Errorf("Expected kid to be %s, but was %s", key.ID, got.ID)
+			}
+			if got.Algorithm != alg {
+				t.Errorf("Expected algorithm to be %s, but was %s", alg, got.Algorithm)
+			}
+			if !bytes.Equal(got.Secret, key.Secret) {
+				t.Error("Decoded secret doesn't match the encoded one")
+			}
+			if !reflect.DeepEqual(got.verificationKey(), key.verificationKey()) {
+				t.Error("Decoded public key doesn't match the encoded one")
+			}
+			if !got.CreatedAt.Equal(key.CreatedAt) {
+				t.Errorf("Expected created to be %s, but was %s", key.CreatedAt, got.CreatedAt)
+			}
+			if !got.ExpiresAt.Equal(key.ExpiresAt) {
+				t.Errorf("Expected expires to be %s, but was %s", key.ExpiresAt, got.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestGenerateSigningKeyUnsupportedAlgorithm(t *testing.T) {
+	if _, err := GenerateSigningKey("none"); err == nil {
+		t.Error("error was expected")
+	}
+}
+
+func TestParseKeysPEMErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"Empty", ""},
+		{"NotPEM", "not a key"},
+		{"UnknownType", "-----BEGIN FOO-----\nAAAA\n-----END FOO-----\n"},
+		{"NoKid", "-----BEGIN GOAUTH HMAC KEY-----\nCreated: 2022-01-01T00:00:00Z\n\nAAAA\n-----END GOAUTH HMAC KEY-----\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseKeysPEM([]byte(tt.data)); err == nil {
+				t.Error("error was expected")
+			}
+		})
+	}
+}
+
+func TestKeyStoreRotateKeepsOldKey(t *testing.T) {
+	ks := NewKeyStore("", HS256, time.Hour)
+	old, err := ks.Rotate()
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	key, err := ks.Rotate()
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	primary, _ := ks.Primary()
+	if primary.ID != key.ID {
+		t.Errorf("Expected primary key to be %s, but was %s", key.ID, primary.ID)
+	}
+
+	retired, err := ks.Key(old.ID)
+	if err != nil {
+		t.Fatalf("Old key should still be accepted, but %q", err.Error())
+	}
+	if retired.ExpiresAt.IsZero() {
+		t.Error("Old key should have an expiration")
+	}
+}
+
+func TestKeyStoreExpiredKey(t *testing.T) {
+	ks := NewKeyStore("", HS256, 0)
+	old, _ := ks.Rotate()
+	ks.Rotate()
+
+	if _, err := ks.Key(old.ID); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, but was %v", err)
+	}
+
+	ks.prune()
+	if _, ok := ks.keys[old.ID]; ok {
+		t.Error("Expired key was not pruned")
+	}
+}
+
+func TestKeyStoreSharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := LoadKeyStore(dir, "", HS256, time.Hour)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	second, err := LoadKeyStore(dir, "", HS256, time.Hour)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	p1, _ := first.Primary()
+	p2, _ := second.Primary()
+	if p1.ID != p2.ID {
+		t.Fatalf("Instances sharing a directory have different keys %s, %s", p1.ID, p2.ID)
+	}
+
+	key, _ := first.Rotate()
+	if err := second.Reload(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	p2, _ = second.Primary()
+	if p2.ID != key.ID {
+		t.Errorf("Expected primary key after reload to be %s, but was %s", key.ID, p2.ID)
+	}
+	if _, err := second.Key(p1.ID); err != nil {
+		t.Errorf("Retired key should still be accepted, but %q", err.Error())
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if len(files) != 2 {
+		t.Errorf("Expected 2 key files, but was %d", len(files))
+	}
+}
+
+func TestKeyStoreConcurrentRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := LoadKeyStore(dir, "", HS256, time.Hour)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	second, err := LoadKeyStore(dir, "", HS256, time.Hour)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if _, err := first.Rotate(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	if _, err := second.Rotate(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	// a key persisted by a rotation, which the first store didn't see yet
+	concurrent, _ := GenerateSigningKey(HS256)
+	if err := second.persist(concurrent); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	first.tick(0)
+	second.tick(0)
+
+	p1, _ := first.Primary()
+	p2, _ := second.Primary()
+	if p1.ID != p2.ID {
+		t.Errorf("Instances sharing a directory have different primary keys %s, %s", p1.ID, p2.ID)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if len(files) != 4 {
+		t.Errorf("Expected 4 key files, but was %d", len(files))
+	}
+
+	unexpiring := 0
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		keys, err := ParseKeysPEM(data)
+		if err != nil {
+			t.Fatalf("err was not nil, %q", err.Error())
+		}
+		if keys[0].ExpiresAt.IsZero() {
+			unexpiring++
+		}
+	}
+	if unexpiring != 1 {
+		t.Errorf("Expected 1 key without an expiration, but was %d", unexpiring)
+	}
+}
+
+func TestLoadKeyStoreFromPEM(t *testing.T) {
+	key, _ := GenerateSigningKey(ES256)
+	data, _ := EncodeKeyPEM(key)
+
+	ks, err := LoadKeyStore("", string(data), HS256, time.Hour)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	primary, _ := ks.Primary()
+	if primary.ID != key.ID {
+		t.Errorf("Expected primary key to be %s, but was %s", key.ID, primary.ID)
+	}
+}
+
+func TestLoadKeyStoreInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "broken"+keyFileExt), []byte("broken"), 0600)
+
+	if _, err := LoadKeyStore(dir, "", HS256, time.Hour); err == nil {
+		t.Error("error was expected")
+	}
+}
+
+func TestKeyStorePublicKeysSkipsHMAC(t *testing.T) {
+	ks := NewKeyStore("", HS256, time.Hour)
+	ks.Rotate()
+	rsaKey, _ := GenerateSigningKey(RS256)
+	ks.add(rsaKey)
+
+	keys := ks.PublicKeys()
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 public key, but was %d", len(keys))
+	}
+	if keys[0].ID != rsaKey.ID {
+		t.Errorf("Expected public key to be %s, but was %s", rsaKey.ID, keys[0].ID)
+	}
+}
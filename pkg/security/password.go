@@ -0,0 +1,153 @@
+package security
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Default length limits of passwords, in characters.
+const (
+	DefaultMinPasswordLength = 8
+	DefaultMaxPasswordLength = 64
+)
+
+// minPersonalInfoLength is a minimal length of a username or an email, which
+// passwords must not contain. Shorter ones would reject too many passwords.
+const minPersonalInfoLength = 3
+
+// ErrWeakPassword is wrapped by errors of PasswordPolicy.Check.
+var ErrWeakPassword = errors.New("password doesn't satisfy the password policy")
+
+// PolicyError lists all rules of a PasswordPolicy broken by a password.
+type PolicyError struct {
+	// Reasons describe each broken rule.
+	Reasons []string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, strings.Join(e.Reasons, ", "))
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// PasswordPolicy is a set of rules, which new passwords must satisfy.
+// Passwords must never contain the username or the email address of their
+// user, the other rules are configurable.
+type PasswordPolicy struct {
+	// MinLength and MaxLength limit a number of characters.
+	MinLength, MaxLength int
+	// MaxBytes limits a length in bytes of UTF-8 encoded passwords, e.g. to
+	// BcryptMaxPasswordBytes, zero means no limit.
+	MaxBytes int
+	// RequireUppercase, RequireLowercase, RequireDigit and RequireSymbol
+	// require at least one character of the class.
+	RequireUppercase, RequireLowercase, RequireDigit, RequireSymbol bool
+	// Denylist of common passwords, which are rejected.
+	Denylist Denylist
+}
+
+// Check returns a *PolicyError if the password of the user with the username
+// and the email breaks any rule of the policy.
+func (p *PasswordPolicy) Check(password, username, email string) error {
+	var reasons []string
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		reasons = append(reasons, fmt.Sprintf("must have at least %d characters", p.MinLength))
+	} else if p.MaxLength > 0 && n > p.MaxLength {
+		reasons = append(reasons, fmt.Sprintf("must have at most %d characters", p.MaxLength))
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		reasons = append(reasons, fmt.Sprintf("must have at most %d bytes", p.MaxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		reasons = append(reasons, "must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !lower {
+		reasons = append(reasons, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		reasons = append(reasons, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		reasons = append(reasons, "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(email, "@")
+	for _, info := range []string{username, email, localPart} {
+		if len(info) >= minPersonalInfoLength && strings.Contains(lowered, strings.ToLower(info)) {
+			reasons = append(reasons, "must not contain the username or the email address")
+			break
+		}
+	}
+
+	if p.Denylist.Contains(password) {
+		reasons = append(reasons, "is too common")
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// Denylist is a set of common passwords, compared case-insensitively.
+type Denylist map[string]struct{}
+
+// ReadDenylist reads a Denylist with one password per line from the r. Empty
+// lines and lines starting with # are skipped.
+func ReadDenylist(r io.Reader) (Denylist, error) {
+	d := make(Denylist)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// LoadDenylist reads a Denylist from the file at the path, see ReadDenylist.
+func LoadDenylist(path string) (Denylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadDenylist(f)
+}
+
+// Contains reports whether the password is in the Denylist.
+func (d Denylist) Contains(password string) bool {
+	_, ok := d[strings.ToLower(password)]
+	return ok
+}
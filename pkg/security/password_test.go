@@ -0,0 +1,112 @@
+package security
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var policy = &PasswordPolicy{
+	MinLength:        8,
+	MaxLength:        64,
+	RequireUppercase: true,
+	RequireLowercase: true,
+	RequireDigit:     true,
+	Denylist:         Denylist{"passw0rd1": {}},
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		reasons  []string
+	}{
+		{"Valid", "S3cret-pass", nil},
+		{"MaxLength", strings.Repeat("S3cret-p", 8), nil},
+		{"LongerThan32", "Correct horse battery staple 42!", nil},
+		{"NonASCII", "Žltý1kôňík", nil},
+		{"TooShort", "S3cret", []string{"must have at least 8 characters"}},
+		{"TooLong", strings.Repeat("S3cret-p", 8) + "x", []string{"must have at most 64 characters"}},
+		{"NoUppercase", "s3cret-pass", []string{"must contain an uppercase letter"}},
+		{"NoLowercase", "S3CRET-PASS", []string{"must contain a lowercase letter"}},
+		{"NoDigit", "Secret-pass", []string{"must contain a digit"}},
+		{"Username", "My-Susan-42", []string{"must not contain the username or the email address"}},
+		{"EmailLocalPart", "SUSANNA-42x", []string{"must not contain the username or the email address"}},
+		{"Denylisted", "PASSw0rd1", []string{"is too common"}},
+		{"Multiple", "short", []string{
+			"must have at least 8 characters", "must contain an uppercase letter", "must contain a digit",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, "Susan", "susanna@barz.com")
+
+			if tt.reasons == nil {
+				if err != nil {
+					t.Errorf("err was not nil, %q", err.Error())
+				}
+				return
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, ErrWeakPassword) {
+				t.Fatalf("Expected PolicyError, but was %v", err)
+			}
+			if !reflect.DeepEqual(policyErr.Reasons, tt.reasons) {
+				t.Errorf("Expected reasons %q, but was %q", tt.reasons, policyErr.Reasons)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyRequireSymbol(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 1, RequireSymbol: true}
+
+	if err := p.Check("S3cretpass", "", ""); err == nil {
+		t.Error("error was expected")
+	}
+	if err := p.Check("S3cret+pass", "", ""); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	}
+}
+
+func TestPasswordPolicyMaxBytes(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 1, MaxLength: 64, MaxBytes: BcryptMaxPasswordBytes}
+	multibyte := strings.Repeat("Ž", 40)
+
+	err := p.Check(multibyte, "", "")
+
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) || !reflect.DeepEqual(policyErr.Reasons, []string{"must have at most 72 bytes"}) {
+		t.Errorf("Expected password over 72 bytes to be rejected, but was %v", err)
+	}
+	if err := p.Check(strings.Repeat("Ž", 36), "", ""); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	}
+}
+
+func TestLoadDenylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	os.WriteFile(path, []byte("# common passwords\n123456\n\n  Password1 \n"), 0600)
+
+	d, err := LoadDenylist(path)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if len(d) != 2 || !d.Contains("123456") || !d.Contains("PASSWORD1") {
+		t.Errorf("Expected 2 passwords, but was %v", d)
+	}
+	if d.Contains("# common passwords") {
+		t.Error("Expected comments to be skipped")
+	}
+}
+
+func TestLoadDenylistMissingFile(t *testing.T) {
+	if _, err := LoadDenylist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("error was expected")
+	}
+}
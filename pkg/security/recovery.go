@@ -0,0 +1,67 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+)
+
+// RecoveryCodeCount is a number of recovery codes generated for a user.
+const RecoveryCodeCount = 10
+
+// recoveryCodeSize is a number of random Bytes of a recovery code, encoded
+// into 16 characters.
+const recoveryCodeSize = 10
+
+// recoveryCodeGroup is a length of groups of characters of recovery codes,
+// separated by dashes for readability.
+const recoveryCodeGroup = 4
+
+// RecoveryCodes are random single-use codes, which replace an OTP when a user
+// loses the authenticator device. Codes are shown to the user only once, only
+// their hashes are meant to be stored.
+type RecoveryCodes struct {
+	// Codes are shown to the user, e.g. abcd-efgh-ijkl-mnop.
+	Codes []string
+
+	// Hashes are SHA-256 hashes of the Codes, in the same order.
+	Hashes []string
+}
+
+// NewRecoveryCodes generates n new RecoveryCodes.
+func NewRecoveryCodes(n int) (*RecoveryCodes, error) {
+	codes := &RecoveryCodes{Codes: make([]string, n), Hashes: make([]string, n)}
+
+	random := make([]byte, recoveryCodeSize)
+	for i := range codes.Codes {
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		encoded := strings.ToLower(base32.StdEncoding.EncodeToString(random))
+
+		groups := make([]string, 0, len(encoded)/recoveryCodeGroup)
+		for len(encoded) > 0 {
+			groups = append(groups, encoded[:recoveryCodeGroup])
+			encoded = encoded[recoveryCodeGroup:]
+		}
+
+		codes.Codes[i] = strings.Join(groups, "-")
+		codes.Hashes[i] = HashRecoveryCode(codes.Codes[i])
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns a hex encoded SHA-256 hash of the code. Case,
+// dashes and white space are ignored, so codes can be typed the way they are
+// read.
+func HashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+
+	return hashToken(normalized)
+}
@@ -0,0 +1,46 @@
+package security
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if len(codes.Codes) != RecoveryCodeCount || len(codes.Hashes) != RecoveryCodeCount {
+		t.Fatalf("Expected %d codes and hashes, but was %d and %d", RecoveryCodeCount, len(codes.Codes), len(codes.Hashes))
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := make(map[string]bool)
+	for i, code := range codes.Codes {
+		if !format.MatchString(code) {
+			t.Errorf("Unexpected format of code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Generated code %q is not unique", code)
+		}
+		seen[code] = true
+
+		if codes.Hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("Hash of code %q doesn't match", code)
+		}
+	}
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+	want := HashRecoveryCode("abcd-efgh-ijkl-mnop")
+
+	for _, code := range []string{"abcdefghijklmnop", "ABCD-EFGH-IJKL-MNOP", " abcd efgh ijkl mnop "} {
+		if got := HashRecoveryCode(code); got != want {
+			t.Errorf("Expected %q to have the same hash as abcd-efgh-ijkl-mnop", code)
+		}
+	}
+	if HashRecoveryCode("abcd-efgh-ijkl-mnoq") == want {
+		t.Error("Expected different codes to have different hashes")
+	}
+}
@@ -0,0 +1,40 @@
+package security
+
+import "time"
+
+// refreshTokenSize is a number of random Bytes of a RefreshToken.
+const refreshTokenSize = 32
+
+// RefreshToken is a random opaque token, which can be exchanged for a new
+// access token. It is not a JWT, so no verifier of access tokens can accept
+// it, and it is valid only while its hash is stored.
+type RefreshToken struct {
+	// Token is sent to the user.
+	Token string
+
+	// Hash is a SHA-256 hash of the Token.
+	Hash string
+
+	// ExpiresAt is when the token expires.
+	ExpiresAt time.Time
+}
+
+// GenerateRefreshToken generates new refresh token, which expires after the
+// lifetime of TokenRefresh.
+func (t *JWTIssuer) GenerateRefreshToken() (*RefreshToken, error) {
+	token, err := randomToken(refreshTokenSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RefreshToken{
+		Token:     token,
+		Hash:      HashRefreshToken(token),
+		ExpiresAt: t.now().Add(t.Lifetimes[TokenRefresh]).Truncate(time.Second),
+	}, nil
+}
+
+// HashRefreshToken returns a hex encoded SHA-256 hash of the token.
+func HashRefreshToken(token string) string {
+	return hashToken(token)
+}
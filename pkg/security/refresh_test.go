@@ -0,0 +1,52 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGenerateRefreshTokenHash(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	rt, err := issuer.GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if rt.Hash != HashRefreshToken(rt.Token) {
+		t.Error("Hash doesn't match the token")
+	}
+	if rt.Hash == rt.Token {
+		t.Error("Hash must not be the token itself")
+	}
+	if !rt.ExpiresAt.After(time.Now()) {
+		t.Errorf("Expected token to expire in future, but was %s", rt.ExpiresAt)
+	}
+}
+
+func TestGenerateRefreshTokenUnique(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	rt1, _ := issuer.GenerateRefreshToken()
+	rt2, _ := issuer.GenerateRefreshToken()
+
+	if rt1.Token == rt2.Token {
+		t.Error("Generated refresh tokens are the same")
+	}
+}
+
+func TestGenerateRefreshTokenIsNotJWT(t *testing.T) {
+	issuer := newIssuer(t, DefaultAlgorithm)
+	rt, _ := issuer.GenerateRefreshToken()
+
+	if _, err := issuer.ValidateToken(context.Background(), rt.Token, TokenRefresh, TokenAccess); err == nil {
+		t.Error("Refresh token should not be accepted as a JWT")
+	}
+}
+
+func TestKeyRetentionSkipsRefreshTokens(t *testing.T) {
+	retention := KeyRetention(testLifetimes)
+
+	if retention != testLifetimes[TokenEmailVerification] {
+		t.Errorf("Expected retention %s, but was %s", testLifetimes[TokenEmailVerification], retention)
+	}
+}
@@ -0,0 +1,61 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// resetTokenSize is a number of random Bytes of a ResetToken.
+const resetTokenSize = 32
+
+// ResetToken is a random single-use token for resetting a password, sent to
+// the email address of a user. Only its hash is meant to be stored.
+type ResetToken struct {
+	// Token is sent to the user.
+	Token string
+
+	// Hash is a SHA-256 hash of the Token.
+	Hash string
+
+	// ExpiresAt is when the token expires.
+	ExpiresAt time.Time
+}
+
+// NewResetToken generates a new ResetToken, which expires at expiresAt.
+func NewResetToken(expiresAt time.Time) (*ResetToken, error) {
+	token, err := randomToken(resetTokenSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResetToken{
+		Token:     token,
+		Hash:      HashResetToken(token),
+		ExpiresAt: expiresAt.Truncate(time.Second),
+	}, nil
+}
+
+// randomToken returns size random Bytes encoded by URL safe base64.
+func randomToken(size int) (string, error) {
+	random := make([]byte, size)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// HashResetToken returns a hex encoded SHA-256 hash of the token.
+func HashResetToken(token string) string {
+	return hashToken(token)
+}
+
+// hashToken returns a hex encoded SHA-256 hash of a random token. Unlike
+// passwords, random tokens can't be guessed from a dictionary, so a fast hash
+// is sufficient.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,34 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewResetToken(t *testing.T) {
+	expiresAt := time.Now().Add(15 * time.Minute)
+
+	rt, err := NewResetToken(expiresAt)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if rt.Hash != HashResetToken(rt.Token) {
+		t.Error("Hash doesn't match the token")
+	}
+	if rt.Hash == rt.Token {
+		t.Error("Hash must not be the token itself")
+	}
+	if !rt.ExpiresAt.Equal(expiresAt.Truncate(time.Second)) {
+		t.Errorf("Expected token to expire at %s, but was %s", expiresAt, rt.ExpiresAt)
+	}
+}
+
+func TestNewResetTokenUnique(t *testing.T) {
+	rt1, _ := NewResetToken(time.Now())
+	rt2, _ := NewResetToken(time.Now())
+
+	if rt1.Token == rt2.Token {
+		t.Error("Generated reset tokens are the same")
+	}
+}
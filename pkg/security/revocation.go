@@ -0,0 +1,82 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// revocationSweepInterval is how often expired entries are removed from
+// a MemoryRevocationStore.
+const revocationSweepInterval = time.Minute
+
+// ErrTokenRevoked is returned when a validated token was revoked.
+var ErrTokenRevoked = errors.New("token was revoked")
+
+// RevocationStore keeps IDs (jti claims) of revoked tokens. An entry is only
+// needed until the revoked token expires, after that the token is rejected
+// anyway, so stores are expected to forget expired entries.
+type RevocationStore interface {
+
+	// Revoke marks the token with the jti as revoked until expiresAt.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// IsRevoked reports whether the token with the jti was revoked.
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// MemoryRevocationStore is a RevocationStore held in memory, usable only with
+// a single instance of the application.
+type MemoryRevocationStore struct {
+	mu        sync.Mutex
+	revoked   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryRevocationStore creates an empty MemoryRevocationStore.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked:   make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Revoke marks the token with the jti as revoked until expiresAt. Expired
+// entries are periodically removed.
+func (s *MemoryRevocationStore) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= revocationSweepInterval {
+		for id, exp := range s.revoked {
+			if !now.Before(exp) {
+				delete(s.revoked, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked reports whether the token with the jti was revoked and the
+// revocation hasn't expired yet.
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.revoked[jti]
+	if !ok {
+		return false, nil
+	}
+
+	if !time.Now().Before(exp) {
+		delete(s.revoked, jti)
+		return false, nil
+	}
+
+	return true, nil
+}
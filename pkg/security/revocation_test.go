@@ -0,0 +1,60 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	s := NewMemoryRevocationStore()
+	s.Revoke(context.Background(), "revoked", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name string
+		jti  string
+		want bool
+	}{
+		{"Revoked", "revoked", true},
+		{"NotRevoked", "valid", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.IsRevoked(context.Background(), tt.jti)
+			if err != nil {
+				t.Fatalf("err was not nil, %q", err.Error())
+			}
+			if got != tt.want {
+				t.Errorf("Expected %v, but was %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStoreExpiredEntry(t *testing.T) {
+	s := NewMemoryRevocationStore()
+	s.Revoke(context.Background(), "expired", time.Now().Add(-time.Second))
+
+	revoked, _ := s.IsRevoked(context.Background(), "expired")
+	if revoked {
+		t.Error("Expired revocation should be forgotten")
+	}
+	if _, ok := s.revoked["expired"]; ok {
+		t.Error("Expired entry was not removed")
+	}
+}
+
+func TestMemoryRevocationStoreSweep(t *testing.T) {
+	s := NewMemoryRevocationStore()
+	s.Revoke(context.Background(), "expired", time.Now().Add(-time.Second))
+	s.lastSweep = time.Now().Add(-revocationSweepInterval)
+
+	s.Revoke(context.Background(), "other", time.Now().Add(time.Hour))
+
+	if _, ok := s.revoked["expired"]; ok {
+		t.Error("Expired entry was not swept")
+	}
+	if len(s.revoked) != 1 {
+		t.Errorf("Expected 1 entry, but was %d", len(s.revoked))
+	}
+}
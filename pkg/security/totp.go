@@ -0,0 +1,43 @@
+package security
+
+import (
+	"time"
+
+	"github.com/dgryski/dgoogauth"
+)
+
+// totpPeriod is a period of time based OTPs, after which a new code is
+// generated.
+const totpPeriod = 30 * time.Second
+
+// TOTPVerifier verifies time based one-time passwords (RFC 6238) generated by
+// authenticator apps.
+type TOTPVerifier struct {
+	// Window is a number of accepted codes around the current one, to
+	// tolerate clocks of devices which are slightly off.
+	Window int
+	// Clock tells the current time, nil means the system time.
+	Clock Clock
+}
+
+// Verify reports whether the otp is the code of the base32 encoded secret at
+// the current time, or at a time within the Window. OTPs are sent as numbers,
+// so a code with leading zeros is a number below 100000.
+func (v TOTPVerifier) Verify(secret string, otp int) bool {
+	if secret == "" || otp < 0 || otp > 999999 {
+		return false
+	}
+
+	now := time.Now()
+	if v.Clock != nil {
+		now = v.Clock.Now()
+	}
+
+	t0 := now.Unix() / int64(totpPeriod.Seconds())
+	for t := t0 - int64(v.Window/2); t <= t0+int64(v.Window/2); t++ {
+		if dgoogauth.ComputeCode(secret, t) == otp {
+			return true
+		}
+	}
+	return false
+}
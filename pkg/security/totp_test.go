@@ -0,0 +1,38 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgryski/dgoogauth"
+)
+
+func TestTOTPVerifier(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1700000000, 0)
+	t0 := now.Unix() / 30
+	v := TOTPVerifier{Window: 3, Clock: &fixedClock{now: now}}
+
+	tests := []struct {
+		name   string
+		secret string
+		otp    int
+		want   bool
+	}{
+		{"Current", secret, dgoogauth.ComputeCode(secret, t0), true},
+		{"Previous", secret, dgoogauth.ComputeCode(secret, t0-1), true},
+		{"Next", secret, dgoogauth.ComputeCode(secret, t0+1), true},
+		{"OutsideWindow", secret, dgoogauth.ComputeCode(secret, t0-2), false},
+		{"NoSecret", "", dgoogauth.ComputeCode("", t0), false},
+		{"Negative", secret, -1, false},
+		{"TooLong", secret, 1000000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Verify(tt.secret, tt.otp); got != tt.want {
+				t.Errorf("Expected %v, but was %v", tt.want, got)
+			}
+		})
+	}
+}
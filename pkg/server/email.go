@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/mail"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// VerifyEmail verifies the email address of the user, to whom the submitted
+// token was sent after signing up. The token is revoked afterwards, so it can
+// be used only once.
+func (s GoAuthServer) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	var req api.VerifyEmailJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, maxTokenSize)
+	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	c, err := s.tokens.ValidateToken(r.Context(), req.Token, security.TokenEmailVerification)
+	if errors.Is(err, context.DeadlineExceeded) {
+		respondWithError(w, ServiceUnavailable(r.URL.Path))
+		return
+	} else if err != nil {
+		respondWithError(w, InvalidVerificationToken(r.URL.Path))
+		return
+	}
+
+	if err := s.store.UpdateEmailVerified(r.Context(), c.Username, true); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+	if err := s.tokens.RevokeToken(r.Context(), c); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendVerificationEmail sends a new email verification token to the email
+// address of the user.
+func (s GoAuthServer) sendVerificationEmail(ctx context.Context, user *db.UserDBEntity) error {
+	token, err := s.tokens.GenerateJWT(security.TokenEmailVerification, security.Subject{
+		UserID:   user.Uuid.String(),
+		Username: user.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, verificationMessage(user, token, s.verificationURL))
+}
+
+// verificationMessage returns an email with the token verifying the email
+// address of the user. If the verificationURL is set, the email contains
+// a link to it with the token in the token query parameter, otherwise only
+// the token.
+func verificationMessage(user *db.UserDBEntity, token, verificationURL string) mail.Message {
+	body := fmt.Sprintf("Hi %s,\n\nverify your email address with this token:\n\n%s\n", user.Username, token)
+	if link, ok := tokenLink(verificationURL, token); ok {
+		body = fmt.Sprintf("Hi %s,\n\nverify your email address by opening this link:\n\n%s\n", user.Username, link)
+	}
+
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    body + "\nIf you didn't sign up, ignore this email.\n",
+	}
+}
+
+// tokenLink returns the page URL with the token in its token query parameter.
+// Returns false if the page isn't set or isn't a valid URL.
+func tokenLink(page, token string) (string, bool) {
+	u, err := url.Parse(page)
+	if page == "" || err != nil {
+		return "", false
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
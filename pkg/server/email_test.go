@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/mail"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// tokenFromLink returns the token query parameter of the verification link
+// in the body of the msg.
+func tokenFromLink(t *testing.T, msg mail.Message) string {
+	t.Helper()
+
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if u, err := url.Parse(line); err == nil && u.Query().Has("token") {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("Expected a verification link in %q", msg.Body)
+	return ""
+}
+
+func TestSignupVerifyEmailFlow(t *testing.T) {
+	t.Parallel()
+	cfg := config.Default()
+	cfg.Email.RequireVerified = true
+	cfg.Email.VerificationURL = "https://example.com/verify?lang=en"
+	s := newTestServerWithConfig(t, cfg, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	signup := api.SignupRequest{Username: "Flow", Email: "flow@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", signup, nil); code != http.StatusCreated {
+		t.Fatalf("Signup, expected %d, but was %d", http.StatusCreated, code)
+	}
+
+	s.server.Wait()
+	sent := s.mailbox.sent()
+	if len(sent) != 1 || sent[0].To != signup.Email {
+		t.Fatalf("Expected one email to %s, but was %+v", signup.Email, sent)
+	}
+	if !strings.Contains(sent[0].Body, "https://example.com/verify?") {
+		t.Errorf("Expected a link to the verification page, but was %q", sent[0].Body)
+	}
+	token := tokenFromLink(t, sent[0])
+
+	var problem api.ProblemDetails
+	credentials := api.LoginRequest{Username: signup.Username, Password: signup.Password}
+	if code := post(t, ts, "/login", "", credentials, &problem); code != http.StatusForbidden {
+		t.Errorf("Login with unverified email, expected %d, but was %d", http.StatusForbidden, code)
+	}
+	if problem.Title != "Email not verified" {
+		t.Errorf("Title, expected %q, but was %q", "Email not verified", problem.Title)
+	}
+
+	if code := post(t, ts, "/email/verify", "", api.EmailVerificationRequest{Token: token}, nil); code != http.StatusNoContent {
+		t.Fatalf("Verify email, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	if user, _ := s.store.UserByUsername(context.Background(), signup.Username); !user.EmailVerified {
+		t.Error("Expected email to be verified")
+	}
+
+	if code := post(t, ts, "/login", "", credentials, nil); code != http.StatusOK {
+		t.Errorf("Login with verified email, expected %d, but was %d", http.StatusOK, code)
+	}
+
+	if code := post(t, ts, "/email/verify", "", api.EmailVerificationRequest{Token: token}, nil); code != http.StatusBadRequest {
+		t.Errorf("Reused verification token, expected %d, but was %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestLoginUnverifiedEmailAllowedByDefault(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	credentials := api.LoginRequest{Username: susan.Username, Password: "123"}
+	if code := post(t, ts, "/login", "", credentials, nil); code != http.StatusOK {
+		t.Errorf("Login with unverified email, expected %d, but was %d", http.StatusOK, code)
+	}
+}
+
+func TestVerifyEmailInvalidToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"Malformed", "not.a.token"},
+		{"OtherTokenType", access},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var problem api.ProblemDetails
+			code := post(t, ts, "/email/verify", "", api.EmailVerificationRequest{Token: tc.token}, &problem)
+
+			if code != http.StatusBadRequest {
+				t.Errorf("Expected status code to be %d, but was %d", http.StatusBadRequest, code)
+			}
+			if problem.Title != "Invalid verification token" {
+				t.Errorf("Title, expected %q, but was %q", "Invalid verification token", problem.Title)
+			}
+		})
+	}
+}
+
+// failingMailer is a mail.Mailer which can't send any email.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mail.Message) error {
+	return errors.New("mail server unreachable")
+}
+
+func TestSignupMailerFails(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Mailer: failingMailer{}})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	signup := api.SignupRequest{Username: "Flow", Email: "flow@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", signup, nil); code != http.StatusCreated {
+		t.Errorf("Signup, expected %d, but was %d", http.StatusCreated, code)
+	}
+	if _, err := s.store.UserByUsername(context.Background(), signup.Username); err != nil {
+		t.Errorf("Expected user to be saved, but %q", err.Error())
+	}
+}
+
+// blockingMailer is a mail.Mailer whose Send blocks until release is closed.
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestSignupDoesNotWaitForMailer(t *testing.T) {
+	t.Parallel()
+	mailer := blockingMailer{release: make(chan struct{})}
+	s := newTestServer(t, Dependencies{Mailer: mailer})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	signup := api.SignupRequest{Username: "Flow", Email: "flow@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", signup, nil); code != http.StatusCreated {
+		t.Errorf("Signup, expected %d, but was %d", http.StatusCreated, code)
+	}
+
+	close(mailer.release)
+	s.server.Wait()
+}
+
+func TestVerificationMessageWithoutURL(t *testing.T) {
+	user, _ := newTestServer(t, Dependencies{}).store.UserByUsername(context.Background(), susan.Username)
+
+	msg := verificationMessage(user, "t0k3n", "")
+
+	if msg.To != "susan@barz.com" || !strings.Contains(msg.Body, "\nt0k3n\n") {
+		t.Errorf("Expected email with the token to susan, but was %+v", msg)
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/security"
+	"github.com/dgryski/dgoogauth"
+)
+
+// post sends the JSON body to the path of the ts with the bearer token, if
+// set, and decodes the response into the dest. Returns the status code.
+func post(t *testing.T, ts *httptest.Server, path, token string, body, dest any) int {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatal("Error in encoding of struct")
+	}
+
+	req, _ := http.NewRequest("POST", ts.URL+path, &buf)
+	req.Header.Add(consts.ContentType, consts.ApplicationJSON)
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	defer res.Body.Close()
+
+	if dest != nil {
+		json.NewDecoder(res.Body).Decode(dest)
+	}
+	return res.StatusCode
+}
+
+// get sends a GET request to the path of the ts with the bearer token and
+// decodes the response into the dest. Returns the status code.
+func get(t *testing.T, ts *httptest.Server, path, token string, dest any) int {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", ts.URL+path, nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	defer res.Body.Close()
+
+	if dest != nil {
+		json.NewDecoder(res.Body).Decode(dest)
+	}
+	return res.StatusCode
+}
+
+// testAuth calls the endpoint requiring full access with the token and
+// returns the status code.
+func testAuth(t *testing.T, ts *httptest.Server, token string) int {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/test-auth", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestSignupLogin2FAFlow(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	signup := api.SignupRequest{Username: "Flow", Email: "flow@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", signup, nil); code != http.StatusCreated {
+		t.Fatalf("Signup, expected %d, but was %d", http.StatusCreated, code)
+	}
+
+	var problem api.ProblemDetails
+	duplicate := api.SignupRequest{Username: "flow", Email: "other@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", duplicate, &problem); code != http.StatusConflict {
+		t.Errorf("Signup with duplicate username, expected %d, but was %d", http.StatusConflict, code)
+	}
+	if problem.Title != "Username already exists" {
+		t.Errorf("Title, expected %q, but was %q", "Username already exists", problem.Title)
+	}
+
+	var login api.LoginResponse
+	credentials := api.LoginRequest{Username: signup.Username, Password: signup.Password}
+	if code := post(t, ts, "/login", "", credentials, &login); code != http.StatusOK {
+		t.Fatalf("Login, expected %d, but was %d", http.StatusOK, code)
+	}
+	if code := testAuth(t, ts, login.UnauthToken); code == http.StatusOK {
+		t.Error("Token issued after login should not grant full access")
+	}
+
+	var setup api.Secret2FAResponse
+	if code := post(t, ts, "/2fa/setup", login.UnauthToken, struct{}{}, &setup); code != http.StatusOK {
+		t.Fatalf("Setup 2FA, expected %d, but was %d", http.StatusOK, code)
+	}
+	uri, err := url.Parse(*setup.QrURI)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	secret := uri.Query().Get("secret")
+
+	wrong := api.Verify2FARequest{Otp: (dgoogauth.ComputeCode(secret, time.Now().Unix()/30) + 1) % 1000000}
+	if code := post(t, ts, "/2fa/verify", login.UnauthToken, wrong, nil); code != http.StatusUnauthorized {
+		t.Errorf("Verify 2FA with wrong OTP, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	var verify api.VerifyResponse
+	otp := api.Verify2FARequest{Otp: dgoogauth.ComputeCode(secret, time.Now().Unix()/30)}
+	if code := post(t, ts, "/2fa/verify", login.UnauthToken, otp, &verify); code != http.StatusOK {
+		t.Fatalf("Verify 2FA with OTP %06d, expected %d, but was %d", otp.Otp, http.StatusOK, code)
+	}
+
+	if code := testAuth(t, ts, verify.AccessToken); code != http.StatusOK {
+		t.Errorf("Access token, expected %d, but was %d", http.StatusOK, code)
+	}
+	if enabled, _ := s.store.GetEnabled2FA(context.Background(), signup.Username); !enabled {
+		t.Error("Expected 2FA to be enabled after verification")
+	}
+	if code := post(t, ts, "/2fa/setup", login.UnauthToken, struct{}{}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Setup of already enabled 2FA, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestVerify2FALeadingZeroOTP(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	s.store.SaveUser(context.Background(), &db.UserModel{Username: "Zero", Email: "zero@barz.com", PasswordHash: "hash"})
+	token, err := s.tokens.GenerateJWT(security.TokenMFAPending, security.Subject{UserID: susan.UserID, Username: "Zero"})
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	// search for a secret, whose current code has a leading zero
+	var secret string
+	var code int
+	for code >= 100000 || secret == "" {
+		random := make([]byte, 10)
+		rand.Read(random)
+		secret = base32.StdEncoding.EncodeToString(random)
+		code = dgoogauth.ComputeCode(secret, time.Now().Unix()/30)
+	}
+	s.store.Save2FASecret(context.Background(), "Zero", secret)
+
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	otp := api.Verify2FARequest{Otp: code}
+	if status := post(t, ts, "/2fa/verify", token, otp, nil); status != http.StatusOK {
+		t.Errorf("Verify 2FA with OTP %06d, expected %d, but was %d", code, http.StatusOK, status)
+	}
+}
+
+// fixedOTP is an OTPVerifier accepting only its code, for any secret.
+type fixedOTP int
+
+func (f fixedOTP) Verify(secret string, otp int) bool {
+	return otp == int(f)
+}
+
+func TestVerify2FAInjectedVerifier(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	token, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	wrong := api.Verify2FARequest{Otp: 424241}
+	if status := post(t, ts, "/2fa/verify", token, wrong, nil); status != http.StatusUnauthorized {
+		t.Errorf("Verify 2FA with wrong OTP, expected %d, but was %d", http.StatusUnauthorized, status)
+	}
+
+	otp := api.Verify2FARequest{Otp: 424242}
+	if status := post(t, ts, "/2fa/verify", token, otp, nil); status != http.StatusOK {
+		t.Errorf("Verify 2FA with OTP accepted by the verifier, expected %d, but was %d", http.StatusOK, status)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/db"
+)
+
+const (
+	// statusOK is a status of a passed check, or of a ready server.
+	statusOK = "ok"
+	// statusFail is a status of a failed check.
+	statusFail = "fail"
+	// statusUnavailable is a status of a server with a failed check.
+	statusUnavailable = "unavailable"
+)
+
+// readinessCheckTimeout limits each readiness check, so a probe of an
+// unreachable dependency fails before the probe itself times out.
+const readinessCheckTimeout = 2 * time.Second
+
+// ReadinessCheck checks whether a dependency of the server is ready, e.g. if
+// a database is reachable.
+type ReadinessCheck struct {
+	// Name of the check in the readiness response.
+	Name string
+	// Check returns an error if the dependency isn't ready. It should give up
+	// once the ctx is done.
+	Check func(ctx context.Context) error
+}
+
+// defaultReadinessChecks returns checks of dependencies every server has,
+// the database and signing keys.
+func (s GoAuthServer) defaultReadinessChecks() []ReadinessCheck {
+	return []ReadinessCheck{
+		{Name: "database", Check: func(ctx context.Context) error {
+			if s.store == nil {
+				return errors.New("not connected")
+			}
+			return s.store.Ping(ctx)
+		}},
+		{Name: "signing_keys", Check: func(context.Context) error {
+			return s.tokens.CheckKeys()
+		}},
+	}
+}
+
+// Healthz is a liveness probe, it responds with ok whenever the server is
+// able to handle requests.
+func (s GoAuthServer) Healthz(w http.ResponseWriter, r *http.Request) {
+	respondWithSuccess(w, api.HealthResponse{Status: statusOK})
+}
+
+// Readyz is a readiness probe, it runs all readiness checks of the server and
+// responds with a result of each of them. Every check is limited by the
+// readinessCheckTimeout and canceled with the request. If any check fails, the
+// status code is 503, so no traffic is routed to this instance.
+func (s GoAuthServer) Readyz(w http.ResponseWriter, r *http.Request) {
+	response := api.ReadinessResponse{
+		Status: statusOK,
+		Checks: make(map[string]api.HealthCheck, len(s.readinessChecks)),
+	}
+
+	for _, c := range s.readinessChecks {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		err := c.Check(ctx)
+		cancel()
+		if err != nil {
+			msg := err.Error()
+			response.Checks[c.Name] = api.HealthCheck{Status: statusFail, Error: &msg}
+			response.Status = statusUnavailable
+			continue
+		}
+		response.Checks[c.Name] = api.HealthCheck{Status: statusOK}
+	}
+
+	if response.Status != statusOK {
+		w.Header().Set(consts.ContentType, consts.ApplicationJSON)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	respondWithSuccess(w, response)
+}
+
+// Stats responds with statistics of the database connection pool, so its
+// exhaustion can be monitored. A database without a pool, e.g. the memory
+// one, has no statistics. Callers authenticate with client credentials, the
+// same as for Introspect.
+func (s GoAuthServer) Stats(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || !s.clients.Authenticate(id, secret) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="go-auth"`)
+		respondWithError(w, InvalidClient(r.URL.Path))
+		return
+	}
+
+	var response api.StatsResponse
+
+	if stats, ok := db.Stats(s.store); ok {
+		response.Database = &api.DatabaseStats{
+			MaxOpenConnections: stats.MaxOpenConnections,
+			OpenConnections:    stats.OpenConnections,
+			InUse:              stats.InUse,
+			Idle:               stats.Idle,
+			WaitCount:          stats.WaitCount,
+			WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:      stats.MaxIdleClosed,
+			MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+		}
+	}
+
+	respondWithSuccess(w, response)
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// unreachableDB is a database, which can't be pinged.
+type unreachableDB struct {
+	*db.MemoryConnection
+}
+
+func (unreachableDB) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealthz(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	req := httptest.NewRequest("GET", "/healthz", nil)
+
+	res := s.executeRequest(req)
+
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusOK, res.Code)
+	}
+	want := "{\"status\":\"ok\"}\n"
+	if res.Body.String() != want {
+		t.Errorf("Expected body to be %q, but was %q", want, res.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	req := httptest.NewRequest("GET", "/readyz", nil)
+
+	res := s.executeRequest(req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status code to be %d, but was %d", http.StatusOK, res.Code)
+	}
+
+	var resBody api.ReadinessResponse
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	if resBody.Status != statusOK {
+		t.Errorf("Expected status to be %s, but was %s", statusOK, resBody.Status)
+	}
+	for _, name := range []string{"database", "signing_keys"} {
+		if resBody.Checks[name].Status != statusOK {
+			t.Errorf("Expected check %s to be %s, but was %+v", name, statusOK, resBody.Checks[name])
+		}
+	}
+}
+
+func TestReadyzFailedCheck(t *testing.T) {
+	t.Parallel()
+	deps := Dependencies{
+		Store:  unreachableDB{db.NewMemoryConnection()},
+		Tokens: newIssuer(t, security.DefaultAlgorithm),
+	}
+
+	s, _ := NewGoAuthServer(config.Default(), deps, ReadinessCheck{
+		Name: "mailer",
+		Check: func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				return errors.New("no deadline")
+			}
+			return nil
+		},
+	})
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+
+	s.Readyz(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code to be %d, but was %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	var resBody api.ReadinessResponse
+	json.Unmarshal(rr.Body.Bytes(), &resBody)
+
+	if resBody.Status != statusUnavailable {
+		t.Errorf("Expected status to be %s, but was %s", statusUnavailable, resBody.Status)
+	}
+	database := resBody.Checks["database"]
+	if database.Status != statusFail || database.Error == nil || *database.Error != "connection refused" {
+		t.Errorf("Expected database check to fail, but was %+v", database)
+	}
+	if resBody.Checks["mailer"].Status != statusOK {
+		t.Errorf("Expected configured check to pass, but was %+v", resBody.Checks["mailer"])
+	}
+}
+
+func TestStatsMemory(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+	req := httptest.NewRequest("GET", "/stats", nil)
+	req.SetBasicAuth("gateway", "s3cret")
+
+	res := s.executeRequest(req)
+
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusOK, res.Code)
+	}
+	want := "{}\n"
+	if res.Body.String() != want {
+		t.Errorf("Expected body to be %q, but was %q", want, res.Body.String())
+	}
+}
+
+func TestStatsPool(t *testing.T) {
+	t.Parallel()
+	store, err := db.Connect("sqlite", db.SQLiteDSN(filepath.Join(t.TempDir(), "users.db")), db.Options{})
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	defer db.Close(store)
+	s := newTestServer(t, Dependencies{Store: store, Clients: gateway})
+	req := httptest.NewRequest("GET", "/stats", nil)
+	req.SetBasicAuth("gateway", "s3cret")
+
+	res := s.executeRequest(req)
+
+	var resBody api.StatsResponse
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	if resBody.Database == nil {
+		t.Fatal("Expected statistics of the database")
+	}
+	if resBody.Database.MaxOpenConnections != 1 || resBody.Database.OpenConnections != 1 {
+		t.Errorf("Expected a single open SQLite connection, but was %+v", resBody.Database)
+	}
+}
+
+func TestStatsInvalidClient(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+
+	for _, secret := range []string{"", "wrong"} {
+		req := httptest.NewRequest("GET", "/stats", nil)
+		if secret != "" {
+			req.SetBasicAuth("gateway", secret)
+		}
+
+		res := s.executeRequest(req)
+
+		if res.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code to be %d, but was %d", http.StatusUnauthorized, res.Code)
+		}
+		if res.Header().Get("WWW-Authenticate") == "" {
+			t.Error("Expected WWW-Authenticate header")
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+const (
+	// maxFormSize is a maximal size, in Bytes, of a form request body. It is
+	// larger than maxSize, because it must fit a whole JWT.
+	maxFormSize = 4096
+)
+
+// Introspect handles OAuth 2.0 token introspection (RFC 7662). The caller is
+// authenticated with client credentials of the server's clients using HTTP
+// Basic authentication. The token from the form request body is validated by
+// the token issuer, so revoked, expired and invalid tokens are reported
+// as not active. A token which is not a valid JWT may be an opaque refresh
+// token, which is active if it is stored, neither used, revoked nor expired.
+func (s GoAuthServer) Introspect(w http.ResponseWriter, r *http.Request) {
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || !s.clients.Authenticate(id, secret) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="go-auth"`)
+		respondWithError(w, InvalidClient(r.URL.Path))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	if err := r.ParseForm(); err != nil {
+		respondWithError(w, BadRequest(
+			malformedRequestErr{status: http.StatusBadRequest, msg: "Request body is not a valid form"},
+			r.URL.Path,
+		))
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondWithError(w, BadRequest(
+			malformedRequestErr{status: http.StatusBadRequest, msg: "Request body is not complete"},
+			r.URL.Path,
+		))
+		return
+	}
+
+	c, err := s.tokens.ValidateToken(r.Context(), token, security.TokenMFAPending, security.TokenAccess)
+	if errors.Is(err, context.DeadlineExceeded) {
+		respondWithError(w, ServiceUnavailable(r.URL.Path))
+		return
+	} else if err != nil {
+		s.introspectRefreshToken(w, r, token)
+		return
+	}
+
+	scope := strings.Join(c.Scopes(), " ")
+	authenticated := c.TokenUse != security.TokenMFAPending
+	response := api.IntrospectionResponse{
+		Active:        true,
+		Sub:           &c.Subject,
+		Username:      &c.Username,
+		Exp:           &c.ExpiresAt,
+		Iat:           &c.IssuedAt,
+		Authenticated: &authenticated,
+		Scope:         &scope,
+	}
+	respondWithSuccess(w, response)
+}
+
+// introspectRefreshToken responds with the state of the refresh token, which
+// is looked up by its hash.
+func (s GoAuthServer) introspectRefreshToken(w http.ResponseWriter, r *http.Request, token string) {
+	stored, err := s.store.RefreshTokenByHash(r.Context(), security.HashRefreshToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithSuccess(w, api.IntrospectionResponse{Active: false})
+		return
+	} else if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	if stored.Used || stored.Revoked || !s.clock.Now().Before(stored.ExpiresAt) {
+		respondWithSuccess(w, api.IntrospectionResponse{Active: false})
+		return
+	}
+
+	user, err := s.store.UserByUsername(r.Context(), stored.Username)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	sub := user.Uuid.String()
+	exp := stored.ExpiresAt.Unix()
+	scope := string(security.TokenRefresh)
+	authenticated := true
+	response := api.IntrospectionResponse{
+		Active:        true,
+		Sub:           &sub,
+		Username:      &user.Username,
+		Exp:           &exp,
+		Authenticated: &authenticated,
+		Scope:         &scope,
+	}
+	respondWithSuccess(w, response)
+}
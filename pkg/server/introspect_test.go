@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/consts"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+var introspectPath = "/introspect"
+
+// gateway is the only client allowed to introspect tokens in tests.
+var gateway, _ = security.ParseClients("gateway:s3cret")
+
+func (s *testServer) introspectRequest(t *testing.T, token, clientID, clientSecret string) *httptest.ResponseRecorder {
+	form := url.Values{"token": {token}}
+	req := httptest.NewRequest("POST", introspectPath, strings.NewReader(form.Encode()))
+	req.Header.Add(consts.ContentType, "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+
+	return s.executeRequest(req)
+}
+
+func TestIntrospectActiveToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+	jwt, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	res := s.introspectRequest(t, jwt, "gateway", "s3cret")
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status code to be %d, but was %d", http.StatusOK, res.Code)
+	}
+
+	var resBody api.IntrospectionResponse
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	if !resBody.Active {
+		t.Fatal("Expected token to be active")
+	}
+	if resBody.Username == nil || *resBody.Username != "Susan" {
+		t.Errorf("Expected username to be %s, but was %v", "Susan", resBody.Username)
+	}
+	if resBody.Authenticated == nil || !*resBody.Authenticated {
+		t.Error("Expected token to be authenticated")
+	}
+	if resBody.Scope == nil || *resBody.Scope != string(security.TokenAccess) {
+		t.Errorf("Expected scope to be %s, but was %v", string(security.TokenAccess), resBody.Scope)
+	}
+	if resBody.Sub == nil || *resBody.Sub != susan.UserID {
+		t.Errorf("Expected sub to be %s, but was %v", susan.UserID, resBody.Sub)
+	}
+	if resBody.Exp == nil || resBody.Iat == nil || *resBody.Exp <= *resBody.Iat {
+		t.Errorf("Expected exp after iat, but was %v, %v", resBody.Exp, resBody.Iat)
+	}
+}
+
+func TestIntrospectInactiveToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+	revoked, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+	c, _ := s.tokens.ValidateToken(context.Background(), revoked, security.TokenAccess)
+	s.tokens.RevokeToken(context.Background(), c)
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"Invalid", "invalid"},
+		{"Revoked", revoked},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := s.introspectRequest(t, tc.token, "gateway", "s3cret")
+
+			if res.Code != http.StatusOK {
+				t.Fatalf("Expected status code to be %d, but was %d", http.StatusOK, res.Code)
+			}
+
+			want := "{\"active\":false}\n"
+			if res.Body.String() != want {
+				t.Errorf("Expected body to be %q, but was %q", want, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+	session := security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "introspect-family"}
+	_, used, _ := s.server.issueTokens(context.Background(), session)
+	_, fresh, _ := s.server.issueTokens(context.Background(), session)
+	notSaved, _ := s.tokens.GenerateRefreshToken()
+
+	var resBody api.IntrospectionResponse
+	json.Unmarshal(s.introspectRequest(t, fresh, "gateway", "s3cret").Body.Bytes(), &resBody)
+	if !resBody.Active {
+		t.Error("Expected unused refresh token to be active")
+	}
+
+	s.refreshRequest(t, used)
+	_, revoked, _ := s.server.issueTokens(context.Background(), security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "revoked-family"})
+	s.store.RevokeRefreshTokenFamily(context.Background(), "revoked-family")
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"Used", used},
+		{"Revoked", revoked},
+		{"NotSaved", notSaved.Token},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := s.introspectRequest(t, tc.token, "gateway", "s3cret")
+
+			want := "{\"active\":false}\n"
+			if res.Body.String() != want {
+				t.Errorf("Expected body to be %q, but was %q", want, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestIntrospectInvalidClient(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+	jwt, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	testCases := []struct {
+		name, id, secret string
+	}{
+		{"NoCredentials", "", ""},
+		{"WrongSecret", "gateway", "wrong"},
+		{"UnknownClient", "unknown", "s3cret"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wantCode := http.StatusUnauthorized
+			wantTitle := "Invalid client"
+
+			res := s.introspectRequest(t, jwt, tc.id, tc.secret)
+
+			var pd api.ProblemDetails
+			json.Unmarshal(res.Body.Bytes(), &pd)
+
+			if res.Code != wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
+			}
+			if pd.Title != wantTitle {
+				t.Errorf("Title, expected %q, but was %q", wantTitle, pd.Title)
+			}
+		})
+	}
+}
+
+func TestIntrospectMissingToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Clients: gateway})
+	res := s.introspectRequest(t, "", "gateway", "s3cret")
+
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusBadRequest, res.Code)
+	}
+}
@@ -8,12 +8,16 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Nesquiko/go-auth/pkg/config"
 	"github.com/go-playground/validator/v10"
 )
 
 const (
-	// maxSize is a maximal size, in Bytes, of a JSON reques body.
-	maxSize = 128
+	// maxSize is a default maximal size, in Bytes, of a JSON reques body.
+	maxSize = config.DefaultMaxBodySize
+	// maxTokenSize is a maximal size, in Bytes, of a JSON request body
+	// containing a JWT.
+	maxTokenSize = 2048
 )
 
 // malformedRequestErr represents a error caused by a malformed JSON request.
@@ -33,8 +37,14 @@ func (mr malformedRequestErr) Error() string {
 // is not valid, a malformedResultErr error is returned with details about the
 // error that occured.
 func validateJSONRequestBody[T any](w http.ResponseWriter, r *http.Request, dest T) error {
+	return validateJSONRequestBodyOfSize(w, r, dest, maxSize)
+}
+
+// validateJSONRequestBodyOfSize validates the JSON request same as
+// validateJSONRequestBody, but with a custom maximal size of the body.
+func validateJSONRequestBodyOfSize[T any](w http.ResponseWriter, r *http.Request, dest T, size int64) error {
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	r.Body = http.MaxBytesReader(w, r.Body, size)
 
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
@@ -42,7 +52,7 @@ func validateJSONRequestBody[T any](w http.ResponseWriter, r *http.Request, dest
 	err := dec.Decode(&dest)
 
 	if err != nil {
-		return analyzeError(err)
+		return analyzeError(err, size)
 	}
 
 	err = dec.Decode(&struct{}{})
@@ -72,8 +82,9 @@ func validateDest[T any](dest T) error {
 }
 
 // analyzeError tries to specify what the param err is about and then returns
-// appropriate malformedRequestErr error.
-func analyzeError(err error) malformedRequestErr {
+// appropriate malformedRequestErr error. The size is the maximal size of the
+// request body.
+func analyzeError(err error, size int64) malformedRequestErr {
 
 	var syntaxError *json.SyntaxError
 	var unmarshalTypeError *json.UnmarshalTypeError
@@ -108,7 +119,7 @@ func analyzeError(err error) malformedRequestErr {
 		return malformedRequestErr{status: http.StatusBadRequest, msg: responseMsg}
 
 	case err.Error() == "http: request body too large":
-		responseMsg := fmt.Sprintf("Request body must not be larger than %dB", maxSize)
+		responseMsg := fmt.Sprintf("Request body must not be larger than %dB", size)
 		return malformedRequestErr{status: http.StatusRequestEntityTooLarge, msg: responseMsg}
 
 	default:
@@ -229,7 +229,7 @@ func Test_decodeJSONBodyEmptyBody(t *testing.T) {
 func Test_decodeJSONBodyTooLargeBody(t *testing.T) {
 	var js testJSONStruct
 	fieldString :=
-		"toooooooooBiiiiiiiiiiggggggggggggggOooooooooooffffffffAaaaaaaaVaaaaluuuuuuueeeeee"
+		strings.Repeat("toooooooooBiiiiiiiiiiggggggggggggggOooooooooooffffffffAaaaaaaaVaaaaluuuuuuueeeeee", 13)
 	fieldInt := 1234567891234567891
 
 	reqBody := testJSONStruct{fieldString, fieldInt}
@@ -0,0 +1,310 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/mail"
+	"github.com/Nesquiko/go-auth/pkg/middleware"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// ChangePassword replaces the password of the authenticated user. The current
+// password must be submitted, and if the user has 2FA enabled, also a valid
+// OTP. The new password must satisfy the password policy and must not be
+// breached. Afterwards all other sessions of the user are revoked, together
+// with their refresh tokens, outstanding password reset tokens are deleted and
+// the user is notified about the change.
+func (s GoAuthServer) ChangePassword(w http.ResponseWriter, r *http.Request) {
+
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	var req api.ChangePasswordJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
+	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	user, err := s.store.UserByUsername(r.Context(), c.Username)
+	if err != nil {
+		respondWithError(w, GetProblemDetails(err, r.URL.Path))
+		return
+	}
+
+	if !s.hasher.Verify(user.PasswordHash, req.CurrentPassword) {
+		respondWithError(w, InvalidCredentials(r.URL.Path))
+		return
+	}
+
+	if user.Enabled2FA && (req.Otp == nil || !s.otp.Verify(user.Secret2FA.String, *req.Otp)) {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	if err := s.checkPassword(r.Context(), req.NewPassword, user.Username, user.Email); err != nil {
+		respondWithError(w, WeakPassword(err, "newPassword", r.URL.Path))
+		return
+	}
+
+	passwordHash, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
+		return
+	}
+	if err := s.store.UpdatePassword(r.Context(), user.Username, passwordHash); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+	if err := s.store.DeletePasswordResetTokens(r.Context(), user.Username); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	if err := s.revokeSessions(r.Context(), user.Username, c.SessionID); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	s.goBackground(func(ctx context.Context) {
+		if err := s.sendPasswordChangedEmail(ctx, user.Username); err != nil {
+			fmt.Printf("Sending password change notification to %s failed: %s\n", user.Username, err)
+		}
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword sends a password reset token to the submitted email address,
+// if it belongs to a user. The response is the same whether the user exists
+// or not, and the token is sent in the background after responding, so the
+// endpoint can't be used to find out which email addresses are registered.
+func (s GoAuthServer) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+
+	var req api.ForgotPasswordJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
+	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	s.goBackground(func(ctx context.Context) {
+		if err := s.sendPasswordResetEmail(ctx, req.Email); err != nil {
+			fmt.Printf("Sending password reset email failed: %s\n", err)
+		}
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// breachedReason is a reason of rejection of passwords exposed in a data
+// breach.
+const breachedReason = "has appeared in a data breach"
+
+// checkPassword returns a *security.PolicyError if the new password of the
+// user with the username and the email breaks the password policy, or
+// appeared in a data breach. A failure of the breach check is only reported,
+// so users aren't locked out of signup when the corpus is unavailable.
+func (s GoAuthServer) checkPassword(ctx context.Context, password, username, email string) error {
+	err := s.policy.Check(password, username, email)
+	if s.breaches == nil {
+		return err
+	}
+
+	breached, breachErr := s.breaches.Breached(ctx, password)
+	if breachErr != nil {
+		fmt.Printf("Checking breached passwords failed: %s\n", breachErr)
+		return err
+	} else if !breached {
+		return err
+	}
+
+	var policyErr *security.PolicyError
+	if !errors.As(err, &policyErr) {
+		policyErr = &security.PolicyError{}
+	}
+	policyErr.Reasons = append(policyErr.Reasons, breachedReason)
+	return policyErr
+}
+
+// ResetPassword replaces the password of the user, to whom the submitted
+// reset token was sent. The new password must satisfy the password policy
+// and must not be breached. The token can be used only once, and other reset
+// tokens of the user are deleted with it. Afterwards all sessions of the user
+// are revoked, together with their refresh tokens, and the user is notified
+// about the change.
+func (s GoAuthServer) ResetPassword(w http.ResponseWriter, r *http.Request) {
+
+	var req api.ResetPasswordJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
+	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	hash := security.HashResetToken(req.Token)
+	token, err := s.store.PasswordResetTokenByHash(r.Context(), hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, InvalidResetToken(r.URL.Path))
+		return
+	} else if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	if token.Used || !s.clock.Now().Before(token.ExpiresAt) {
+		respondWithError(w, InvalidResetToken(r.URL.Path))
+		return
+	}
+
+	// the password is checked before the token is used, so it can be
+	// submitted again with a better password
+	user, err := s.store.UserByUsername(r.Context(), token.Username)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+	if err := s.checkPassword(r.Context(), req.Password, user.Username, user.Email); err != nil {
+		respondWithError(w, WeakPassword(err, "password", r.URL.Path))
+		return
+	}
+
+	// marking the token as used first guarantees that concurrent requests
+	// with the same token reset the password only once
+	fresh, err := s.store.UsePasswordResetToken(r.Context(), hash)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+	if !fresh {
+		respondWithError(w, InvalidResetToken(r.URL.Path))
+		return
+	}
+
+	passwordHash, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
+		return
+	}
+	if err := s.store.UpdatePassword(r.Context(), token.Username, passwordHash); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+	if err := s.store.DeletePasswordResetTokens(r.Context(), token.Username); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	// the token was delivered to the email address, which proves it works
+	if err := s.store.UpdateEmailVerified(r.Context(), token.Username, true); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	if err := s.revokeSessions(r.Context(), token.Username, ""); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	username := token.Username
+	s.goBackground(func(ctx context.Context) {
+		if err := s.sendPasswordChangedEmail(ctx, username); err != nil {
+			fmt.Printf("Sending password change notification to %s failed: %s\n", username, err)
+		}
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeSessions revokes all sessions of the user, except the one identified
+// by the keep session ID, if set. Both refresh tokens of a session and JWTs
+// issued in it are revoked.
+func (s GoAuthServer) revokeSessions(ctx context.Context, username, keep string) error {
+	families, err := s.store.RefreshTokenFamilies(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if family == keep {
+			continue
+		}
+		if err := s.store.RevokeRefreshTokenFamily(ctx, family); err != nil {
+			return err
+		}
+		if err := s.tokens.RevokeSession(ctx, family); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendPasswordResetEmail saves a new password reset token of the user with
+// the email address and sends it to the address. Nothing is sent, if there
+// is no such user.
+func (s GoAuthServer) sendPasswordResetEmail(ctx context.Context, email string) error {
+	user, err := s.store.UserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := security.NewResetToken(s.clock.Now().Add(s.resetLifetime))
+	if err != nil {
+		return err
+	}
+
+	err = s.store.SavePasswordResetToken(ctx, &db.PasswordResetTokenDBEntity{
+		TokenHash: token.Hash,
+		Username:  user.Username,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, passwordResetMessage(user, token.Token, s.passwordResetURL))
+}
+
+// sendPasswordChangedEmail notifies the user, that the password of the
+// account was changed.
+func (s GoAuthServer) sendPasswordChangedEmail(ctx context.Context, username string) error {
+	user, err := s.store.UserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nthe password of your account was changed. Sessions on other devices were logged out.\n"+
+			"\nIf you didn't change it, reset your password immediately.\n", user.Username),
+	})
+}
+
+// passwordResetMessage returns an email with the token resetting the password
+// of the user. If the passwordResetURL is set, the email contains a link to
+// it with the token in the token query parameter, otherwise only the token.
+func passwordResetMessage(user *db.UserDBEntity, token, passwordResetURL string) mail.Message {
+	body := fmt.Sprintf("Hi %s,\n\nreset your password with this token:\n\n%s\n", user.Username, token)
+	if link, ok := tokenLink(passwordResetURL, token); ok {
+		body = fmt.Sprintf("Hi %s,\n\nreset your password by opening this link:\n\n%s\n", user.Username, link)
+	}
+
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body + "\nIf you didn't ask to reset your password, ignore this email.\n",
+	}
+}
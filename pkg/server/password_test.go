@@ -0,0 +1,501 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+func TestForgotPasswordSameResponse(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	for _, email := range []string{"susan@barz.com", "nobody@barz.com"} {
+		var body map[string]any
+		if code := post(t, ts, "/password/forgot", "", api.ForgotPasswordRequest{Email: email}, &body); code != http.StatusAccepted {
+			t.Errorf("Forgot password of %s, expected %d, but was %d", email, http.StatusAccepted, code)
+		}
+		if body != nil {
+			t.Errorf("Forgot password of %s, expected empty body, but was %v", email, body)
+		}
+	}
+	s.server.Wait()
+
+	sent := s.mailbox.sent()
+	if len(sent) != 1 || sent[0].To != "susan@barz.com" {
+		t.Fatalf("Expected one email to susan, but was %+v", sent)
+	}
+	if strings.Contains(sent[0].Body, "https://") {
+		t.Errorf("Expected only the token without a reset URL, but was %q", sent[0].Body)
+	}
+}
+
+func TestResetPasswordFlow(t *testing.T) {
+	t.Parallel()
+	cfg := config.Default()
+	cfg.Email.PasswordResetURL = "https://example.com/reset"
+	s := newTestServerWithConfig(t, cfg, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	session := security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "reset-family"}
+	access, refreshToken, err := s.server.issueTokens(context.Background(), session)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if code := post(t, ts, "/password/forgot", "", api.ForgotPasswordRequest{Email: "Susan@Barz.com"}, nil); code != http.StatusAccepted {
+		t.Fatalf("Forgot password, expected %d, but was %d", http.StatusAccepted, code)
+	}
+	s.server.Wait()
+	sent := s.mailbox.sent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected one email, but was %+v", sent)
+	}
+	token := tokenFromLink(t, sent[0])
+
+	reset := api.ResetPasswordRequest{Token: token, Password: "N3w-passw0rd"}
+	if code := post(t, ts, "/password/reset", "", reset, nil); code != http.StatusNoContent {
+		t.Fatalf("Reset password, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	s.server.Wait()
+
+	if code := testAuth(t, ts, access); code != http.StatusUnauthorized {
+		t.Errorf("Access token of an old session, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	if res := s.refreshRequest(t, refreshToken); res.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh token of an old session, expected %d, but was %d", http.StatusUnauthorized, res.Code)
+	}
+
+	if code := post(t, ts, "/login", "", api.LoginRequest{Username: susan.Username, Password: "123"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Login with the old password, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	if code := post(t, ts, "/login", "", api.LoginRequest{Username: susan.Username, Password: "N3w-passw0rd"}, nil); code != http.StatusOK {
+		t.Errorf("Login with the new password, expected %d, but was %d", http.StatusOK, code)
+	}
+	if user, _ := s.store.UserByUsername(context.Background(), susan.Username); !user.EmailVerified {
+		t.Error("Expected email to be verified by the reset")
+	}
+
+	sent = s.mailbox.sent()
+	if len(sent) != 2 || sent[1].Subject != "Your password was changed" {
+		t.Errorf("Expected a notification about the change, but was %+v", sent)
+	}
+
+	var problem api.ProblemDetails
+	if code := post(t, ts, "/password/reset", "", reset, &problem); code != http.StatusBadRequest {
+		t.Errorf("Reused reset token, expected %d, but was %d", http.StatusBadRequest, code)
+	}
+	if problem.Title != "Invalid reset token" {
+		t.Errorf("Title, expected %q, but was %q", "Invalid reset token", problem.Title)
+	}
+}
+
+// saveResetToken saves a new reset token of susan and returns it.
+func saveResetToken(t *testing.T, s *testServer) string {
+	t.Helper()
+
+	token, _ := security.NewResetToken(time.Now().Add(time.Hour))
+	err := s.store.SavePasswordResetToken(context.Background(), &db.PasswordResetTokenDBEntity{
+		TokenHash: token.Hash,
+		Username:  susan.Username,
+		ExpiresAt: token.ExpiresAt,
+	})
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	return token.Token
+}
+
+func TestPasswordChangeDeletesResetTokens(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	used, other := saveResetToken(t, s), saveResetToken(t, s)
+	if code := post(t, ts, "/password/reset", "", api.ResetPasswordRequest{Token: used, Password: "N3w-passw0rd"}, nil); code != http.StatusNoContent {
+		t.Fatalf("Reset password, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	if code := post(t, ts, "/password/reset", "", api.ResetPasswordRequest{Token: other, Password: "Qwerty-42x"}, nil); code != http.StatusBadRequest {
+		t.Errorf("Other reset token after a reset, expected %d, but was %d", http.StatusBadRequest, code)
+	}
+
+	pending := saveResetToken(t, s)
+	access, _, _ := s.server.issueTokens(context.Background(), security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "family"})
+	change := api.ChangePasswordRequest{CurrentPassword: "N3w-passw0rd", NewPassword: "S3cret-pass"}
+	if code := post(t, ts, "/password/change", access, change, nil); code != http.StatusNoContent {
+		t.Fatalf("Change password, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	if code := post(t, ts, "/password/reset", "", api.ResetPasswordRequest{Token: pending, Password: "Qwerty-42x"}, nil); code != http.StatusBadRequest {
+		t.Errorf("Reset token after a password change, expected %d, but was %d", http.StatusBadRequest, code)
+	}
+
+	s.server.Wait()
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	expired, _ := security.NewResetToken(time.Now().Add(-time.Minute))
+	err := s.store.SavePasswordResetToken(context.Background(), &db.PasswordResetTokenDBEntity{
+		TokenHash: expired.Hash,
+		Username:  susan.Username,
+		ExpiresAt: expired.ExpiresAt,
+	})
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"Unknown", "unknown"},
+		{"Expired", expired.Token},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var problem api.ProblemDetails
+			code := post(t, ts, "/password/reset", "", api.ResetPasswordRequest{Token: tc.token, Password: "N3w-passw0rd"}, &problem)
+
+			if code != http.StatusBadRequest {
+				t.Errorf("Expected status code to be %d, but was %d", http.StatusBadRequest, code)
+			}
+			if problem.Title != "Invalid reset token" {
+				t.Errorf("Title, expected %q, but was %q", "Invalid reset token", problem.Title)
+			}
+		})
+	}
+
+	if code := post(t, ts, "/login", "", api.LoginRequest{Username: susan.Username, Password: "123"}, nil); code != http.StatusOK {
+		t.Errorf("Login with the unchanged password, expected %d, but was %d", http.StatusOK, code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	current := security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "current-family"}
+	access, currentRefresh, _ := s.server.issueTokens(context.Background(), current)
+	other := security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "other-family"}
+	otherAccess, otherRefresh, _ := s.server.issueTokens(context.Background(), other)
+
+	change := api.ChangePasswordRequest{CurrentPassword: "123", NewPassword: "N3w-passw0rd"}
+	if code := post(t, ts, "/password/change", access, change, nil); code != http.StatusNoContent {
+		t.Fatalf("Change password, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	s.server.Wait()
+
+	if code := testAuth(t, ts, access); code != http.StatusOK {
+		t.Errorf("Access token of the current session, expected %d, but was %d", http.StatusOK, code)
+	}
+	if res := s.refreshRequest(t, currentRefresh); res.Code != http.StatusOK {
+		t.Errorf("Refresh token of the current session, expected %d, but was %d", http.StatusOK, res.Code)
+	}
+	if code := testAuth(t, ts, otherAccess); code != http.StatusUnauthorized {
+		t.Errorf("Access token of another session, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	if res := s.refreshRequest(t, otherRefresh); res.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh token of another session, expected %d, but was %d", http.StatusUnauthorized, res.Code)
+	}
+
+	if code := post(t, ts, "/login", "", api.LoginRequest{Username: susan.Username, Password: "N3w-passw0rd"}, nil); code != http.StatusOK {
+		t.Errorf("Login with the new password, expected %d, but was %d", http.StatusOK, code)
+	}
+	if sent := s.mailbox.sent(); len(sent) != 1 || sent[0].Subject != "Your password was changed" {
+		t.Errorf("Expected a notification about the change, but was %+v", sent)
+	}
+}
+
+func TestChangePasswordRejected(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+	mfaPending, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+
+	testCases := []struct {
+		name     string
+		token    string
+		req      api.ChangePasswordRequest
+		wantCode int
+	}{
+		{"MFAPendingToken", mfaPending, api.ChangePasswordRequest{CurrentPassword: "123", NewPassword: "N3w-passw0rd"}, http.StatusUnauthorized},
+		{"WrongCurrentPassword", access, api.ChangePasswordRequest{CurrentPassword: "1234", NewPassword: "N3w-passw0rd"}, http.StatusUnauthorized},
+		{"WeakPassword", access, api.ChangePasswordRequest{CurrentPassword: "123", NewPassword: "weak"}, http.StatusBadRequest},
+		{"MissingNewPassword", access, api.ChangePasswordRequest{CurrentPassword: "123"}, http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := post(t, ts, "/password/change", tc.token, tc.req, nil); code != tc.wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", tc.wantCode, code)
+			}
+		})
+	}
+
+	if code := post(t, ts, "/login", "", api.LoginRequest{Username: susan.Username, Password: "123"}, nil); code != http.StatusOK {
+		t.Errorf("Login with the unchanged password, expected %d, but was %d", http.StatusOK, code)
+	}
+}
+
+func TestChangePasswordWith2FA(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	s.store.Save2FASecret(context.Background(), susan.Username, "SECRET")
+	s.store.UpdateEnabled2FA(context.Background(), susan.Username, true)
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	wrong, valid := 424241, 424242
+	change := api.ChangePasswordRequest{CurrentPassword: "123", NewPassword: "N3w-passw0rd"}
+	if code := post(t, ts, "/password/change", access, change, nil); code != http.StatusUnauthorized {
+		t.Errorf("Change password without OTP, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	change.Otp = &wrong
+	if code := post(t, ts, "/password/change", access, change, nil); code != http.StatusUnauthorized {
+		t.Errorf("Change password with wrong OTP, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	change.Otp = &valid
+	if code := post(t, ts, "/password/change", access, change, nil); code != http.StatusNoContent {
+		t.Errorf("Change password with OTP, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	s.server.Wait()
+}
+
+func TestWeakPasswordInvalidParams(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	testCases := []struct {
+		name  string
+		path  string
+		token string
+		body  any
+		field string
+	}{
+		{"Signup", "/signup", "", api.SignupRequest{Username: "Flow", Email: "flow@barz.com", Password: "flow"}, "password"},
+		{"Change", "/password/change", access, api.ChangePasswordRequest{CurrentPassword: "123", NewPassword: "susan"}, "newPassword"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var problem api.ProblemDetails
+			if code := post(t, ts, tc.path, tc.token, tc.body, &problem); code != http.StatusBadRequest {
+				t.Fatalf("Expected status code to be %d, but was %d", http.StatusBadRequest, code)
+			}
+
+			if problem.Title != "Weak password" || problem.InvalidParams == nil {
+				t.Fatalf("Expected weak password problem with invalid params, but was %+v", problem)
+			}
+			want := []api.InvalidParam{
+				{Name: tc.field, Reason: "must have at least 8 characters"},
+				{Name: tc.field, Reason: "must contain an uppercase letter"},
+				{Name: tc.field, Reason: "must contain a digit"},
+				{Name: tc.field, Reason: "must not contain the username or the email address"},
+			}
+			if !reflect.DeepEqual(*problem.InvalidParams, want) {
+				t.Errorf("Expected invalid params %+v, but was %+v", want, *problem.InvalidParams)
+			}
+		})
+	}
+}
+
+func TestResetPasswordWeakKeepsToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	token, _ := security.NewResetToken(time.Now().Add(time.Minute))
+	s.store.SavePasswordResetToken(context.Background(), &db.PasswordResetTokenDBEntity{
+		TokenHash: token.Hash,
+		Username:  susan.Username,
+		ExpiresAt: token.ExpiresAt,
+	})
+
+	var problem api.ProblemDetails
+	weak := api.ResetPasswordRequest{Token: token.Token, Password: "Susan-1234"}
+	if code := post(t, ts, "/password/reset", "", weak, &problem); code != http.StatusBadRequest {
+		t.Errorf("Reset with a weak password, expected %d, but was %d", http.StatusBadRequest, code)
+	}
+	if problem.Title != "Weak password" {
+		t.Errorf("Title, expected %q, but was %q", "Weak password", problem.Title)
+	}
+
+	strong := api.ResetPasswordRequest{Token: token.Token, Password: "N3w-passw0rd"}
+	if code := post(t, ts, "/password/reset", "", strong, nil); code != http.StatusNoContent {
+		t.Errorf("Reset with a strong password, expected %d, but was %d", http.StatusNoContent, code)
+	}
+	s.server.Wait()
+}
+
+func TestNewPasswordPolicy(t *testing.T) {
+	cfg := config.Default().Password
+	cfg.DenylistFile = filepath.Join(t.TempDir(), "denylist.txt")
+	os.WriteFile(cfg.DenylistFile, []byte("Passw0rd-123\n"), 0600)
+
+	policy, err := NewPasswordPolicy(cfg)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	if err := policy.Check("passw0rd-123", "susan", "susan@barz.com"); err == nil {
+		t.Error("Expected denylisted password to be rejected")
+	}
+	if policy.MinLength != cfg.MinLength || policy.MaxLength != cfg.MaxLength || !policy.RequireUppercase {
+		t.Errorf("Expected configured rules, but was %+v", policy)
+	}
+
+	cfg.DenylistFile = filepath.Join(t.TempDir(), "missing.txt")
+	if _, err := NewPasswordPolicy(cfg); err == nil {
+		t.Error("error was expected")
+	}
+}
+
+func TestBcryptPasswordPolicyMaxBytes(t *testing.T) {
+	cfg := config.Default().Password
+	if passwordPolicy(cfg).MaxBytes != 0 {
+		t.Errorf("Expected no byte limit for %s, but was %d", cfg.Algorithm, passwordPolicy(cfg).MaxBytes)
+	}
+
+	cfg.Algorithm = "bcrypt"
+	policy := passwordPolicy(cfg)
+
+	// 40 characters, but 79 bytes, of which Bcrypt would hash only 72
+	password := "S3cret-" + strings.Repeat("ž", 33)
+	if err := policy.Check(password, "susan", "susan@barz.com"); err == nil {
+		t.Error("Expected password longer than 72 bytes to be rejected with Bcrypt")
+	}
+}
+
+// breachedPasswords is a BreachChecker of a fixed set of passwords, or
+// failing with the err.
+type breachedPasswords struct {
+	passwords map[string]bool
+	err       error
+}
+
+func (b breachedPasswords) Breached(ctx context.Context, password string) (bool, error) {
+	return b.passwords[password], b.err
+}
+
+func TestBreachedPasswordRejected(t *testing.T) {
+	t.Parallel()
+	breaches := breachedPasswords{passwords: map[string]bool{"Qwerty-123": true, "short": true}}
+	s := newTestServer(t, Dependencies{Breaches: breaches})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	testCases := []struct {
+		name  string
+		path  string
+		token string
+		body  any
+		want  []api.InvalidParam
+	}{
+		{
+			"Signup", "/signup", "",
+			api.SignupRequest{Username: "Breached", Email: "breached@barz.com", Password: "Qwerty-123"},
+			[]api.InvalidParam{{Name: "password", Reason: "has appeared in a data breach"}},
+		},
+		{
+			"Change", "/password/change", access,
+			api.ChangePasswordRequest{CurrentPassword: "123", NewPassword: "short"},
+			[]api.InvalidParam{
+				{Name: "newPassword", Reason: "must have at least 8 characters"},
+				{Name: "newPassword", Reason: "must contain an uppercase letter"},
+				{Name: "newPassword", Reason: "must contain a digit"},
+				{Name: "newPassword", Reason: "has appeared in a data breach"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var problem api.ProblemDetails
+			if code := post(t, ts, tc.path, tc.token, tc.body, &problem); code != http.StatusBadRequest {
+				t.Fatalf("Expected status code to be %d, but was %d", http.StatusBadRequest, code)
+			}
+			if problem.InvalidParams == nil || !reflect.DeepEqual(*problem.InvalidParams, tc.want) {
+				t.Errorf("Expected invalid params %+v, but was %+v", tc.want, problem.InvalidParams)
+			}
+		})
+	}
+
+	body := api.SignupRequest{Username: "Safe", Email: "safe@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", body, nil); code != http.StatusCreated {
+		t.Errorf("Signup with a safe password, expected %d, but was %d", http.StatusCreated, code)
+	}
+}
+
+func TestBreachCheckFailureAccepted(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Breaches: breachedPasswords{err: errors.New("corpus unavailable")}})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	body := api.SignupRequest{Username: "Safe", Email: "safe@barz.com", Password: "S3cret-pass"}
+	if code := post(t, ts, "/signup", "", body, nil); code != http.StatusCreated {
+		t.Errorf("Expected status code to be %d, but was %d", http.StatusCreated, code)
+	}
+}
+
+func TestNewBreachChecker(t *testing.T) {
+	cfg := config.Default().Password
+	if c, err := NewBreachChecker(cfg); c != nil || err != nil {
+		t.Errorf("Expected no checker, but was %v, %v", c, err)
+	}
+
+	cfg.BreachCheck = "range"
+	cfg.BreachPath = t.TempDir()
+	if c, err := NewBreachChecker(cfg); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	} else if _, ok := c.(security.RangeChecker); !ok {
+		t.Errorf("Expected RangeChecker, but was %T", c)
+	}
+
+	cfg.BreachCheck = "bloom"
+	cfg.BreachPath = filepath.Join(cfg.BreachPath, "pwned.bloom")
+	f, _ := os.Create(cfg.BreachPath)
+	security.NewBloomFilter(1, 0.01).WriteTo(f)
+	f.Close()
+	if c, err := NewBreachChecker(cfg); err != nil {
+		t.Errorf("err was not nil, %q", err.Error())
+	} else if _, ok := c.(*security.BloomFilter); !ok {
+		t.Errorf("Expected BloomFilter, but was %T", c)
+	}
+
+	cfg.BreachCheck = "range"
+	if _, err := NewBreachChecker(cfg); err == nil {
+		t.Error("Expected error when the range path isn't a directory")
+	}
+}
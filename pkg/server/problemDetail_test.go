@@ -1,80 +1,68 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"testing"
 
-	"github.com/go-sql-driver/mysql"
+	"github.com/Nesquiko/go-auth/pkg/db"
 )
 
-func TestGetProblemDetailsMySQLDuplicateEntryUsername(t *testing.T) {
-	fakeError := mysql.MySQLError{
-		Number:  1062,
-		Message: "duplicate entries for users.username",
-	}
-	wantCode := http.StatusConflict
+func TestGetProblemDetailsDuplicateEntry(t *testing.T) {
 	wantInstance := "/signup"
 
-	problem := GetProblemDetails(&fakeError, wantInstance)
-
-	if problem.StatusCode != wantCode {
-		t.Errorf("Wrong status code, expected: %d, but was %d", wantCode, problem.StatusCode)
+	tests := []struct {
+		name       string
+		err        error
+		wantTitle  string
+		wantDetail string
+	}{
+		{
+			name:       "Username",
+			err:        &db.DuplicateEntryError{Field: "username", Value: "joe"},
+			wantTitle:  "Username already exists",
+			wantDetail: "Username 'joe' already exists",
+		},
+		{
+			name:       "Email",
+			err:        &db.DuplicateEntryError{Field: "email", Value: "joe@bar.com"},
+			wantTitle:  "Email already used",
+			wantDetail: "Email 'joe@bar.com' is already used",
+		},
+		{
+			name:       "Unknown",
+			err:        &db.DuplicateEntryError{},
+			wantTitle:  "Unknown duplicate entry",
+			wantDetail: "Unknown entry '' is already used",
+		},
+		{
+			name:       "Wrapped",
+			err:        fmt.Errorf("saving user: %w", &db.DuplicateEntryError{Field: "username", Value: "joe"}),
+			wantTitle:  "Username already exists",
+			wantDetail: "Username 'joe' already exists",
+		},
 	}
-	if problem.Instance != wantInstance {
-		t.Errorf("Wrong instance, expected: %q, but was %q", wantInstance, problem.Instance)
-	}
-}
-
-func TestGetProblemDetailsMySQLDuplicateEntryEmail(t *testing.T) {
-	fakeError := mysql.MySQLError{
-		Number:  1062,
-		Message: "duplicate entries for users.email",
-	}
-	wantCode := http.StatusConflict
-	wantInstance := "/signup"
-
-	problem := GetProblemDetails(&fakeError, wantInstance)
-
-	if problem.StatusCode != wantCode {
-		t.Errorf("Wrong status code, expected: %d, but was %d", wantCode, problem.StatusCode)
-	}
-	if problem.Instance != wantInstance {
-		t.Errorf("Wrong instance, expected: %q, but was %q", wantInstance, problem.Instance)
-	}
-}
-
-func TestGetProblemDetailsMySQLDuplicateUnknownEntry(t *testing.T) {
-	fakeError := mysql.MySQLError{
-		Number:  1062,
-		Message: "duplicate entries",
-	}
-	wantCode := http.StatusConflict
-	wantInstance := "/signup"
-
-	problem := GetProblemDetails(&fakeError, wantInstance)
-
-	if problem.StatusCode != wantCode {
-		t.Errorf("Wrong status code, expected: %d, but was %d", wantCode, problem.StatusCode)
-	}
-	if problem.Instance != wantInstance {
-		t.Errorf("Wrong instance, expected: %q, but was %q", wantInstance, problem.Instance)
-	}
-}
-
-func TestGetProblemDetailsUnknownMySQLError(t *testing.T) {
-	fakeError := mysql.MySQLError{
-		Number:  1,
-		Message: "unknown error",
-	}
-
-	wantInstance := "/login"
-	problem := GetProblemDetails(&fakeError, wantInstance)
-
-	if !reflect.DeepEqual(problem, UnexpectedErrorProblem(wantInstance)) {
-		t.Errorf("Returned problem is not UnexpectedErrorProblem, %q", problem)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := GetProblemDetails(tt.err, wantInstance)
+
+			if problem.StatusCode != http.StatusConflict {
+				t.Errorf("Wrong status code, expected: %d, but was %d", http.StatusConflict, problem.StatusCode)
+			}
+			if problem.Title != tt.wantTitle {
+				t.Errorf("Wrong title, expected: %q, but was %q", tt.wantTitle, problem.Title)
+			}
+			if problem.Detail != tt.wantDetail {
+				t.Errorf("Wrong detail, expected: %q, but was %q", tt.wantDetail, problem.Detail)
+			}
+			if problem.Instance != wantInstance {
+				t.Errorf("Wrong instance, expected: %q, but was %q", wantInstance, problem.Instance)
+			}
+		})
 	}
 }
 
@@ -100,6 +88,17 @@ func TestGetProblemDetailsUnknownError(t *testing.T) {
 	problem := GetProblemDetails(fakeError, wantInstance)
 
 	if !reflect.DeepEqual(problem, UnexpectedErrorProblem(wantInstance)) {
-		t.Errorf("Returned problem is not UnexpectedErrorProblem, %q", problem)
+		t.Errorf("Returned problem is not UnexpectedErrorProblem, %+v", problem)
+	}
+}
+
+func TestGetProblemDetailsDeadlineExceeded(t *testing.T) {
+	fakeError := fmt.Errorf("%w: interrupted", context.DeadlineExceeded)
+	wantInstance := "/login"
+
+	problem := GetProblemDetails(fakeError, wantInstance)
+
+	if !reflect.DeepEqual(problem, ServiceUnavailable(wantInstance)) {
+		t.Errorf("Returned problem is not ServiceUnavailable, %+v", problem)
 	}
 }
@@ -1,15 +1,15 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
-	"strings"
 
 	"github.com/Nesquiko/go-auth/pkg/api"
-	"github.com/go-sql-driver/mysql"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/security"
 )
 
 // UnexpectedErrorProblem returns generic problem details response used when an
@@ -34,6 +34,82 @@ func InvalidCredentials(relPath string) *api.ProblemDetails {
 	}
 }
 
+// EmailNotVerified returns a problem details response used when a user with
+// an unverified email address logs in, while verified addresses are required.
+func EmailNotVerified(relPath string) *api.ProblemDetails {
+	return &api.ProblemDetails{
+		StatusCode: http.StatusForbidden,
+		Title:      "Email not verified",
+		Detail:     "Verify your email address before logging in",
+		Instance:   relPath,
+	}
+}
+
+// InvalidVerificationToken returns a problem details response used when
+// a submitted email verification token is invalid, expired or already used.
+func InvalidVerificationToken(relPath string) *api.ProblemDetails {
+	return &api.ProblemDetails{
+		StatusCode: http.StatusBadRequest,
+		Title:      "Invalid verification token",
+		Detail:     "Verification token is invalid, expired or was already used",
+		Instance:   relPath,
+	}
+}
+
+// WeakPassword returns a problem details response used when a password
+// submitted in the field doesn't satisfy the password policy. Each rule
+// broken according to the err is listed as an invalid param of the field.
+func WeakPassword(err error, field, relPath string) *api.ProblemDetails {
+	invalid := []api.InvalidParam{}
+	var policyErr *security.PolicyError
+	if errors.As(err, &policyErr) {
+		for _, reason := range policyErr.Reasons {
+			invalid = append(invalid, api.InvalidParam{Name: field, Reason: reason})
+		}
+	}
+
+	return &api.ProblemDetails{
+		StatusCode:    http.StatusBadRequest,
+		Title:         "Weak password",
+		Detail:        "Password doesn't satisfy the password policy",
+		Instance:      relPath,
+		InvalidParams: &invalid,
+	}
+}
+
+// InvalidResetToken returns a problem details response used when a submitted
+// password reset token is invalid, expired or already used.
+func InvalidResetToken(relPath string) *api.ProblemDetails {
+	return &api.ProblemDetails{
+		StatusCode: http.StatusBadRequest,
+		Title:      "Invalid reset token",
+		Detail:     "Password reset token is invalid, expired or was already used",
+		Instance:   relPath,
+	}
+}
+
+// InvalidClient returns a problem details response used when a client calling
+// a privileged endpoint submits missing or invalid client credentials.
+func InvalidClient(relPath string) *api.ProblemDetails {
+	return &api.ProblemDetails{
+		StatusCode: http.StatusUnauthorized,
+		Title:      "Invalid client",
+		Detail:     "Client credentials are missing or invalid",
+		Instance:   relPath,
+	}
+}
+
+// ServiceUnavailable returns a problem details response used when the database
+// didn't respond in time.
+func ServiceUnavailable(relPath string) *api.ProblemDetails {
+	return &api.ProblemDetails{
+		StatusCode: http.StatusServiceUnavailable,
+		Title:      "Service unavailable",
+		Detail:     "The service is temporarily unavailable, try again later.",
+		Instance:   relPath,
+	}
+}
+
 func Unauthorized(relPaht string) *api.ProblemDetails {
 	return &api.ProblemDetails{
 		StatusCode: http.StatusUnauthorized,
@@ -48,15 +124,27 @@ func Unauthorized(relPaht string) *api.ProblemDetails {
 func GetProblemDetails(err error, relPath string) (problem *api.ProblemDetails) {
 
 	problem = UnexpectedErrorProblem(relPath)
-	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
-		problem = mySQLProblem(*mysqlErr, relPath)
+	var dupErr *db.DuplicateEntryError
+	if errors.As(err, &dupErr) {
+		problem = duplicateEntryProblem(dupErr, relPath)
 	} else if errors.Is(err, sql.ErrNoRows) {
 		problem = InvalidCredentials(relPath)
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		problem = ServiceUnavailable(relPath)
 	}
 
 	return problem
 }
 
+// databaseProblem returns ServiceUnavailable if the err is caused by the
+// database not responding in time, otherwise UnexpectedErrorProblem.
+func databaseProblem(err error, relPath string) *api.ProblemDetails {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ServiceUnavailable(relPath)
+	}
+	return UnexpectedErrorProblem(relPath)
+}
+
 // BadRequest is used when user sends a invalid/malformed JSON request. Details
 // are extracted from the error param, if the error param can't be casted as
 // malformedRequest, generic UnexpectedErrorProblem is returned.
@@ -73,51 +161,30 @@ func BadRequest(err error, relPath string) *api.ProblemDetails {
 	return UnexpectedErrorProblem(relPath)
 }
 
-// mySQLProblem function returns specific problem details accourding to the
-// error number in the MySQLError. If the error has unknown number, generic
-// UnexpectedErrorProblem is returned.
-func mySQLProblem(err mysql.MySQLError, relPath string) *api.ProblemDetails {
-
-	var statusCode int
+// duplicateEntryProblem returns a problem details response identifying which
+// submitted entry is a duplicate according to the err.
+func duplicateEntryProblem(err *db.DuplicateEntryError, relPath string) *api.ProblemDetails {
 	var title, detail string
 
-	switch err.Number {
-	case 1062:
-		statusCode = http.StatusConflict
-		title, detail = sqlDuplicateEntry(err)
+	switch err.Field {
+	case "username":
+		title = "Username already exists"
+		detail = fmt.Sprintf("Username '%s' already exists", err.Value)
+
+	case "email":
+		title = "Email already used"
+		detail = fmt.Sprintf("Email '%s' is already used", err.Value)
 
 	default:
-		return UnexpectedErrorProblem(relPath)
+		title = "Unknown duplicate entry"
+		detail = fmt.Sprintf("Unknown entry '%s' is already used", err.Value)
+
 	}
 
 	return &api.ProblemDetails{
-		StatusCode: statusCode,
+		StatusCode: http.StatusConflict,
 		Title:      title,
 		Detail:     detail,
 		Instance:   relPath,
 	}
 }
-
-// sqlDuplicateEntry is a util function for identifying which submitted entry is
-// a duplicate according to the err. Then it returns corresponding type, title and
-// detail for creation of a problem details response.
-func sqlDuplicateEntry(err mysql.MySQLError) (title, detail string) {
-	re := regexp.MustCompile(`'(.{3,30}?)'`)
-	entry := re.FindString(err.Message)
-
-	if strings.Contains(err.Message, "users.username") {
-		title = "Username already exists"
-		detail = fmt.Sprintf("Username %s already exists", entry)
-
-	} else if strings.Contains(err.Message, "users.email") {
-		title = "Email already used"
-		detail = fmt.Sprintf("Email %s is already used", entry)
-
-	} else {
-		title = "Unknown duplicate entry"
-		detail = fmt.Sprintf("Unknown entry %s is already used", entry)
-
-	}
-
-	return
-}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/mail"
+	"github.com/Nesquiko/go-auth/pkg/middleware"
+	"github.com/Nesquiko/go-auth/pkg/security"
+	"github.com/google/uuid"
+)
+
+// Recover2FA completes 2FA with a recovery code instead of an OTP, for users
+// who lost their authenticator device. Every code can be used only once, the
+// response tells how many remain, and the user is notified that a code was
+// used. The issued access JWT can replace the 2FA secret by Setup2FA, tokens
+// obtained by refreshing it can't.
+func (s GoAuthServer) Recover2FA(w http.ResponseWriter, r *http.Request) {
+
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	var req api.Recover2FAJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
+	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	used, err := s.store.UseRecoveryCode(r.Context(), c.Username, security.HashRecoveryCode(req.RecoveryCode))
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+	if !used {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	jwt, refreshToken, err := s.issueTokens(r.Context(), security.Subject{
+		UserID:    c.Subject,
+		Username:  c.Username,
+		SessionID: uuid.NewString(),
+		Recovered: true,
+	})
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	remaining, err := s.store.RecoveryCodesRemaining(r.Context(), c.Username)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	s.goBackground(func(ctx context.Context) {
+		if err := s.sendRecoveryCodeUsedEmail(ctx, c.Username, remaining); err != nil {
+			fmt.Printf("Sending recovery code notification to %s failed: %s\n", c.Username, err)
+		}
+	})
+
+	response := api.RecoverResponse{
+		AccessToken:            jwt,
+		RefreshToken:           refreshToken,
+		RecoveryCodesRemaining: remaining,
+	}
+	respondWithSuccess(w, response)
+}
+
+// GetRecoveryCodes returns how many recovery codes of the authenticated user
+// remain unused. The codes themselves are shown only when generated.
+func (s GoAuthServer) GetRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	remaining, err := s.store.RecoveryCodesRemaining(r.Context(), c.Username)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	respondWithSuccess(w, api.RecoveryCodesStatusResponse{Remaining: remaining})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the authenticated
+// user with new ones, e.g. when most of them were used or they leaked. The
+// user must have 2FA enabled and submit a valid OTP.
+func (s GoAuthServer) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	var req api.RegenerateRecoveryCodesJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
+	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	user, err := s.store.UserByUsername(r.Context(), c.Username)
+	if err != nil {
+		respondWithError(w, GetProblemDetails(err, r.URL.Path))
+		return
+	}
+
+	if !user.Enabled2FA || !s.otp.Verify(user.Secret2FA.String, req.Otp) {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	codes, err := s.replaceRecoveryCodes(r.Context(), user.Username)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	respondWithSuccess(w, api.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// replaceRecoveryCodes generates new recovery codes of the user, replaces
+// the stored ones with their hashes and returns the codes.
+func (s GoAuthServer) replaceRecoveryCodes(ctx context.Context, username string) ([]string, error) {
+	codes, err := security.NewRecoveryCodes(security.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.ReplaceRecoveryCodes(ctx, username, codes.Hashes); err != nil {
+		return nil, err
+	}
+
+	return codes.Codes, nil
+}
+
+// sendRecoveryCodeUsedEmail notifies the user, that a recovery code was used
+// to log in, and how many codes remain.
+func (s GoAuthServer) sendRecoveryCodeUsedEmail(ctx context.Context, username string, remaining int) error {
+	user, err := s.store.UserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "A recovery code was used",
+		Body: fmt.Sprintf("Hi %s,\n\na recovery code was used to log in to your account, %d codes remain.\n"+
+			"\nIf it wasn't you, change your password and regenerate your recovery codes immediately.\n",
+			user.Username, remaining),
+	})
+}
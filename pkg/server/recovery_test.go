@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/security"
+)
+
+// enable2FA sets up and verifies 2FA of susan with the otp accepted by the
+// server and returns her recovery codes.
+func enable2FA(t *testing.T, s *testServer, ts *httptest.Server, otp int) []string {
+	t.Helper()
+
+	mfa, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+	if code := post(t, ts, "/2fa/setup", mfa, nil, nil); code != http.StatusOK {
+		t.Fatalf("Setup 2FA, expected %d, but was %d", http.StatusOK, code)
+	}
+
+	var verified api.VerifyResponse
+	if code := post(t, ts, "/2fa/verify", mfa, api.Verify2FARequest{Otp: otp}, &verified); code != http.StatusOK {
+		t.Fatalf("Verify 2FA, expected %d, but was %d", http.StatusOK, code)
+	}
+	if verified.RecoveryCodes == nil {
+		t.Fatal("Expected recovery codes when 2FA is enabled")
+	}
+	return *verified.RecoveryCodes
+}
+
+func TestVerify2FAGeneratesRecoveryCodesOnce(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	codes := enable2FA(t, s, ts, 424242)
+	if len(codes) != security.RecoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, but was %d", security.RecoveryCodeCount, len(codes))
+	}
+
+	mfa, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+	var verified api.VerifyResponse
+	post(t, ts, "/2fa/verify", mfa, api.Verify2FARequest{Otp: 424242}, &verified)
+	if verified.RecoveryCodes != nil {
+		t.Errorf("Expected no recovery codes once 2FA is enabled, but was %v", *verified.RecoveryCodes)
+	}
+}
+
+func TestRecover2FA(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	codes := enable2FA(t, s, ts, 424242)
+	mfa, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+
+	// codes can be typed in any case
+	req := api.Recover2FARequest{RecoveryCode: strings.ToUpper(codes[0])}
+	var recovered api.RecoverResponse
+	if code := post(t, ts, "/2fa/recover", mfa, req, &recovered); code != http.StatusOK {
+		t.Fatalf("Recover with an unused code, expected %d, but was %d", http.StatusOK, code)
+	}
+	if recovered.RecoveryCodesRemaining != security.RecoveryCodeCount-1 {
+		t.Errorf("Expected %d remaining codes, but was %d", security.RecoveryCodeCount-1, recovered.RecoveryCodesRemaining)
+	}
+	if code := testAuth(t, ts, recovered.AccessToken); code != http.StatusOK {
+		t.Errorf("Expected full access with recovered token, but was %d", code)
+	}
+
+	if code := post(t, ts, "/2fa/recover", mfa, req, nil); code != http.StatusUnauthorized {
+		t.Errorf("Recover with a used code, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	unknown := api.Recover2FARequest{RecoveryCode: "abcd-efgh-ijkl-mnop"}
+	if code := post(t, ts, "/2fa/recover", mfa, unknown, nil); code != http.StatusUnauthorized {
+		t.Errorf("Recover with an unknown code, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	var status api.RecoveryCodesStatusResponse
+	if code := get(t, ts, "/2fa/recovery-codes", recovered.AccessToken, &status); code != http.StatusOK {
+		t.Fatalf("Get recovery codes, expected %d, but was %d", http.StatusOK, code)
+	}
+	if status.Remaining != security.RecoveryCodeCount-1 {
+		t.Errorf("Expected %d remaining codes, but was %d", security.RecoveryCodeCount-1, status.Remaining)
+	}
+
+	s.server.Wait()
+	sent := s.mailbox.sent()
+	if len(sent) != 1 || sent[0].To != "susan@barz.com" || sent[0].Subject != "A recovery code was used" {
+		t.Errorf("Expected a notification to susan@barz.com, but was %+v", sent)
+	}
+}
+
+func TestRecover2FARequiresMFAPendingToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	codes := enable2FA(t, s, ts, 424242)
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	req := api.Recover2FARequest{RecoveryCode: codes[0]}
+	if code := post(t, ts, "/2fa/recover", access, req, nil); code != http.StatusUnauthorized {
+		t.Errorf("Recover with an access token, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	old := enable2FA(t, s, ts, 424242)
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	wrong := api.RegenerateRecoveryCodesRequest{Otp: 424241}
+	if code := post(t, ts, "/2fa/recovery-codes", access, wrong, nil); code != http.StatusUnauthorized {
+		t.Errorf("Regenerate with wrong OTP, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	var regenerated api.RecoveryCodesResponse
+	req := api.RegenerateRecoveryCodesRequest{Otp: 424242}
+	if code := post(t, ts, "/2fa/recovery-codes", access, req, &regenerated); code != http.StatusOK {
+		t.Fatalf("Regenerate, expected %d, but was %d", http.StatusOK, code)
+	}
+	if len(regenerated.RecoveryCodes) != security.RecoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, but was %d", security.RecoveryCodeCount, len(regenerated.RecoveryCodes))
+	}
+
+	mfa, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+	if code := post(t, ts, "/2fa/recover", mfa, api.Recover2FARequest{RecoveryCode: old[0]}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Recover with a replaced code, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	fresh := api.Recover2FARequest{RecoveryCode: regenerated.RecoveryCodes[0]}
+	if code := post(t, ts, "/2fa/recover", mfa, fresh, nil); code != http.StatusOK {
+		t.Errorf("Recover with a new code, expected %d, but was %d", http.StatusOK, code)
+	}
+	s.server.Wait()
+}
+
+func TestRegenerateRecoveryCodesWithout2FA(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+	req := api.RegenerateRecoveryCodesRequest{Otp: 424242}
+	if code := post(t, ts, "/2fa/recovery-codes", access, req, nil); code != http.StatusUnauthorized {
+		t.Errorf("Regenerate without 2FA, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	remaining, _ := s.store.RecoveryCodesRemaining(context.Background(), susan.Username)
+	if remaining != 0 {
+		t.Errorf("Expected no recovery codes, but was %d", remaining)
+	}
+}
+
+func TestRecoverLostDevice(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242)})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	codes := enable2FA(t, s, ts, 424242)
+	lost, _ := s.store.Get2FASecret(context.Background(), susan.Username)
+
+	mfa, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+	if code := post(t, ts, "/2fa/setup", mfa, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Setup enabled 2FA before recovery, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	access, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+	if code := post(t, ts, "/2fa/setup", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Setup enabled 2FA with an access token, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+
+	var recovered api.RecoverResponse
+	if code := post(t, ts, "/2fa/recover", mfa, api.Recover2FARequest{RecoveryCode: codes[0]}, &recovered); code != http.StatusOK {
+		t.Fatalf("Recover, expected %d, but was %d", http.StatusOK, code)
+	}
+	if code := post(t, ts, "/2fa/setup", recovered.AccessToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("Setup 2FA after recovery, expected %d, but was %d", http.StatusOK, code)
+	}
+	if secret, _ := s.store.Get2FASecret(context.Background(), susan.Username); secret == lost {
+		t.Error("Expected the lost 2FA secret to be replaced")
+	}
+
+	// the new device completes the next login
+	mfa, _ = s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+	var verified api.VerifyResponse
+	if code := post(t, ts, "/2fa/verify", mfa, api.Verify2FARequest{Otp: 424242}, &verified); code != http.StatusOK {
+		t.Fatalf("Verify 2FA with the new device, expected %d, but was %d", http.StatusOK, code)
+	}
+
+	var regenerated api.RecoveryCodesResponse
+	req := api.RegenerateRecoveryCodesRequest{Otp: 424242}
+	if code := post(t, ts, "/2fa/recovery-codes", verified.AccessToken, req, &regenerated); code != http.StatusOK {
+		t.Fatalf("Regenerate, expected %d, but was %d", http.StatusOK, code)
+	}
+	if code := post(t, ts, "/2fa/recover", mfa, api.Recover2FARequest{RecoveryCode: codes[1]}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Recover with a replaced code, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+	s.server.Wait()
+}
+
+// barrierStore returns whether 2FA is enabled only once all reads of the
+// group are done, so no request can enable it in between.
+type barrierStore struct {
+	db.DBConnection
+	group *sync.WaitGroup
+}
+
+func (b barrierStore) GetEnabled2FA(ctx context.Context, username string) (bool, error) {
+	enabled, err := b.DBConnection.GetEnabled2FA(ctx, username)
+	b.group.Done()
+	b.group.Wait()
+	return enabled, err
+}
+
+func TestVerify2FAConcurrentlyGeneratesRecoveryCodesOnce(t *testing.T) {
+	t.Parallel()
+	const n = 8
+	arrived := &sync.WaitGroup{}
+	arrived.Add(n)
+	store := newTestServer(t, Dependencies{}).store
+	s := newTestServer(t, Dependencies{OTP: fixedOTP(424242), Store: barrierStore{store, arrived}})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	store.Save2FASecret(context.Background(), susan.Username, "JBSWY3DPEHPK3PXP")
+	mfa, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+
+	responses := make([]api.VerifyResponse, n)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			post(t, ts, "/2fa/verify", mfa, api.Verify2FARequest{Otp: 424242}, &responses[i])
+		}(i)
+	}
+	wg.Wait()
+
+	withCodes := 0
+	for _, res := range responses {
+		if res.RecoveryCodes != nil {
+			withCodes++
+		}
+	}
+	if withCodes != 1 {
+		t.Errorf("Expected recovery codes in 1 response, but was %d", withCodes)
+	}
+}
@@ -3,40 +3,291 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/base32"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
+	"net/url"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
 	"github.com/Nesquiko/go-auth/pkg/consts"
 	"github.com/Nesquiko/go-auth/pkg/db"
+	"github.com/Nesquiko/go-auth/pkg/mail"
+	"github.com/Nesquiko/go-auth/pkg/middleware"
 	"github.com/Nesquiko/go-auth/pkg/security"
-	"github.com/dgryski/dgoogauth"
+	"github.com/google/uuid"
 )
 
-// GoAuthServer is an empty struct used as a representation of a handler for
-// API endpoints.
-type GoAuthServer struct{}
+// TokenIssuer issues and validates JWTs and refresh tokens, it is implemented
+// by security.JWTIssuer.
+type TokenIssuer interface {
+	GenerateJWT(typ security.TokenType, subject security.Subject) (string, error)
+	GenerateRefreshToken() (*security.RefreshToken, error)
+	ValidateToken(ctx context.Context, token string, uses ...security.TokenType) (*security.Claims, error)
+	RevokeToken(ctx context.Context, c *security.Claims) error
+	// RevokeSession revokes all JWTs issued in the session.
+	RevokeSession(ctx context.Context, sessionID string) error
+	// PublicKeys returns keys published as a JWK set.
+	PublicKeys() []*security.SigningKey
+	// CheckKeys returns an error if no key can sign tokens.
+	CheckKeys() error
+}
+
+// PasswordHasher hashes passwords before they are stored and verifies them
+// against stored hashes, it is implemented by security.Argon2idHasher and
+// security.BcryptHasher.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) bool
+	// NeedsRehash reports whether the hash was computed by another algorithm
+	// or with weaker parameters than new hashes are.
+	NeedsRehash(hash string) bool
+}
+
+// NewPasswordHasher returns a PasswordHasher of the algorithm configured by
+// the cfg.
+func NewPasswordHasher(cfg config.Password) PasswordHasher {
+	if cfg.Algorithm == "bcrypt" {
+		return security.BcryptHasher{Cost: cfg.BcryptCost}
+	}
+
+	return security.Argon2idHasher{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+}
+
+// NewPasswordPolicy returns the password policy configured by the cfg, with
+// the denylist loaded from its file, if set.
+func NewPasswordPolicy(cfg config.Password) (*security.PasswordPolicy, error) {
+	policy := passwordPolicy(cfg)
+	if cfg.DenylistFile == "" {
+		return policy, nil
+	}
+
+	denylist, err := security.LoadDenylist(cfg.DenylistFile)
+	if err != nil {
+		return nil, err
+	}
+	policy.Denylist = denylist
+
+	return policy, nil
+}
+
+// passwordPolicy returns the password policy configured by the cfg, without
+// the denylist. Passwords hashed by Bcrypt are limited to the bytes it hashes.
+func passwordPolicy(cfg config.Password) *security.PasswordPolicy {
+	policy := &security.PasswordPolicy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		RequireUppercase: cfg.RequireUppercase,
+		RequireLowercase: cfg.RequireLowercase,
+		RequireDigit:     cfg.RequireDigit,
+		RequireSymbol:    cfg.RequireSymbol,
+	}
+	if cfg.Algorithm == "bcrypt" {
+		policy.MaxBytes = security.BcryptMaxPasswordBytes
+	}
+	return policy
+}
+
+// NewBreachChecker returns the check of breached passwords configured by the
+// cfg, or nil if none is. The Bloom filter is loaded into memory.
+func NewBreachChecker(cfg config.Password) (security.BreachChecker, error) {
+	switch cfg.BreachCheck {
+	case "range":
+		info, err := os.Stat(cfg.BreachPath)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", cfg.BreachPath)
+		}
+		return security.RangeChecker{Dir: cfg.BreachPath}, nil
+	case "bloom":
+		filter, err := security.LoadBloomFilter(cfg.BreachPath)
+		if err != nil {
+			return nil, err
+		}
+		return filter, nil
+	}
+	return nil, nil
+}
+
+// OTPVerifier verifies one-time passwords of users with enabled 2FA.
+type OTPVerifier interface {
+	// Verify reports whether the otp is valid for the secret now.
+	Verify(secret string, otp int) bool
+}
+
+// Dependencies are services a GoAuthServer depends on. Store and Tokens are
+// required, the rest have defaults.
+type Dependencies struct {
+	// Store is the database of users and tokens.
+	Store db.DBConnection
+	// Tokens issues and validates tokens.
+	Tokens TokenIssuer
+	// Clock tells the current time of expirations checked by the server,
+	// of password reset and refresh tokens, and of the default OTP,
+	// security.SystemClock by default. Tokens, Store and signing keys keep
+	// their own time.
+	Clock security.Clock
+	// Hasher hashes passwords, the one of NewPasswordHasher by default.
+	Hasher PasswordHasher
+	// Policy checks new passwords, by default the configured one without
+	// the denylist, which is loaded by NewPasswordPolicy.
+	Policy *security.PasswordPolicy
+	// Breaches rejects new passwords exposed in data breaches, none are by
+	// default.
+	Breaches security.BreachChecker
+	// OTP verifies OTPs, security.TOTPVerifier with the configured window
+	// and the Clock by default.
+	OTP OTPVerifier
+	// Clients are authenticated by the introspection endpoint, no client is
+	// by default.
+	Clients *security.ClientStore
+	// Mailer sends emails to users, by default they are printed to the
+	// standard output.
+	Mailer mail.Mailer
+}
+
+// backgroundTimeout limits background tasks, such as sending emails.
+const backgroundTimeout = 30 * time.Second
+
+// GoAuthServer is a struct used as a representation of a handler for API
+// endpoints.
+type GoAuthServer struct {
+	store    db.DBConnection
+	tokens   TokenIssuer
+	clock    security.Clock
+	hasher   PasswordHasher
+	policy   *security.PasswordPolicy
+	breaches security.BreachChecker
+	otp      OTPVerifier
+	clients  *security.ClientStore
+	mailer   mail.Mailer
+
+	// maxBodySize is a maximal size, in Bytes, of a JSON request body.
+	maxBodySize int64
+	// totpIssuer is a name of the application shown in authenticator apps.
+	totpIssuer string
+	// requireVerifiedEmail rejects login of users with unverified emails.
+	requireVerifiedEmail bool
+	// verificationURL is a page verifying email addresses, linked in emails.
+	verificationURL string
+	// resetLifetime is a lifetime of password reset tokens.
+	resetLifetime time.Duration
+	// passwordResetURL is a page resetting passwords, linked in emails.
+	passwordResetURL string
+	// background tracks tasks running after their request was answered.
+	background *sync.WaitGroup
+	// readinessChecks are run by the readiness probe.
+	readinessChecks []ReadinessCheck
+}
+
+// NewGoAuthServer creates a GoAuthServer configured by the cfg, which serves
+// requests with the deps. The Store and Tokens are required, other deps have
+// defaults. The checks of configured dependencies are run by the readiness
+// probe, in addition to checks of the database and signing keys.
+func NewGoAuthServer(cfg *config.Config, deps Dependencies, checks ...ReadinessCheck) (GoAuthServer, error) {
+	if deps.Store == nil {
+		return GoAuthServer{}, errors.New("no Store dependency")
+	}
+	if deps.Tokens == nil {
+		return GoAuthServer{}, errors.New("no Tokens dependency")
+	}
+	if deps.Clock == nil {
+		deps.Clock = security.SystemClock{}
+	}
+	if deps.Hasher == nil {
+		deps.Hasher = NewPasswordHasher(cfg.Password)
+	}
+	if deps.Policy == nil {
+		deps.Policy = passwordPolicy(cfg.Password)
+	}
+	if deps.OTP == nil {
+		deps.OTP = security.TOTPVerifier{Window: cfg.TOTP.Window, Clock: deps.Clock}
+	}
+	if deps.Clients == nil {
+		deps.Clients, _ = security.ParseClients("")
+	}
+	if deps.Mailer == nil {
+		deps.Mailer = mail.NewFileMailer(cfg.Email.From, os.Stdout)
+	}
+
+	s := GoAuthServer{
+		store:                deps.Store,
+		tokens:               deps.Tokens,
+		clock:                deps.Clock,
+		hasher:               deps.Hasher,
+		policy:               deps.Policy,
+		breaches:             deps.Breaches,
+		otp:                  deps.OTP,
+		clients:              deps.Clients,
+		mailer:               deps.Mailer,
+		maxBodySize:          cfg.Server.MaxBodySize,
+		totpIssuer:           cfg.TOTP.Issuer,
+		requireVerifiedEmail: cfg.Email.RequireVerified,
+		verificationURL:      cfg.Email.VerificationURL,
+		resetLifetime:        cfg.Tokens.PasswordResetLifetime,
+		passwordResetURL:     cfg.Email.PasswordResetURL,
+		background:           &sync.WaitGroup{},
+	}
+	s.readinessChecks = append(s.defaultReadinessChecks(), checks...)
+
+	return s, nil
+}
+
+// Wait waits until all background tasks, such as sending emails after
+// a response was already sent, are finished.
+func (s GoAuthServer) Wait() {
+	s.background.Wait()
+}
+
+// goBackground runs the task in a new goroutine tracked by Wait. The task
+// gets a context detached from the request, limited by the backgroundTimeout.
+func (s GoAuthServer) goBackground(task func(ctx context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+		task(ctx)
+	}()
+}
 
 // Signup handles when a user sends a request to the /signup endpoint for signing
-// up. After successfully decoding JSON request, new user entry is saved into the
-// database.
+// up. After successfully decoding JSON request and checking the password
+// against the password policy and breached passwords, new user entry is saved
+// into the database and a token verifying the email address is sent to it in
+// the background. The user is created even if the email can't be sent.
 // Specific endpoint details can be found in ./openapi folder in the
 // OpenAPI specification.
 func (s GoAuthServer) Signup(w http.ResponseWriter, r *http.Request) {
 
 	var req api.SignupRequest
-	err := validateJSONRequestBody(w, r, &req)
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
 	if err != nil {
 		respondWithError(w, BadRequest(err, r.URL.Path))
 		return
 	}
 
-	hashedPassword, err := security.EncryptPassword(req.Password)
+	if err := s.checkPassword(r.Context(), req.Password, req.Username, req.Email); err != nil {
+		respondWithError(w, WeakPassword(err, "password", r.URL.Path))
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.Password)
 	if err != nil {
 		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
 		return
@@ -48,40 +299,69 @@ func (s GoAuthServer) Signup(w http.ResponseWriter, r *http.Request) {
 		PasswordHash: hashedPassword,
 	}
 
-	err = db.DBConn.SaveUser(newUser)
+	err = s.store.SaveUser(r.Context(), newUser)
 	if err != nil {
 		respondWithError(w, GetProblemDetails(err, r.URL.Path))
 		return
 	}
+
+	s.goBackground(func(ctx context.Context) {
+		user, err := s.store.UserByUsername(ctx, newUser.Username)
+		if err == nil {
+			err = s.sendVerificationEmail(ctx, user)
+		}
+		if err != nil {
+			fmt.Printf("Sending verification email to %s failed: %s\n", newUser.Username, err)
+		}
+	})
+
+	w.WriteHeader(http.StatusCreated)
 }
 
 // Login handles when a user sends a request to the /login endpoint for logging
 // in. After successfully decoding JSON request, user credentials are compared
 // with corresponding ones retrieved from database. If credentials are valid
-// new JWT token is generated for the user and sent.
+// new JWT token is generated for the user and sent. A hash of the password
+// computed by an old algorithm, or with weaker parameters, is replaced. If
+// verified email addresses are required, users with unverified ones are
+// rejected.
 // Specific endpoint details can be found in ./openapi folder in the
 // OpenAPI specification.
 func (s GoAuthServer) Login(w http.ResponseWriter, r *http.Request) {
 
 	var req api.LoginRequest
-	err := validateJSONRequestBody(w, r, &req)
+	err := validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
 	if err != nil {
 		respondWithError(w, BadRequest(err, r.URL.Path))
 		return
 	}
 
-	user, err := db.DBConn.UserByUsername(req.Username)
+	user, err := s.store.UserByUsername(r.Context(), req.Username)
 	if err != nil {
 		respondWithError(w, GetProblemDetails(err, r.URL.Path))
 		return
 	}
 
-	if !security.HashAndPasswordMatch(user.PasswordHash, req.Password) {
+	if !s.hasher.Verify(user.PasswordHash, req.Password) {
 		respondWithError(w, InvalidCredentials(r.URL.Path))
 		return
 	}
 
-	jwt, err := security.GenerateJWT(req.Username, false)
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if err := s.rehashPassword(r.Context(), user.Username, req.Password); err != nil {
+			fmt.Printf("Rehashing password of %s failed: %s\n", user.Username, err)
+		}
+	}
+
+	if s.requireVerifiedEmail && !user.EmailVerified {
+		respondWithError(w, EmailNotVerified(r.URL.Path))
+		return
+	}
+
+	jwt, err := s.tokens.GenerateJWT(security.TokenMFAPending, security.Subject{
+		UserID:   user.Uuid.String(),
+		Username: user.Username,
+	})
 	if err != nil {
 		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
 		return
@@ -91,30 +371,36 @@ func (s GoAuthServer) Login(w http.ResponseWriter, r *http.Request) {
 	respondWithSuccess(w, response)
 }
 
+// rehashPassword replaces the stored hash of the password of the user with
+// a new one, computed by the current algorithm and parameters of the hasher.
+// Hashes are upgraded on login, because only then the password is known.
+func (s GoAuthServer) rehashPassword(ctx context.Context, username, password string) error {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.store.UpdatePassword(ctx, username, passwordHash)
+}
+
 // Setup2FA creates new 2FA secret for user and returns a 2FA uri
-// for generating QR code.
+// for generating QR code. Users with 2FA enabled, who lost the authenticator
+// device, can replace the secret only with an access JWT issued by Recover2FA.
 func (s GoAuthServer) Setup2FA(w http.ResponseWriter, r *http.Request) {
 
-	bearer := r.Header.Get(consts.Authorization)
-	if bearer == "" {
-		respondWithError(w, Unauthorized(r.URL.Path))
-		return
-	}
-
-	token := strings.Split(bearer, consts.BearerPrefix)[1]
-	c, err := security.ValidateToken(token)
-	if err != nil {
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
 	}
 
-	enabled, err := db.DBConn.GetEnabled2FA(c.Username)
+	enabled, err := s.store.GetEnabled2FA(r.Context(), c.Username)
 	if err != nil {
-		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
+		respondWithError(w, databaseProblem(err, r.URL.Path))
 		return
 	}
 
-	if enabled {
+	if (enabled || c.TokenUse == security.TokenAccess) && !c.Recovered {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
 	}
@@ -123,101 +409,258 @@ func (s GoAuthServer) Setup2FA(w http.ResponseWriter, r *http.Request) {
 	rand.Read(random)
 	secret := base32.StdEncoding.EncodeToString(random)
 
-	err = db.DBConn.Save2FASecret(c.Username, secret)
+	err = s.store.Save2FASecret(r.Context(), c.Username, secret)
 	if err != nil {
-		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
+		respondWithError(w, databaseProblem(err, r.URL.Path))
 		return
 	}
 	authLink := fmt.Sprintf(
-		"otpauth://totp/GoAuth:%s?secret=%s&issuer=GoAuth",
+		"otpauth://totp/%s:%s?secret=%s&issuer=%s",
+		url.PathEscape(s.totpIssuer),
 		c.Username,
 		secret,
+		url.QueryEscape(s.totpIssuer),
 	)
 	response := api.Secret2FAResponse{QrURI: &authLink}
 	respondWithSuccess(w, response)
 }
 
+// Verify2FA verifies the OTP of the user and issues a full access JWT and
+// a refresh token. The first successful verification enables 2FA of the user
+// and returns new recovery codes, which replace the OTP if the authenticator
+// device is lost.
 func (s GoAuthServer) Verify2FA(w http.ResponseWriter, r *http.Request) {
 
-	bearer := r.Header.Get(consts.Authorization)
-	if bearer == "" {
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
 	}
 
-	token := strings.Split(bearer, consts.BearerPrefix)[1]
-	c, err := security.ValidateToken(token)
-	if err != nil {
-		respondWithError(w, Unauthorized(r.URL.Path))
+	// a missing secret fails the authentication below
+	sec, err := s.store.Get2FASecret(r.Context(), c.Username)
+	if errors.Is(err, context.DeadlineExceeded) {
+		respondWithError(w, ServiceUnavailable(r.URL.Path))
 		return
 	}
-
-	sec, _ := db.DBConn.Get2FASecret(c.Username)
-	otpc := &dgoogauth.OTPConfig{
-		Secret:      sec,
-		WindowSize:  3,
-		HotpCounter: 0,
-	}
 	var req api.Verify2FAJSONRequestBody
-	err = validateJSONRequestBody(w, r, &req)
+	err = validateJSONRequestBodyOfSize(w, r, &req, s.maxBodySize)
 	if err != nil {
 		respondWithError(w, BadRequest(err, r.URL.Path))
 		return
 	}
 
-	ok, err := otpc.Authenticate(strconv.FormatInt(int64(req.Otp), 10))
-	if err != nil {
-		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
-		return
-	}
-
-	if !ok {
+	if !s.otp.Verify(sec, req.Otp) {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
 	}
 
-	jwt, err := security.GenerateJWT(c.Username, true)
+	jwt, refreshToken, err := s.issueTokens(r.Context(), security.Subject{
+		UserID:    c.Subject,
+		Username:  c.Username,
+		SessionID: uuid.NewString(),
+	})
 	if err != nil {
-		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
+		respondWithError(w, databaseProblem(err, r.URL.Path))
 		return
 	}
 	response := api.VerifyResponse{
-		AccessToken: jwt,
+		AccessToken:  jwt,
+		RefreshToken: refreshToken,
 	}
 
-	enabled, err := db.DBConn.GetEnabled2FA(c.Username)
+	// recovery codes are generated only by the request which enabled 2FA,
+	// they are shown only in this response
+	enabled, err := s.store.Enable2FA(r.Context(), c.Username)
 	if err != nil {
-		respondWithError(w, UnexpectedErrorProblem(r.URL.Path))
+		respondWithError(w, databaseProblem(err, r.URL.Path))
 		return
 	}
 
-	if !enabled {
-		db.DBConn.UpdateEnabled2FA(c.Username, true)
+	if enabled {
+		codes, err := s.replaceRecoveryCodes(r.Context(), c.Username)
+		if err != nil {
+			respondWithError(w, databaseProblem(err, r.URL.Path))
+			return
+		}
+		response.RecoveryCodes = &codes
 	}
 
 	respondWithSuccess(w, response)
 }
 
 func (s GoAuthServer) TestAuth(w http.ResponseWriter, r *http.Request) {
-	bearer := r.Header.Get(consts.Authorization)
-	if bearer == "" {
+	if _, ok := middleware.ClaimsFromContext(r.Context()); !ok {
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	respondWithSuccess(w, "Full access granted")
+}
+
+// Logout revokes the submitted token, and if it was issued after 2FA, also
+// the whole session, all refresh tokens and access tokens issued in it. The
+// tokens are rejected by the token issuer until they expire.
+func (s GoAuthServer) Logout(w http.ResponseWriter, r *http.Request) {
+
+	c, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
 	}
 
-	token := strings.Split(bearer, consts.BearerPrefix)[1]
-	c, err := security.ValidateToken(token)
+	if err := s.tokens.RevokeToken(r.Context(), c); err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	if c.SessionID != "" {
+		if err := s.store.RevokeRefreshTokenFamily(r.Context(), c.SessionID); err != nil {
+			respondWithError(w, databaseProblem(err, r.URL.Path))
+			return
+		}
+		if err := s.tokens.RevokeSession(r.Context(), c.SessionID); err != nil {
+			respondWithError(w, databaseProblem(err, r.URL.Path))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token from the same family. Refresh tokens are opaque, so they are
+// validated only by their stored hash. The submitted refresh token is marked
+// as used, if it is submitted again, the whole family and access JWTs issued
+// in its session are revoked, because the token was most likely stolen.
+func (s GoAuthServer) RefreshToken(w http.ResponseWriter, r *http.Request) {
+
+	var req api.RefreshTokenJSONRequestBody
+	err := validateJSONRequestBodyOfSize(w, r, &req, maxTokenSize)
 	if err != nil {
+		respondWithError(w, BadRequest(err, r.URL.Path))
+		return
+	}
+
+	hash := security.HashRefreshToken(req.RefreshToken)
+	old, err := s.store.RefreshTokenByHash(r.Context(), hash)
+	if errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
+	} else if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
 	}
 
-	if !c.Authenticated {
+	if old.Revoked || !s.clock.Now().Before(old.ExpiresAt) {
 		respondWithError(w, Unauthorized(r.URL.Path))
 		return
 	}
 
-	respondWithSuccess(w, "Full access granted")
+	fresh, err := s.store.UseRefreshToken(r.Context(), hash)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	if !fresh {
+		if err = s.store.RevokeRefreshTokenFamily(r.Context(), old.FamilyID); err != nil {
+			respondWithError(w, databaseProblem(err, r.URL.Path))
+			return
+		}
+		if err = s.tokens.RevokeSession(r.Context(), old.FamilyID); err != nil {
+			respondWithError(w, databaseProblem(err, r.URL.Path))
+			return
+		}
+		respondWithError(w, Unauthorized(r.URL.Path))
+		return
+	}
+
+	user, err := s.store.UserByUsername(r.Context(), old.Username)
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	jwt, refreshToken, err := s.issueTokens(r.Context(), security.Subject{
+		UserID:    user.Uuid.String(),
+		Username:  user.Username,
+		SessionID: old.FamilyID,
+	})
+	if err != nil {
+		respondWithError(w, databaseProblem(err, r.URL.Path))
+		return
+	}
+
+	response := api.TokenResponse{
+		AccessToken:  jwt,
+		RefreshToken: refreshToken,
+	}
+	respondWithSuccess(w, response)
+}
+
+// issueTokens generates an access JWT and a refresh token for the subject.
+// The refresh token belongs to the family identified by the session ID of the
+// subject and its hash is saved into the database. The family is revoked on
+// logout.
+func (s GoAuthServer) issueTokens(ctx context.Context, subject security.Subject) (jwt, refreshToken string, err error) {
+	jwt, err = s.tokens.GenerateJWT(security.TokenAccess, subject)
+	if err != nil {
+		return "", "", err
+	}
+
+	rt, err := s.tokens.GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.store.SaveRefreshToken(ctx, &db.RefreshTokenDBEntity{
+		TokenHash: rt.Hash,
+		FamilyID:  subject.SessionID,
+		Username:  subject.Username,
+		ExpiresAt: rt.ExpiresAt,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return jwt, rt.Token, nil
+}
+
+// GetJWKS returns public parts of all asymmetric signing keys as a JSON Web
+// Key Set, so other services can validate tokens without the signing secret.
+func (s GoAuthServer) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	response := api.JWKSResponse{Keys: []api.JWK{}}
+
+	for _, key := range s.tokens.PublicKeys() {
+		jwk, ok := key.PublicJWK()
+		if !ok {
+			continue
+		}
+
+		response.Keys = append(response.Keys, api.JWK{
+			Kty: jwk.Kty,
+			Kid: jwk.Kid,
+			Use: jwk.Use,
+			Alg: jwk.Alg,
+			N:   optional(jwk.N),
+			E:   optional(jwk.E),
+			Crv: optional(jwk.Crv),
+			X:   optional(jwk.X),
+			Y:   optional(jwk.Y),
+		})
+	}
+
+	respondWithSuccess(w, response)
+}
+
+// optional returns a pointer to s, or nil if s is empty, used for optional
+// fields in responses.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
 }
 
 // respondWithSuccess takes a response to be returned to a user making a
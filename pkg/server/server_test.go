@@ -2,50 +2,171 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Nesquiko/go-auth/pkg/api"
+	"github.com/Nesquiko/go-auth/pkg/config"
 	"github.com/Nesquiko/go-auth/pkg/consts"
 	"github.com/Nesquiko/go-auth/pkg/db"
-	"github.com/Nesquiko/go-auth/pkg/db/mocks"
+	"github.com/Nesquiko/go-auth/pkg/mail"
+	"github.com/Nesquiko/go-auth/pkg/middleware"
 	"github.com/Nesquiko/go-auth/pkg/security"
 	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
-var server http.Handler
 var signupPath = "/signup"
 var loginPath = "/login"
 
-func TestMain(m *testing.M) {
-	r := chi.NewRouter()
-	var s GoAuthServer
-	servOpts := api.ChiServerOptions{
-		BaseRouter: r,
+// susan is a subject of tokens used in tests.
+var susan = security.Subject{UserID: "5f3c7e5a-5b4b-4c8a-9d1e-2f6a7b8c9d0e", Username: "Susan"}
+
+// testServer is a GoAuthServer with its own database and signing key, so
+// tests using it don't share any state and can run in parallel.
+type testServer struct {
+	handler http.Handler
+	server  GoAuthServer
+	store   db.DBConnection
+	tokens  *security.JWTIssuer
+	mailbox *mailbox
+}
+
+// mailbox is a mail.Mailer keeping sent emails, safe for concurrent use.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *mailbox) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// sent returns emails sent so far.
+func (m *mailbox) sent() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]mail.Message(nil), m.messages...)
+}
+
+// newIssuer creates a JWTIssuer with a new random key of the algorithm and
+// a memory revocation store.
+func newIssuer(t *testing.T, alg string) *security.JWTIssuer {
+	t.Helper()
+
+	tokens := config.Default().Tokens
+	keys := security.NewKeyStore("", alg, security.KeyRetention(tokens.Lifetimes()))
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	return &security.JWTIssuer{
+		Keys:        keys,
+		Revocations: security.NewMemoryRevocationStore(),
+		Lifetimes:   tokens.Lifetimes(),
+		Issuer:      tokens.Issuer,
+		Audience:    tokens.Audience,
+	}
+}
+
+// newTestServer creates a testServer with the deps and the default
+// configuration. A missing Store is replaced with a new memory database with
+// susan, missing Tokens with a JWTIssuer of newIssuer, a missing Hasher with
+// a fast Bcrypt one and a missing Mailer with a mailbox.
+func newTestServer(t *testing.T, deps Dependencies) *testServer {
+	t.Helper()
+	return newTestServerWithConfig(t, config.Default(), deps)
+}
+
+// newTestServerWithConfig is newTestServer configured by the cfg.
+func newTestServerWithConfig(t *testing.T, cfg *config.Config, deps Dependencies) *testServer {
+	t.Helper()
+
+	if deps.Hasher == nil {
+		deps.Hasher = security.BcryptHasher{Cost: bcrypt.MinCost}
+	}
+	if deps.Store == nil {
+		deps.Store = db.NewMemoryConnection()
+
+		// susan owns refresh tokens issued in tests, so she must exist
+		passwordHash, _ := deps.Hasher.Hash("123")
+		deps.Store.SaveUser(context.Background(), &db.UserModel{
+			Email:        "susan@barz.com",
+			Username:     susan.Username,
+			PasswordHash: passwordHash,
+		})
+	}
+	tokens, ok := deps.Tokens.(*security.JWTIssuer)
+	if !ok {
+		tokens = newIssuer(t, security.DefaultAlgorithm)
+		deps.Tokens = tokens
 	}
-	server = api.HandlerWithOptions(s, servOpts)
 
-	db.DBConn = mocks.DBConnectionMock{}
+	if deps.Mailer == nil {
+		deps.Mailer = &mailbox{}
+	}
+	mails, _ := deps.Mailer.(*mailbox)
 
-	code := m.Run()
+	s, err := NewGoAuthServer(cfg, deps)
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+	servOpts := api.ChiServerOptions{
+		BaseRouter:  chi.NewRouter(),
+		Middlewares: []api.MiddlewareFunc{middleware.BearerAuth(tokens)},
+	}
 
-	os.Exit(code)
+	return &testServer{
+		handler: api.HandlerWithOptions(s, servOpts),
+		server:  s,
+		store:   deps.Store,
+		tokens:  tokens,
+		mailbox: mails,
+	}
 }
 
-func executeRequest(req *http.Request) *httptest.ResponseRecorder {
+func (s *testServer) executeRequest(req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
-	server.ServeHTTP(rr, req)
+	s.handler.ServeHTTP(rr, req)
 
 	return rr
 }
 
+func TestNewGoAuthServerMissingDependencies(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		deps Dependencies
+	}{
+		{"Store", Dependencies{Tokens: newIssuer(t, security.DefaultAlgorithm)}},
+		{"Tokens", Dependencies{Store: db.NewMemoryConnection()}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewGoAuthServer(config.Default(), tc.deps); err == nil {
+				t.Error("Expected error for missing dependency")
+			}
+		})
+	}
+}
+
 func TestSignupBadRequest(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	testCases := []struct {
 		name                                string
 		reqString                           string
@@ -96,7 +217,7 @@ func TestSignupBadRequest(t *testing.T) {
 		{
 			"LargeBody",
 			fmt.Sprintf("{\"email\":%q,\"password\":\"foobarz\",\"username\":\"Barz\"}",
-				strings.Repeat("email", 140)),
+				strings.Repeat("email", 220)),
 			http.StatusRequestEntityTooLarge, "Bad request",
 			fmt.Sprintf("Request body must not be larger than %dB", maxSize),
 			signupPath,
@@ -115,7 +236,7 @@ func TestSignupBadRequest(t *testing.T) {
 			req := httptest.NewRequest("POST", signupPath, strings.NewReader(tc.reqString))
 			req.Header.Add(consts.ContentType, consts.ApplicationJSON)
 
-			res := executeRequest(req)
+			res := s.executeRequest(req)
 			var pd api.ProblemDetails
 			err := json.Unmarshal(res.Body.Bytes(), &pd)
 			if err != nil {
@@ -139,10 +260,12 @@ func TestSignupBadRequest(t *testing.T) {
 }
 
 func TestSignupValidRequest(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	reqBody := api.SignupRequest{
 		Email:    "test@foo.com",
 		Username: "Barz",
-		Password: "foobarz",
+		Password: "Qwerty-42x",
 	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(reqBody)
@@ -154,9 +277,9 @@ func TestSignupValidRequest(t *testing.T) {
 	req := httptest.NewRequest("POST", "/signup", &buf)
 	req.Header.Add(consts.ContentType, consts.ApplicationJSON)
 
-	wantCode := http.StatusOK
+	wantCode := http.StatusCreated
 
-	res := executeRequest(req)
+	res := s.executeRequest(req)
 
 	if res.Code != wantCode {
 		t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
@@ -164,8 +287,10 @@ func TestSignupValidRequest(t *testing.T) {
 }
 
 func TestSignupUsernameAlreadyExists(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	username := "Barz"
-	db.DBConn.SaveUser(&db.UserModel{
+	s.store.SaveUser(context.Background(), &db.UserModel{
 		Email:        "bar@foo.com",
 		Username:     username,
 		PasswordHash: "hash",
@@ -174,7 +299,7 @@ func TestSignupUsernameAlreadyExists(t *testing.T) {
 	reqBody := api.SignupRequest{
 		Email:    "test@foo.com",
 		Username: username,
-		Password: "foobarz",
+		Password: "Qwerty-42x",
 	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(reqBody)
@@ -191,7 +316,7 @@ func TestSignupUsernameAlreadyExists(t *testing.T) {
 	wantDetail := fmt.Sprintf("Username '%s' already exists", username)
 	wantInstance := signupPath
 
-	res := executeRequest(req)
+	res := s.executeRequest(req)
 	var pd api.ProblemDetails
 	err = json.Unmarshal(res.Body.Bytes(), &pd)
 	if err != nil {
@@ -213,8 +338,10 @@ func TestSignupUsernameAlreadyExists(t *testing.T) {
 }
 
 func TestSignupEmailAlreadyExists(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	email := "bar@foo.com"
-	db.DBConn.SaveUser(&db.UserModel{
+	s.store.SaveUser(context.Background(), &db.UserModel{
 		Email:        email,
 		Username:     "Bar",
 		PasswordHash: "hash",
@@ -223,7 +350,7 @@ func TestSignupEmailAlreadyExists(t *testing.T) {
 	reqBody := api.SignupRequest{
 		Email:    email,
 		Username: "John",
-		Password: "foobarz",
+		Password: "Qwerty-42x",
 	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(reqBody)
@@ -240,7 +367,7 @@ func TestSignupEmailAlreadyExists(t *testing.T) {
 	wantDetail := fmt.Sprintf("Email '%s' is already used", email)
 	wantInstance := signupPath
 
-	res := executeRequest(req)
+	res := s.executeRequest(req)
 	var pd api.ProblemDetails
 	err = json.Unmarshal(res.Body.Bytes(), &pd)
 	if err != nil {
@@ -262,6 +389,8 @@ func TestSignupEmailAlreadyExists(t *testing.T) {
 }
 
 func TestLoginBadRequest(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	testCases := []struct {
 		name                                string
 		reqString                           string
@@ -312,7 +441,7 @@ func TestLoginBadRequest(t *testing.T) {
 		{
 			"LargeBody",
 			fmt.Sprintf("{\"username\":%q,\"password\":\"foobarz\"}",
-				strings.Repeat("Josh", 150)),
+				strings.Repeat("Josh", 270)),
 			http.StatusRequestEntityTooLarge, "Bad request",
 			fmt.Sprintf("Request body must not be larger than %dB", maxSize),
 			loginPath,
@@ -331,7 +460,7 @@ func TestLoginBadRequest(t *testing.T) {
 			req := httptest.NewRequest("POST", "/login", strings.NewReader(tc.reqString))
 			req.Header.Add(consts.ContentType, consts.ApplicationJSON)
 
-			res := executeRequest(req)
+			res := s.executeRequest(req)
 			var pd api.ProblemDetails
 			err := json.Unmarshal(res.Body.Bytes(), &pd)
 			if err != nil {
@@ -355,6 +484,8 @@ func TestLoginBadRequest(t *testing.T) {
 }
 
 func TestLoginUsernameDoesntExists(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	username := "James"
 
 	reqBody := api.LoginRequest{
@@ -377,7 +508,7 @@ func TestLoginUsernameDoesntExists(t *testing.T) {
 	wantDetail := "Submitted credentials are invalid"
 	wantInstance := loginPath
 
-	res := executeRequest(req)
+	res := s.executeRequest(req)
 	var pd api.ProblemDetails
 	err = json.Unmarshal(res.Body.Bytes(), &pd)
 	if err != nil {
@@ -399,11 +530,13 @@ func TestLoginUsernameDoesntExists(t *testing.T) {
 }
 
 func TestLoginInvalidPassword(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	username := "James"
 	passwd := "123"
-	passwordHash, _ := security.EncryptPassword(passwd)
+	passwordHash, _ := s.server.hasher.Hash(passwd)
 
-	db.DBConn.SaveUser(&db.UserModel{
+	s.store.SaveUser(context.Background(), &db.UserModel{
 		Email:        "james@barz.com",
 		Username:     username,
 		PasswordHash: passwordHash,
@@ -429,7 +562,7 @@ func TestLoginInvalidPassword(t *testing.T) {
 	wantDetail := "Submitted credentials are invalid"
 	wantInstance := loginPath
 
-	res := executeRequest(req)
+	res := s.executeRequest(req)
 	var pd api.ProblemDetails
 	err = json.Unmarshal(res.Body.Bytes(), &pd)
 	if err != nil {
@@ -450,12 +583,39 @@ func TestLoginInvalidPassword(t *testing.T) {
 	}
 }
 
+// slowDB is a database, whose queries exceed their timeout.
+type slowDB struct {
+	*db.MemoryConnection
+}
+
+func (slowDB) UserByUsername(ctx context.Context, username string) (*db.UserDBEntity, error) {
+	return nil, context.DeadlineExceeded
+}
+
+func TestLoginDatabaseTimeout(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Store: slowDB{db.NewMemoryConnection()}})
+
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(api.LoginRequest{Username: "Susan", Password: "123"})
+	req := httptest.NewRequest("POST", "/login", &buf)
+	req.Header.Add(consts.ContentType, consts.ApplicationJSON)
+
+	res := s.executeRequest(req)
+
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status code, expected %d, but was %d", http.StatusServiceUnavailable, res.Code)
+	}
+}
+
 func TestLoginValidRequest(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
 	username := "Susan"
 	passwd := "123"
-	passwordHash, _ := security.EncryptPassword(passwd)
+	passwordHash, _ := s.server.hasher.Hash(passwd)
 
-	db.DBConn.SaveUser(&db.UserModel{
+	s.store.SaveUser(context.Background(), &db.UserModel{
 		Email:        "susan@barz.com",
 		Username:     username,
 		PasswordHash: passwordHash,
@@ -480,7 +640,7 @@ func TestLoginValidRequest(t *testing.T) {
 	wantClaimUsername := fmt.Sprintf("%q:%q", "username", username)
 	var resBody api.LoginResponse
 
-	res := executeRequest(req)
+	res := s.executeRequest(req)
 	json.Unmarshal(res.Body.Bytes(), &resBody)
 
 	if res.Code != wantCode {
@@ -497,3 +657,293 @@ func TestLoginValidRequest(t *testing.T) {
 	}
 
 }
+
+func TestLoginRehashesPassword(t *testing.T) {
+	t.Parallel()
+	argon2 := security.Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}
+	s := newTestServer(t, Dependencies{Hasher: argon2})
+	ts := httptest.NewServer(s.handler)
+	defer ts.Close()
+
+	ctx := context.Background()
+	bcryptHash, _ := security.BcryptHasher{Cost: bcrypt.MinCost}.Hash("123")
+	s.store.UpdatePassword(ctx, susan.Username, bcryptHash)
+
+	credentials := api.LoginRequest{Username: susan.Username, Password: "123"}
+	if code := post(t, ts, "/login", "", credentials, nil); code != http.StatusOK {
+		t.Fatalf("Login with a Bcrypt hash, expected %d, but was %d", http.StatusOK, code)
+	}
+	user, _ := s.store.UserByUsername(ctx, susan.Username)
+	if !strings.HasPrefix(user.PasswordHash, "$argon2id$") {
+		t.Fatalf("Expected the hash to be replaced by Argon2id, but was %q", user.PasswordHash)
+	}
+
+	if code := post(t, ts, "/login", "", credentials, nil); code != http.StatusOK {
+		t.Errorf("Login with an Argon2id hash, expected %d, but was %d", http.StatusOK, code)
+	}
+	if again, _ := s.store.UserByUsername(ctx, susan.Username); again.PasswordHash != user.PasswordHash {
+		t.Error("Expected an up to date hash to be kept")
+	}
+
+	credentials.Password = "1234"
+	if code := post(t, ts, "/login", "", credentials, nil); code != http.StatusUnauthorized {
+		t.Errorf("Login with a wrong password, expected %d, but was %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	cfg := config.Default().Password
+
+	if _, ok := NewPasswordHasher(cfg).(security.Argon2idHasher); !ok {
+		t.Errorf("Expected Argon2id hasher by default")
+	}
+
+	cfg.Algorithm = "bcrypt"
+	if h, ok := NewPasswordHasher(cfg).(security.BcryptHasher); !ok || h.Cost != cfg.BcryptCost {
+		t.Errorf("Expected Bcrypt hasher of cost %d, but was %+v", cfg.BcryptCost, h)
+	}
+}
+
+func TestGetJWKS(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{Tokens: newIssuer(t, security.ES256)})
+	key, _ := s.tokens.Keys.Primary()
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+
+	wantCode := http.StatusOK
+	var resBody api.JWKSResponse
+
+	res := s.executeRequest(req)
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	if res.Code != wantCode {
+		t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
+	}
+	if len(resBody.Keys) != 1 {
+		t.Fatalf("Expected 1 key, but was %d", len(resBody.Keys))
+	}
+
+	jwk := resBody.Keys[0]
+	if jwk.Kid != key.ID {
+		t.Errorf("Expected kid to be %s, but was %s", key.ID, jwk.Kid)
+	}
+	if jwk.Kty != "EC" || jwk.X == nil || jwk.Y == nil {
+		t.Errorf("Expected EC key with coordinates, but was %+v", jwk)
+	}
+	if jwk.N != nil {
+		t.Errorf("EC key should not have a modulus, but was %q", *jwk.N)
+	}
+}
+
+func TestGetJWKSHidesHMACKeys(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+
+	var resBody api.JWKSResponse
+	res := s.executeRequest(req)
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	if len(resBody.Keys) != 0 {
+		t.Errorf("Expected no keys, but was %d", len(resBody.Keys))
+	}
+}
+
+func (s *testServer) refreshRequest(t *testing.T, refreshToken string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(api.RefreshTokenRequest{RefreshToken: refreshToken})
+	if err != nil {
+		t.Fatal("Error in encoding of struct")
+	}
+
+	req := httptest.NewRequest("POST", "/token/refresh", &buf)
+	req.Header.Add(consts.ContentType, consts.ApplicationJSON)
+
+	return s.executeRequest(req)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	_, refreshToken, err := s.server.issueTokens(context.Background(), security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "rotation-family"})
+	if err != nil {
+		t.Fatalf("err was not nil, %q", err.Error())
+	}
+
+	res := s.refreshRequest(t, refreshToken)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status code to be %d, but was %d", http.StatusOK, res.Code)
+	}
+
+	var resBody api.TokenResponse
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	if resBody.RefreshToken == "" || resBody.RefreshToken == refreshToken {
+		t.Errorf("Expected new refresh token, but was %q", resBody.RefreshToken)
+	}
+	c, err := s.tokens.ValidateToken(context.Background(), resBody.AccessToken, security.TokenAccess)
+	if err != nil {
+		t.Fatalf("Expected valid access token, but %q", err.Error())
+	}
+	user, _ := s.store.UserByUsername(context.Background(), susan.Username)
+	if c.Subject != user.Uuid.String() {
+		t.Errorf("Expected subject %q, but was %q", user.Uuid.String(), c.Subject)
+	}
+
+	res = s.refreshRequest(t, resBody.RefreshToken)
+	if res.Code != http.StatusOK {
+		t.Errorf("Rotated refresh token should be valid, but status was %d", res.Code)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	access, refreshToken, _ := s.server.issueTokens(context.Background(), security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "reuse-family"})
+
+	res := s.refreshRequest(t, refreshToken)
+	var resBody api.TokenResponse
+	json.Unmarshal(res.Body.Bytes(), &resBody)
+
+	res = s.refreshRequest(t, refreshToken)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Reused refresh token, expected %d, but was %d", http.StatusUnauthorized, res.Code)
+	}
+
+	res = s.refreshRequest(t, resBody.RefreshToken)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Token from revoked family, expected %d, but was %d", http.StatusUnauthorized, res.Code)
+	}
+
+	for _, jwt := range []string{access, resBody.AccessToken} {
+		if _, err := s.tokens.ValidateToken(context.Background(), jwt, security.TokenAccess); err == nil {
+			t.Error("Access token of revoked family should be rejected")
+		}
+	}
+}
+
+func TestRefreshTokenInvalid(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	notSaved, _ := s.tokens.GenerateRefreshToken()
+	accessToken, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+	expired, _ := s.tokens.GenerateRefreshToken()
+	s.store.SaveRefreshToken(context.Background(), &db.RefreshTokenDBEntity{
+		TokenHash: expired.Hash,
+		FamilyID:  "expired-family",
+		Username:  susan.Username,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+
+	testCases := []struct {
+		name         string
+		refreshToken string
+	}{
+		{"Unknown", "unknown"},
+		{"NotSaved", notSaved.Token},
+		{"AccessToken", accessToken},
+		{"Expired", expired.Token},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wantCode := http.StatusUnauthorized
+
+			res := s.refreshRequest(t, tc.refreshToken)
+
+			if res.Code != wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	session := security.Subject{UserID: susan.UserID, Username: susan.Username, SessionID: "logout-family"}
+	earlier, _, _ := s.server.issueTokens(context.Background(), session)
+	jwt, refreshToken, _ := s.server.issueTokens(context.Background(), session)
+
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.Header.Add(consts.Authorization, consts.BearerPrefix+jwt)
+
+	wantCode := http.StatusNoContent
+
+	res := s.executeRequest(req)
+
+	if res.Code != wantCode {
+		t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
+	}
+	if _, err := s.tokens.ValidateToken(context.Background(), jwt, security.TokenAccess); err == nil {
+		t.Error("Token should be revoked after logout")
+	}
+	if _, err := s.tokens.ValidateToken(context.Background(), earlier, security.TokenAccess); err == nil {
+		t.Error("Earlier token of the session should be revoked after logout")
+	}
+
+	res = s.refreshRequest(t, refreshToken)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh token should be revoked after logout, but status was %d", res.Code)
+	}
+}
+
+func TestLogoutInvalidToken(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	testCases := []struct {
+		name   string
+		header string
+	}{
+		{"NoHeader", ""},
+		{"NotBearer", "Basic xyz"},
+		{"InvalidToken", consts.BearerPrefix + "invalid"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/logout", nil)
+			req.Header.Add(consts.Authorization, tc.header)
+
+			wantCode := http.StatusUnauthorized
+
+			res := s.executeRequest(req)
+
+			if res.Code != wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", wantCode, res.Code)
+			}
+		})
+	}
+}
+
+func TestTestAuth(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t, Dependencies{})
+	unauthToken, _ := s.tokens.GenerateJWT(security.TokenMFAPending, susan)
+	authToken, _ := s.tokens.GenerateJWT(security.TokenAccess, susan)
+
+	testCases := []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{"NoHeader", "", http.StatusUnauthorized},
+		{"NotBearer", "Basic xyz", http.StatusUnauthorized},
+		{"PreTwoFactorToken", consts.BearerPrefix + unauthToken, http.StatusUnauthorized},
+		{"FullyAuthenticatedToken", consts.BearerPrefix + authToken, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test-auth", nil)
+			req.Header.Add(consts.Authorization, tc.header)
+
+			res := s.executeRequest(req)
+
+			if res.Code != tc.wantCode {
+				t.Errorf("Expected status code to be %d, but was %d", tc.wantCode, res.Code)
+			}
+		})
+	}
+}